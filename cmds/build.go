@@ -0,0 +1,242 @@
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/dev-kas/xel/helpers"
+	"github.com/dev-kas/xel/modules"
+
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/dev-kas/virtlang-go/v4/ast"
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/parser"
+	"github.com/urfave/cli/v2"
+)
+
+// Layout of a bundle: the project is stored under bundleAppDir, and the packages
+// it depends on under bundleModulesDir, in the same layout as a module path
+const (
+	bundleAppDir     = "app"
+	bundleModulesDir = "modules"
+)
+
+// BuildCommand returns the cli.Command for the build command
+// It bundles the project's entry point, along with every file and package it
+// imports, into a copy of the xel executable.
+func BuildCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "build",
+		Usage: "Bundle the project into a self-contained executable",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Write the executable to `FILE` (defaults to the project name)",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+
+			manifest, manifestPath, err := helpers.FetchManifest(cwd, cwd)
+			if err != nil {
+				return err
+			}
+			if manifest.Main == "" {
+				return fmt.Errorf("xel.json does not specify a `main` entry point")
+			}
+			projectDir := filepath.Dir(manifestPath)
+
+			bundler := &bundler{seen: map[string]bool{}}
+			bundler.add(manifestPath, path.Join(bundleAppDir, "xel.json"))
+
+			entry := filepath.Join(projectDir, manifest.Main)
+			if err := bundler.collect(entry, projectDir, bundleAppDir, manifest.ImportableDeps(true)); err != nil {
+				return err
+			}
+
+			output := c.String("output")
+			if output == "" {
+				output = path.Base(manifest.Name)
+				if runtime.GOOS == "windows" {
+					output += ".exe"
+				}
+			}
+			output, err = filepath.Abs(output)
+			if err != nil {
+				return err
+			}
+			if executable, err := os.Executable(); err == nil && executable == output {
+				return fmt.Errorf("cannot overwrite the running executable %s", output)
+			}
+
+			if err := helpers.WriteBundle(output, bundler.files); err != nil {
+				return fmt.Errorf("failed to write %s: %v", output, err)
+			}
+
+			xShared.ColorPalette.Info.Printf("Built %s (%d files)\n", output, len(bundler.files))
+			return nil
+		},
+	}
+}
+
+// bundler gathers the files that make up a bundle
+type bundler struct {
+	files []helpers.BundleFile
+	seen  map[string]bool
+}
+
+// add stores the file at filePath under name, unless it was already stored
+func (b *bundler) add(filePath, name string) bool {
+	if b.seen[filePath] {
+		return false
+	}
+	b.seen[filePath] = true
+	b.files = append(b.files, helpers.BundleFile{Name: name, Path: filePath})
+	return true
+}
+
+// collect adds the script at file, and everything it imports, to the bundle. The
+// script belongs to the project or package rooted at rootDir, which is stored
+// under prefix and can import the packages listed in deps.
+func (b *bundler) collect(file, rootDir, prefix string, deps map[string]string) error {
+	rel, err := filepath.Rel(rootDir, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return fmt.Errorf("cannot bundle %s: it lies outside of %s", file, rootDir)
+	}
+	if !b.add(file, path.Join(prefix, filepath.ToSlash(rel))) {
+		return nil
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %v", file, err)
+	}
+	program, err := parser.New(file).ProduceAST(string(content))
+	if err != nil {
+		return err
+	}
+
+	for _, specifier := range staticImports(program, file) {
+		if _, isNative := modules.GetNativeModuleLoader(specifier); isNative {
+			continue
+		}
+
+		// Imports resolve as they do when the script runs
+		target, pkgManifest, err := helpers.ResolveImport(specifier, file, deps)
+		if err != nil {
+			return fmt.Errorf("cannot bundle the import of '%s' in %s: %v", specifier, file, err)
+		}
+
+		// Local imports stay within the same project or package
+		if pkgManifest == nil {
+			if err := b.collect(target, rootDir, prefix, deps); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Keep the `<module>/<version>` directories, so the package resolves the same way from the bundle
+		pkgDir, ok := helpers.PackageDir(target, pkgManifest)
+		if !ok {
+			return fmt.Errorf("cannot bundle package '%s': its entry point %s lies outside of it", pkgManifest.Name, pkgManifest.Main)
+		}
+		pkgPrefix := path.Join(bundleModulesDir, filepath.Base(filepath.Dir(pkgDir)), filepath.Base(pkgDir))
+		b.add(filepath.Join(pkgDir, "xel.json"), path.Join(pkgPrefix, "xel.json"))
+
+		if err := b.collect(target, pkgDir, pkgPrefix, pkgManifest.ImportableDeps(false)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// importCall is an `import(...)` call. Its specifier is empty unless it is a string literal.
+type importCall struct {
+	Specifier string
+	Call      *ast.CallExpr
+}
+
+// findImports returns the `import(...)` calls made in program
+func findImports(program *ast.Program) []importCall {
+	imports := []importCall{}
+	helpers.WalkAST(program, func(node ast.Stmt) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		callee, ok := call.Callee.(*ast.Identifier)
+		if !ok || callee.Symbol != "import" || len(call.Args) != 1 {
+			return true
+		}
+
+		imp := importCall{Call: call}
+		if specifier, ok := call.Args[0].(*ast.StringLiteral); ok {
+			imp.Specifier = specifier.Value
+		}
+		imports = append(imports, imp)
+		return true
+	})
+	return imports
+}
+
+// staticImports returns the specifiers of the `import("...")` calls in program.
+// Imports whose specifier is not a string literal cannot be followed, and are
+// reported as a warning.
+func staticImports(program *ast.Program, file string) []string {
+	specifiers := []string{}
+	for _, imp := range findImports(program) {
+		if imp.Specifier == "" {
+			xShared.ColorPalette.Warning.Printf("%s:%d: skipping dynamic import, it will not be bundled\n", file, imp.Call.SourceMetadata.StartLine)
+			continue
+		}
+		specifiers = append(specifiers, imp.Specifier)
+	}
+	return specifiers
+}
+
+// RunBundle runs the project bundled into dir by `xel build`, passing it args
+// the same way `xel run` does
+func RunBundle(dir string, args []string) error {
+	// Packages are only ever resolved from the bundle
+	xShared.XelConfig.ModulePaths = []string{filepath.Join(dir, bundleModulesDir)}
+
+	appDir := filepath.Join(dir, bundleAppDir)
+	manifest, _, err := loadManifest(appDir)
+	if err != nil {
+		return err
+	}
+
+	// The bundle lives in a temporary directory, so relative paths refer to the working directory
+	if manifest.Permissions != nil {
+		if err := applyManifestPermissions(manifest, ""); err != nil {
+			return err
+		}
+	}
+
+	if err := setupProc(manifest, args); err != nil {
+		return err
+	}
+
+	evalErr := evaluateFile(filepath.Join(appDir, manifest.Main), environment.NewEnvironment(xShared.XelRootEnv))
+	if evalErr != nil {
+		// show the stack trace, with paths relative to the bundled project
+		if len(xShared.XelRootDebugger.Snapshots) > 0 {
+			stackTrace := xShared.XelRootDebugger.Snapshots[0]
+			stackTraceStr := helpers.GenerateStackTrace(stackTrace.Stack, appDir)
+			xShared.ColorPalette.Error.Println(stackTraceStr)
+		}
+		return evalErr
+	}
+
+	return nil
+}
@@ -0,0 +1,549 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dev-kas/xel/helpers"
+	"github.com/dev-kas/xel/modules"
+
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/dev-kas/virtlang-go/v4/ast"
+	"github.com/dev-kas/virtlang-go/v4/lexer"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/urfave/cli/v2"
+)
+
+// checkDiagnostic is a problem found by `xel check`
+type checkDiagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"` // "error" or "warning"
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+}
+
+// checkReport is the output of `xel check --json`
+type checkReport struct {
+	Files       int               `json:"files"`
+	Errors      int               `json:"errors"`
+	Warnings    int               `json:"warnings"`
+	Diagnostics []checkDiagnostic `json:"diagnostics"`
+}
+
+// Rules reported by `xel check`
+const (
+	ruleSyntax        = "syntax"
+	ruleUndefined     = "undefined"
+	ruleUnused        = "unused"
+	ruleConstAssign   = "const-assign"
+	ruleUnknownMember = "unknown-member"
+	ruleBadImport     = "bad-import"
+)
+
+// CheckCommand returns the cli.Command for the check command
+// It analyses the project's files without running them, and reports names that
+// are not declared, unused variables, assignments to constants, unknown members
+// of native modules and imports that cannot be resolved.
+func CheckCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "check",
+		Usage:     "Report likely mistakes in .xel files without running them",
+		ArgsUsage: "[files or directories...]",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Print the report as JSON",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+
+			roots := c.Args().Slice()
+			if len(roots) == 0 {
+				projectDir := cwd
+				if _, manifestPath, err := helpers.FetchManifest(cwd, cwd); err == nil {
+					projectDir = filepath.Dir(manifestPath)
+				}
+				roots = []string{projectDir}
+			}
+
+			files, err := discoverFiles(roots, ".xel")
+			if err != nil {
+				return err
+			}
+
+			diagnostics := []checkDiagnostic{}
+			for _, file := range files {
+				for _, diagnostic := range checkFile(file) {
+					if rel, err := filepath.Rel(cwd, diagnostic.File); err == nil {
+						diagnostic.File = rel
+					}
+					diagnostics = append(diagnostics, diagnostic)
+				}
+			}
+
+			errorCount := 0
+			for _, diagnostic := range diagnostics {
+				if diagnostic.Severity == "error" {
+					errorCount++
+				}
+			}
+			warningCount := len(diagnostics) - errorCount
+
+			if c.Bool("json") {
+				report := checkReport{
+					Files:       len(files),
+					Errors:      errorCount,
+					Warnings:    warningCount,
+					Diagnostics: diagnostics,
+				}
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(report); err != nil {
+					return err
+				}
+			} else {
+				for _, diagnostic := range diagnostics {
+					location := fmt.Sprintf("%s:%d:%d:", diagnostic.File, diagnostic.Line, diagnostic.Column)
+					palette := xShared.ColorPalette.Error
+					if diagnostic.Severity == "warning" {
+						palette = xShared.ColorPalette.Warning
+					}
+					fmt.Printf("%s %s %s %s\n", location, palette.Sprint(diagnostic.Severity+":"), diagnostic.Message, xShared.ColorPalette.GrayMessage.Sprintf("(%s)", diagnostic.Rule))
+				}
+
+				if len(diagnostics) == 0 {
+					xShared.ColorPalette.Info.Printf("No problems found in %d file(s).\n", len(files))
+				} else {
+					fmt.Println()
+					xShared.ColorPalette.GrayMessage.Printf("%d error(s), %d warning(s) in %d file(s)\n", errorCount, warningCount, len(files))
+				}
+			}
+
+			if errorCount > 0 {
+				return fmt.Errorf("found %d error(s)", errorCount)
+			}
+			return nil
+		},
+	}
+}
+
+// checkDecl is a name declared in a scope
+type checkDecl struct {
+	Name      string
+	Kind      string // "variable", "constant", "function", "class", "parameter", "member", "global"...
+	Constant  bool
+	Line, Col int
+	// Whether the name is read somewhere
+	Used bool
+	// Whether an unused declaration is reported
+	Local bool
+	// The native module the name holds, when it is bound to `import("xel:...")`
+	Module string
+}
+
+// checkScope mirrors an environment the evaluator creates. Names declared in a
+// scope are visible in all of it, as functions can refer to names declared after them.
+type checkScope struct {
+	parent *checkScope
+	decls  map[string][]*checkDecl
+}
+
+func (s *checkScope) child() *checkScope {
+	return &checkScope{parent: s, decls: map[string][]*checkDecl{}}
+}
+
+func (s *checkScope) declare(decl *checkDecl) {
+	s.decls[decl.Name] = append(s.decls[decl.Name], decl)
+}
+
+// lookup returns the declarations name refers to from s
+func (s *checkScope) lookup(name string) []*checkDecl {
+	for scope := s; scope != nil; scope = scope.parent {
+		if decls, ok := scope.decls[name]; ok {
+			return decls
+		}
+	}
+	return nil
+}
+
+// checker analyses a single file
+type checker struct {
+	file        string
+	tokens      []lexer.Token
+	deps        map[string]string
+	decls       []*checkDecl
+	diagnostics []checkDiagnostic
+	// The scope of the file itself, whose variables other code may use
+	top *checkScope
+}
+
+// nativeExports caches the members of each native module
+var nativeExports = map[string]map[string]bool{}
+
+// checkFile analyses the file at path and returns the problems found in it
+func checkFile(path string) []checkDiagnostic {
+	c := &checker{file: path, deps: map[string]string{}}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		c.report(1, 1, "error", ruleSyntax, fmt.Sprintf("cannot read file: %v", err))
+		return c.diagnostics
+	}
+
+	program, err := parseSource(path, string(content))
+	if err != nil {
+		r := errorRange(err)
+		c.report(r.Start.Line+1, r.Start.Character+1, "error", ruleSyntax, err.Error())
+		return c.diagnostics
+	}
+	c.tokens, _ = lexer.Tokenize(string(content))
+
+	dir := filepath.Dir(path)
+	// Dev and peer dependencies can be imported by the project as well
+	if manifest, _, err := helpers.FetchManifest(dir, dir); err == nil {
+		c.deps = manifest.ImportableDeps(true)
+	}
+
+	// The globals are those of the runtime, such as `print` and `import`
+	globals := &checkScope{decls: map[string][]*checkDecl{}}
+	xShared.XelRootEnv.Mutex.RLock()
+	for name := range xShared.XelRootEnv.Variables {
+		_, constant := xShared.XelRootEnv.Constants[name]
+		globals.declare(&checkDecl{Name: name, Kind: "global", Constant: constant})
+	}
+	xShared.XelRootEnv.Mutex.RUnlock()
+
+	c.top = globals.child()
+	c.block(program.Stmts, c.top)
+
+	for _, decl := range c.decls {
+		if decl.Local && !decl.Used && !strings.HasPrefix(decl.Name, "_") {
+			c.report(decl.Line, decl.Col, "warning", ruleUnused, fmt.Sprintf("`%s` is declared but never used", decl.Name))
+		}
+	}
+
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		a, b := c.diagnostics[i], c.diagnostics[j]
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return c.diagnostics
+}
+
+func (c *checker) report(line, col int, severity, rule, message string) {
+	c.diagnostics = append(c.diagnostics, checkDiagnostic{
+		File:     c.file,
+		Line:     line,
+		Column:   col,
+		Severity: severity,
+		Rule:     rule,
+		Message:  message,
+	})
+}
+
+func (c *checker) declare(scope *checkScope, decl *checkDecl) {
+	scope.declare(decl)
+	c.decls = append(c.decls, decl)
+}
+
+// block checks statements that run in scope
+func (c *checker) block(stmts []ast.Stmt, scope *checkScope) {
+	for _, stmt := range stmts {
+		c.declarations(stmt, scope)
+	}
+	for _, stmt := range stmts {
+		c.visit(stmt, scope)
+	}
+}
+
+// declarations declares in scope the names that stmt declares in its environment
+func (c *checker) declarations(stmt ast.Stmt, scope *checkScope) {
+	switch node := stmt.(type) {
+	case *ast.VarDeclaration:
+		line, col := namePosition(c.tokens, node.SourceMetadata, node.Identifier)
+		// Top-level variables may be used by the code that imports or evaluates the file
+		decl := &checkDecl{Name: node.Identifier, Kind: "variable", Constant: node.Constant, Line: line, Col: col, Local: scope != c.top}
+		if node.Constant {
+			decl.Kind = "constant"
+		}
+		if specifier := importSpecifier(node.Value); specifier != "" {
+			if _, isNative := modules.GetNativeModuleLoader(specifier); isNative {
+				decl.Module = specifier
+			}
+		}
+		c.declare(scope, decl)
+
+		// `let f = fn name() {}` declares name as well
+		if fn, ok := node.Value.(*ast.FnDeclaration); ok {
+			c.declarations(fn, scope)
+		}
+
+	case *ast.FnDeclaration:
+		if node.Name != "" {
+			line, col := namePosition(c.tokens, node.SourceMetadata, node.Name)
+			c.declare(scope, &checkDecl{Name: node.Name, Kind: "function", Constant: true, Line: line, Col: col})
+		}
+
+	case *ast.Class:
+		line, col := namePosition(c.tokens, node.SourceMetadata, node.Name)
+		c.declare(scope, &checkDecl{Name: node.Name, Kind: "class", Constant: true, Line: line, Col: col})
+
+	case *ast.IfStatement:
+		// The branches of an `if` run in the environment around it
+		for _, child := range node.Body {
+			c.declarations(child, scope)
+		}
+		for _, elseIf := range node.ElseIf {
+			c.declarations(elseIf, scope)
+		}
+		for _, child := range node.Else {
+			c.declarations(child, scope)
+		}
+	}
+}
+
+// visit checks the names used by node
+func (c *checker) visit(node ast.Stmt, scope *checkScope) {
+	switch n := node.(type) {
+	case *ast.VarDeclaration:
+		c.visit(n.Value, scope)
+
+	case *ast.FnDeclaration:
+		c.function(n.Params, n.Body, scope)
+
+	case *ast.Class:
+		// Members are visible by name from the methods
+		classScope := scope.child()
+		for _, stmt := range n.Body {
+			switch member := stmt.(type) {
+			case *ast.ClassMethod:
+				c.declare(classScope, &checkDecl{Name: member.Name, Kind: "member", Line: member.StartLine, Col: member.StartColumn})
+			case *ast.ClassProperty:
+				c.declare(classScope, &checkDecl{Name: member.Name, Kind: "member", Line: member.StartLine, Col: member.StartColumn})
+			}
+		}
+
+		for _, stmt := range n.Body {
+			switch member := stmt.(type) {
+			case *ast.ClassMethod:
+				c.function(member.Params, member.Body, classScope)
+			case *ast.ClassProperty:
+				c.visit(member.Value, classScope)
+			}
+		}
+		if n.Constructor != nil {
+			c.function(n.Constructor.Params, n.Constructor.Body, classScope)
+		}
+
+	case *ast.IfStatement:
+		c.visit(n.Condition, scope)
+		for _, stmt := range n.Body {
+			c.visit(stmt, scope)
+		}
+		for _, elseIf := range n.ElseIf {
+			c.visit(elseIf, scope)
+		}
+		for _, stmt := range n.Else {
+			c.visit(stmt, scope)
+		}
+
+	case *ast.WhileLoop:
+		c.visit(n.Condition, scope)
+		c.block(n.Body, scope.child())
+
+	case *ast.TryCatchStmt:
+		c.block(n.Try, scope.child())
+		catchScope := scope.child()
+		catchScope.declare(&checkDecl{Name: n.CatchVar, Kind: "variable"})
+		c.block(n.Catch, catchScope)
+
+	case *ast.ReturnStmt:
+		c.visit(n.Value, scope)
+
+	case *ast.VarAssignmentExpr:
+		if target, ok := n.Assignee.(*ast.Identifier); ok {
+			decls := scope.lookup(target.Symbol)
+			if decls == nil {
+				c.report(target.StartLine, target.StartColumn, "error", ruleUndefined, fmt.Sprintf("`%s` is assigned but never declared", target.Symbol))
+			} else if decls[0].Constant {
+				message := fmt.Sprintf("cannot assign to %s `%s`", decls[0].Kind, target.Symbol)
+				if decls[0].Kind == "parameter" {
+					message += ", parameters are constant"
+				}
+				c.report(target.StartLine, target.StartColumn, "error", ruleConstAssign, message)
+			}
+		} else {
+			c.visit(n.Assignee, scope)
+		}
+		c.visit(n.Value, scope)
+
+	case *ast.Identifier:
+		c.use(n.Symbol, n.StartLine, n.StartColumn, scope)
+
+	case *ast.MemberExpr:
+		c.visit(n.Object, scope)
+		if n.Computed {
+			c.visit(n.Value, scope)
+			return
+		}
+
+		member, ok := n.Value.(*ast.Identifier)
+		specifier := c.moduleOf(n.Object, scope)
+		if !ok || specifier == "" {
+			return
+		}
+		if exports := moduleExports(specifier); exports != nil && !exports[member.Symbol] {
+			c.report(member.StartLine, member.StartColumn, "error", ruleUnknownMember, fmt.Sprintf("module '%s' has no member `%s`", specifier, member.Symbol))
+		}
+
+	case *ast.CallExpr:
+		c.visit(n.Callee, scope)
+		for _, arg := range n.Args {
+			c.visit(arg, scope)
+		}
+		if specifier := importSpecifier(n); specifier != "" {
+			c.checkImport(specifier, n.Args[0].GetSourceMetadata())
+		}
+
+	case *ast.BinaryExpr:
+		c.visit(n.LHS, scope)
+		c.visit(n.RHS, scope)
+
+	case *ast.CompareExpr:
+		c.visit(n.LHS, scope)
+		c.visit(n.RHS, scope)
+
+	case *ast.LogicalExpr:
+		if n.LHS != nil {
+			c.visit(*n.LHS, scope)
+		}
+		c.visit(n.RHS, scope)
+
+	case *ast.ObjectLiteral:
+		for _, prop := range n.Properties {
+			if prop.Value == nil {
+				// `{ name }` reads the variable name
+				c.use(prop.Key, n.StartLine, n.StartColumn, scope)
+			} else {
+				c.visit(prop.Value, scope)
+			}
+		}
+
+	case *ast.ArrayLiteral:
+		for _, element := range n.Elements {
+			c.visit(element, scope)
+		}
+	}
+}
+
+// function checks the body of a function or method declared in scope
+func (c *checker) function(params []string, body []ast.Stmt, scope *checkScope) {
+	fnScope := scope.child()
+	for _, param := range params {
+		fnScope.declare(&checkDecl{Name: param, Kind: "parameter", Constant: true})
+	}
+	c.block(body, fnScope)
+}
+
+// use records that name is read at line and col
+func (c *checker) use(name string, line, col int, scope *checkScope) {
+	decls := scope.lookup(name)
+	if decls == nil {
+		c.report(line, col, "error", ruleUndefined, fmt.Sprintf("`%s` is not defined", name))
+		return
+	}
+	for _, decl := range decls {
+		decl.Used = true
+	}
+}
+
+// moduleOf returns the native module that expr evaluates to, if it is known
+func (c *checker) moduleOf(expr ast.Expr, scope *checkScope) string {
+	if id, ok := expr.(*ast.Identifier); ok {
+		for _, decl := range scope.lookup(id.Symbol) {
+			if decl.Module != "" {
+				return decl.Module
+			}
+		}
+		return ""
+	}
+
+	if specifier := importSpecifier(expr); specifier != "" {
+		if _, isNative := modules.GetNativeModuleLoader(specifier); isNative {
+			return specifier
+		}
+	}
+	return ""
+}
+
+// checkImport reports an import that cannot be resolved
+func (c *checker) checkImport(specifier string, meta ast.SourceMetadata) {
+	if _, isNative := modules.GetNativeModuleLoader(specifier); isNative {
+		return
+	}
+
+	if strings.HasPrefix(specifier, "xel:") {
+		c.report(meta.StartLine, meta.StartColumn, "error", ruleBadImport, fmt.Sprintf("'%s' is not a native module", specifier))
+		return
+	}
+
+	if _, listed := c.deps[specifier]; !listed && specifier[0] != '.' {
+		c.report(meta.StartLine, meta.StartColumn, "error", ruleBadImport, fmt.Sprintf("package '%s' is not listed in the dependencies of xel.json", specifier))
+		return
+	}
+
+	path, _, err := helpers.ResolveImport(specifier, c.file, c.deps)
+	if err != nil {
+		// The package is listed, but not installed here
+		c.report(meta.StartLine, meta.StartColumn, "warning", ruleBadImport, err.Error())
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		c.report(meta.StartLine, meta.StartColumn, "error", ruleBadImport, fmt.Sprintf("cannot find module '%s' at %s", specifier, path))
+	}
+}
+
+// importSpecifier returns the specifier of expr when it is `import("...")`
+func importSpecifier(expr ast.Expr) string {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return ""
+	}
+	if callee, ok := call.Callee.(*ast.Identifier); !ok || callee.Symbol != "import" {
+		return ""
+	}
+	if specifier, ok := call.Args[0].(*ast.StringLiteral); ok {
+		return specifier.Value
+	}
+	return ""
+}
+
+// moduleExports returns the names of the members of a native module
+func moduleExports(specifier string) map[string]bool {
+	if exports, cached := nativeExports[specifier]; cached {
+		return exports
+	}
+
+	var exports map[string]bool
+	if loader, isNative := modules.GetNativeModuleLoader(specifier); isNative {
+		if module, err := loader(); err == nil && module.Type == shared.Object {
+			exports = map[string]bool{}
+			for name := range module.Value.(map[string]*shared.RuntimeValue) {
+				exports[name] = true
+			}
+		}
+	}
+
+	nativeExports[specifier] = exports
+	return exports
+}
@@ -0,0 +1,46 @@
+package cmds
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dev-kas/xel/globals"
+	xShared "github.com/dev-kas/xel/shared"
+)
+
+func TestCheckUnused(t *testing.T) {
+	globals.Globalize(xShared.XelRootEnv)
+
+	src := `let top = 1
+if (true) {
+  let inIf = 2
+}
+fn f(param) {
+  let local = 3
+  let _ignored = 4
+  return 1
+}
+while (false) {
+  let inLoop = 5
+}
+print(f(0))
+`
+	path := filepath.Join(t.TempDir(), "main.xel")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the variables of functions and blocks are reported
+	unused := map[int]bool{}
+	for _, d := range checkFile(path) {
+		if d.Rule != ruleUnused {
+			t.Errorf("unexpected %s at line %d: %s", d.Rule, d.Line, d.Message)
+			continue
+		}
+		unused[d.Line] = true
+	}
+	if len(unused) != 2 || !unused[6] || !unused[11] {
+		t.Errorf("unused variables reported at lines %v, want 6 and 11", unused)
+	}
+}
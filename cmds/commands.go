@@ -6,9 +6,15 @@ import "github.com/urfave/cli/v2"
 func GetCommands() []*cli.Command {
 	return []*cli.Command{
 		RunCommand(),
+		TaskCommand(),
 		InitCommand(),
 		PackageCommands(),
 		TemplateCommand(),
 		DebugCommand(),
+		TestCommand(),
+		BuildCommand(),
+		LSPCommand(),
+		FmtCommand(),
+		CheckCommand(),
 	}
 }
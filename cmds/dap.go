@@ -0,0 +1,775 @@
+package cmds
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dev-kas/xel/helpers"
+
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/dev-kas/virtlang-go/v4/ast"
+	"github.com/dev-kas/virtlang-go/v4/debugger"
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/evaluator"
+	"github.com/dev-kas/virtlang-go/v4/parser"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+// dapThreadID is the id of the only thread reported to clients
+const dapThreadID = 1
+
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapResponse struct {
+	Seq        int    `json:"seq"`
+	Type       string `json:"type"`
+	RequestSeq int    `json:"request_seq"`
+	Success    bool   `json:"success"`
+	Command    string `json:"command"`
+	Message    string `json:"message,omitempty"`
+	Body       any    `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int    `json:"seq"`
+	Type  string `json:"type"`
+	Event string `json:"event"`
+	Body  any    `json:"body,omitempty"`
+}
+
+type dapSource struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+// dapStop is where the script is stopped, as seen from the statement it stopped at
+type dapStop struct {
+	stack debugger.CallStack
+	file  string
+	line  int
+	env   *environment.Environment
+}
+
+// dapSession serves the Debug Adapter Protocol to a single client. Breakpoints
+// and steps go through xShared.XelRootDebugger, like those of the terminal
+// debugger, but the script stops from the step hook (see helpers.InstrumentSteps),
+// on the goroutine evaluating it, so that the stop can be reported and the
+// requests only see the state it stopped with.
+type dapSession struct {
+	c      *cli.Context
+	reader *bufio.Reader
+	writer io.Writer
+
+	writeMu sync.Mutex
+	seq     int
+
+	filename    string
+	cwd         string
+	stopOnEntry bool
+	launched    bool
+	started     bool
+	// Closed once the script returned
+	done chan struct{}
+
+	// Guards what follows and the breakpoints of the debugger, which the script
+	// reads before every statement
+	mu sync.Mutex
+	// The step the debugger was told to make, and the depth of the call stack it
+	// started from, which the debugger keeps to itself
+	stepType  debugger.StepType
+	fromDepth int
+	// Whether the next stop is the entry of the script, or was asked for with `pause`
+	entry, pauseRequested bool
+	// Whether the script is being ended, and must not stop anymore
+	ending bool
+	// Where the script is stopped, nil while it runs
+	stop *dapStop
+	// References handed out to the client for scopes and structured values,
+	// valid until the script resumes
+	handles map[int]any
+
+	afterResponse []func()
+	// Forwards what is left of the output and puts stdout back
+	releaseOutput func()
+}
+
+// serveDAP runs a Debug Adapter Protocol session over stdio, or over the first
+// connection made to the port given with --port
+func serveDAP(c *cli.Context) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	var conn io.ReadWriter = struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}
+
+	if c.IsSet("port") && !c.Bool("stdio") {
+		listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", c.Int("port")))
+		if err != nil {
+			return err
+		}
+		xShared.ColorPalette.Info.Printf("Waiting for a debug client on %s\n", listener.Addr())
+		client, err := listener.Accept()
+		listener.Close()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		conn = client
+	}
+
+	s := &dapSession{
+		c:       c,
+		reader:  bufio.NewReader(conn),
+		writer:  conn,
+		cwd:     cwd,
+		handles: map[int]any{},
+	}
+
+	// Whatever the script prints is forwarded to the client, which also keeps
+	// stdout free for the protocol
+	if err := s.captureOutput(); err != nil {
+		return err
+	}
+	defer s.releaseOutput()
+
+	return s.serve()
+}
+
+// serve handles requests until the client disconnects
+func (s *dapSession) serve() error {
+	for {
+		content, err := helpers.ReadProtocolMessage(s.reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req dapRequest
+		if err := json.Unmarshal(content, &req); err != nil || req.Type != "request" {
+			continue
+		}
+
+		body, err := s.handle(req)
+		s.respond(req, body, err)
+
+		for _, action := range s.afterResponse {
+			action()
+		}
+		s.afterResponse = nil
+
+		if req.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+func (s *dapSession) send(message any) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.seq++
+	switch m := message.(type) {
+	case *dapResponse:
+		m.Seq = s.seq
+	case *dapEvent:
+		m.Seq = s.seq
+	}
+	helpers.WriteProtocolMessage(s.writer, message)
+}
+
+func (s *dapSession) respond(req dapRequest, body any, err error) {
+	response := &dapResponse{
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Success:    err == nil,
+		Command:    req.Command,
+		Body:       body,
+	}
+	if err != nil {
+		response.Message = err.Error()
+	}
+	s.send(response)
+}
+
+func (s *dapSession) sendEvent(event string, body any) {
+	s.send(&dapEvent{Type: "event", Event: event, Body: body})
+}
+
+// captureOutput redirects stdout into output events until s.releaseOutput is called
+func (s *dapSession) captureOutput() error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	stdout, colorOutput := os.Stdout, color.Output
+	os.Stdout, color.Output = w, w
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 4096)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				s.sendEvent("output", map[string]any{"category": "stdout", "output": string(buf[:n])})
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	s.releaseOutput = sync.OnceFunc(func() {
+		w.Close()
+		<-done
+		r.Close()
+		os.Stdout, color.Output = stdout, colorOutput
+	})
+	return nil
+}
+
+// handle runs a request and returns the body of its response
+func (s *dapSession) handle(req dapRequest) (any, error) {
+	switch req.Command {
+	case "initialize":
+		s.afterResponse = append(s.afterResponse, func() { s.sendEvent("initialized", nil) })
+		return map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}, nil
+
+	case "launch":
+		return nil, s.launch(req.Arguments)
+
+	case "setBreakpoints":
+		return s.setBreakpoints(req.Arguments)
+
+	case "setExceptionBreakpoints":
+		return map[string]any{"breakpoints": []any{}}, nil
+
+	case "configurationDone":
+		if !s.launched {
+			return nil, fmt.Errorf("the program has not been launched")
+		}
+		s.afterResponse = append(s.afterResponse, s.start)
+		return nil, nil
+
+	case "threads":
+		return map[string]any{"threads": []map[string]any{{"id": dapThreadID, "name": "main"}}}, nil
+
+	case "stackTrace":
+		return s.stackTrace()
+
+	case "scopes":
+		return s.scopes()
+
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		json.Unmarshal(req.Arguments, &args)
+		return s.variables(args.VariablesReference)
+
+	case "evaluate":
+		var args struct {
+			Expression string `json:"expression"`
+		}
+		json.Unmarshal(req.Arguments, &args)
+		return s.evaluate(args.Expression)
+
+	// The script is only resumed once the response is sent, so that its next stop is reported after it
+	case "continue":
+		s.resumeAfterResponse("")
+		return map[string]any{"allThreadsContinued": true}, nil
+
+	case "next":
+		s.resumeAfterResponse(debugger.StepOver)
+		return nil, nil
+
+	case "stepIn":
+		s.resumeAfterResponse(debugger.StepInto)
+		return nil, nil
+
+	case "stepOut":
+		s.resumeAfterResponse(debugger.StepOut)
+		return nil, nil
+
+	case "pause":
+		s.mu.Lock()
+		s.pauseRequested = true
+		s.mu.Unlock()
+		return nil, nil
+
+	// A script that runs is ended, and then reports that it terminated itself
+	case "disconnect", "terminate":
+		s.afterResponse = append(s.afterResponse, func() {
+			if !s.end() && req.Command == "terminate" {
+				s.sendEvent("terminated", nil)
+			}
+		})
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported request %q", req.Command)
+	}
+}
+
+// launch prepares the script given on the command line, or in the `program`
+// argument, without running it yet
+func (s *dapSession) launch(rawArgs json.RawMessage) error {
+	var args struct {
+		Program     string   `json:"program"`
+		Args        []string `json:"args"`
+		StopOnEntry bool     `json:"stopOnEntry"`
+	}
+	if len(rawArgs) > 0 {
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			return err
+		}
+	}
+
+	program, scriptArgs := args.Program, args.Args
+	if s.c.NArg() > 0 {
+		program, scriptArgs = s.c.Args().First(), s.c.Args().Tail()
+	}
+	if program == "" {
+		return fmt.Errorf("filename is required")
+	}
+
+	filename, err := resolveScriptPath(program)
+	if err != nil {
+		return err
+	}
+
+	manifest, manifestPath, err := loadManifest(filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+	if err := applyPermissions(s.c, manifest, manifestPath); err != nil {
+		return err
+	}
+	if err := setupProc(manifest, scriptArgs); err != nil {
+		return err
+	}
+
+	s.filename = filename
+	s.stopOnEntry = args.StopOnEntry
+	s.launched = true
+	return nil
+}
+
+// start runs the launched script, which reports its stops from s.step until it ends
+func (s *dapSession) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	s.done = make(chan struct{})
+
+	dbgr := xShared.XelRootDebugger
+	s.mu.Lock()
+	if s.stopOnEntry {
+		dbgr.StepInto()
+		s.stepType, s.entry = debugger.StepInto, true
+	} else {
+		dbgr.Continue()
+	}
+	s.mu.Unlock()
+
+	// The evaluator would stop by itself wherever the debugger is paused, at a
+	// breakpoint or done stepping, without telling anyone. Nothing is debuggable
+	// to it while the script runs, so that it only stops from s.step, and the
+	// frame it would push for the script is pushed here.
+	debuggables := debugger.Debuggables
+	debugger.Debuggables = map[ast.NodeType]struct{}{}
+	dbgr.PushFrame(debugger.StackFrame{Name: "<main>", Filename: s.filename, Line: 1})
+
+	helpers.SetStepHook(s.step)
+	env := environment.NewEnvironment(xShared.XelRootEnv)
+	go func() {
+		evalErr := evaluateFile(s.filename, env)
+		helpers.SetStepHook(nil)
+		dbgr.PopFrame()
+		debugger.Debuggables = debuggables
+		s.finish(evalErr)
+		close(s.done)
+	}()
+}
+
+// end interrupts the script if it runs or is stopped, and waits until it returned.
+// It reports whether the script was started.
+func (s *dapSession) end() bool {
+	if !s.started {
+		return false
+	}
+	helpers.InterruptEvaluation(func() {
+		s.mu.Lock()
+		s.ending = true
+		s.mu.Unlock()
+		s.resume("")
+		<-s.done
+	})
+	return true
+}
+
+// step runs before every statement of the script, and stops it there when the
+// debugger has a breakpoint there or is done stepping, or when the client asked
+// to pause. The stop is reported to the client, and the script waits in the
+// debugger until it is resumed.
+func (s *dapSession) step(env *environment.Environment, file string, line int) *errors.RuntimeError {
+	dbgr := xShared.XelRootDebugger
+	depth := len(dbgr.CallStack)
+
+	s.mu.Lock()
+	// Functions called by `evaluate` while the script is stopped run through
+	if s.stop != nil || s.ending {
+		s.mu.Unlock()
+		return nil
+	}
+
+	reason := ""
+	switch {
+	case dbgr.ShouldStop(file, line):
+		reason = "breakpoint"
+	case s.pauseRequested:
+		reason = "pause"
+	case dbgr.State != debugger.SteppingState:
+	case s.entry:
+		reason = "entry"
+	case s.stepType == debugger.StepInto,
+		s.stepType == debugger.StepOver && depth <= s.fromDepth,
+		s.stepType == debugger.StepOut && depth < s.fromDepth:
+		reason = "step"
+	}
+	if reason == "" {
+		s.mu.Unlock()
+		return nil
+	}
+
+	s.stop = &dapStop{
+		stack: debugger.DeepCopyCallStack(dbgr.CallStack),
+		file:  file,
+		line:  line,
+		env:   env,
+	}
+	s.entry, s.pauseRequested = false, false
+	s.handles = map[int]any{}
+	dbgr.Pause()
+	s.mu.Unlock()
+
+	s.sendEvent("stopped", map[string]any{
+		"reason":            reason,
+		"threadId":          dapThreadID,
+		"allThreadsStopped": true,
+	})
+	// Returns once s.resume continued or stepped
+	dbgr.WaitIfPaused(ast.CallExprNode)
+	return nil
+}
+
+// resume lets the stopped script run on, until it reaches a breakpoint or, with
+// a stepType, until the step is complete
+func (s *dapSession) resume(stepType debugger.StepType) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stop := s.stop
+	if stop == nil {
+		return
+	}
+	s.stop = nil
+	s.stepType = stepType
+	s.fromDepth = len(stop.stack)
+	s.handles = map[int]any{}
+
+	dbgr := xShared.XelRootDebugger
+	switch stepType {
+	case debugger.StepInto:
+		dbgr.StepInto()
+	case debugger.StepOver:
+		dbgr.StepOver()
+	case debugger.StepOut:
+		dbgr.StepOut()
+	default:
+		dbgr.Continue()
+	}
+}
+
+// resumeAfterResponse resumes the script once the response is sent, so that its
+// next stop is reported after it
+func (s *dapSession) resumeAfterResponse(stepType debugger.StepType) {
+	s.afterResponse = append(s.afterResponse, func() { s.resume(stepType) })
+}
+
+// stopped returns where the script is stopped, or an error while it runs
+func (s *dapSession) stopped() (*dapStop, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop == nil {
+		return nil, fmt.Errorf("the program is running")
+	}
+	return s.stop, nil
+}
+
+// finish reports the end of the script
+func (s *dapSession) finish(evalErr error) {
+	s.releaseOutput()
+
+	exitCode := 0
+	if evalErr != nil && helpers.IsInterrupted(evalErr) {
+		exitCode = 1
+	} else if evalErr != nil {
+		exitCode = 1
+
+		output := ""
+		dbgr := xShared.XelRootDebugger
+		if len(dbgr.Snapshots) > 0 {
+			output += helpers.GenerateStackTrace(dbgr.Snapshots[0].Stack, s.cwd)
+		}
+		output += evalErr.Error() + "\n"
+		s.sendEvent("output", map[string]any{"category": "stderr", "output": output})
+	}
+
+	s.sendEvent("exited", map[string]any{"exitCode": exitCode})
+	s.sendEvent("terminated", nil)
+}
+
+// setBreakpoints replaces the breakpoints of a source file
+func (s *dapSession) setBreakpoints(rawArgs json.RawMessage) (any, error) {
+	var args struct {
+		Source      dapSource `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, err
+	}
+
+	path, err := filepath.Abs(args.Source.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bm := &xShared.XelRootDebugger.BreakpointManager
+	// Breakpoints are kept as `<file>:<line>`, and paths may have colons of their own
+	for key := range bm.Breakpoints {
+		sep := strings.LastIndex(key, ":")
+		if line, err := strconv.Atoi(key[sep+1:]); sep >= 0 && err == nil && key[:sep] == path {
+			bm.Remove(path, line)
+		}
+	}
+
+	verified := []map[string]any{}
+	for _, bp := range args.Breakpoints {
+		bm.Set(path, bp.Line)
+		verified = append(verified, map[string]any{
+			"verified": true,
+			"line":     bp.Line,
+			"source":   dapSource{Name: filepath.Base(path), Path: path},
+		})
+	}
+
+	return map[string]any{"breakpoints": verified}, nil
+}
+
+// stackTrace lists the frames of the stopped script, most recent first. Frames in
+// the call stack hold the location they were called from, so each frame takes
+// its location from the one called by it, and the innermost frame from the
+// location the script is stopped at.
+func (s *dapSession) stackTrace() (any, error) {
+	stop, err := s.stopped()
+	if err != nil {
+		return nil, err
+	}
+	stack := stop.stack
+
+	frame := func(id int, name, file string, line int) map[string]any {
+		return map[string]any{
+			"id":     id,
+			"name":   name,
+			"source": dapSource{Name: filepath.Base(file), Path: file},
+			"line":   max(line, 1),
+			"column": 1,
+		}
+	}
+
+	frames := []map[string]any{}
+	if len(stack) == 0 {
+		frames = append(frames, frame(0, "<main>", stop.file, stop.line))
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		file, line := stop.file, stop.line
+		if i < len(stack)-1 {
+			file, line = stack[i+1].Filename, stack[i+1].Line
+		}
+		frames = append(frames, frame(len(stack)-1-i, stack[i].Name, file, line))
+	}
+
+	return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+// scopes lists the environments the stopped statement can see, innermost first
+func (s *dapSession) scopes() (any, error) {
+	stop, err := s.stopped()
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := []map[string]any{}
+	for env := stop.env; env != nil; env = env.Parent {
+		name := "Enclosing"
+		switch {
+		case env.Parent == nil:
+			name = "Globals"
+		case len(scopes) == 0:
+			name = "Locals"
+		}
+		scopes = append(scopes, map[string]any{
+			"name":               name,
+			"variablesReference": s.reference(env),
+			"expensive":          env.Parent == nil,
+		})
+	}
+	return map[string]any{"scopes": scopes}, nil
+}
+
+// reference returns a new reference to an environment or a structured value
+func (s *dapSession) reference(target any) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ref := len(s.handles) + 1
+	s.handles[ref] = target
+	return ref
+}
+
+// variables lists the variables of an environment, or the members of a value
+func (s *dapSession) variables(ref int) (any, error) {
+	s.mu.Lock()
+	target, exists := s.handles[ref]
+	s.mu.Unlock()
+	if !exists {
+		return nil, fmt.Errorf("unknown variables reference %d", ref)
+	}
+
+	members := map[string]*shared.RuntimeValue{}
+	names := []string{}
+	switch target := target.(type) {
+	case *environment.Environment:
+		target.Mutex.RLock()
+		for name, value := range target.Variables {
+			members[name] = value
+			names = append(names, name)
+		}
+		target.Mutex.RUnlock()
+		sort.Strings(names)
+	case *shared.RuntimeValue:
+		if elements, ok := target.Value.([]shared.RuntimeValue); ok && target.Type == shared.Array {
+			for i := range elements {
+				name := fmt.Sprint(i)
+				members[name] = &elements[i]
+				names = append(names, name)
+			}
+		} else {
+			members = memberValues(target)
+			for name := range members {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+	}
+
+	variables := []dapVariable{}
+	for _, name := range names {
+		variables = append(variables, s.variable(name, members[name]))
+	}
+	return map[string]any{"variables": variables}, nil
+}
+
+// variable describes a value to the client, handing out a reference to it when it has members
+func (s *dapSession) variable(name string, value *shared.RuntimeValue) dapVariable {
+	v := dapVariable{Name: name, Type: shared.Stringify(value.Type)}
+	switch value.Type {
+	case shared.Object:
+		members, _ := value.Value.(map[string]*shared.RuntimeValue)
+		v.Value = fmt.Sprintf("{...} (%d)", len(members))
+		v.VariablesReference = s.reference(value)
+	case shared.Array:
+		elements, _ := value.Value.([]shared.RuntimeValue)
+		v.Value = fmt.Sprintf("[...] (%d)", len(elements))
+		v.VariablesReference = s.reference(value)
+	case shared.ClassInstance:
+		v.Value = "instance"
+		if instance, ok := value.Value.(values.ClassInstanceValue); ok {
+			v.Value = instance.Class.Name + " instance"
+		}
+		v.VariablesReference = s.reference(value)
+	default:
+		v.Value = helpers.Stringify(*value, true)
+	}
+	return v
+}
+
+// evaluate evaluates an expression in the environment of the stopped statement,
+// the same way the `eval` command of the terminal debugger does. The script waits
+// for it, so both never run at once.
+func (s *dapSession) evaluate(expression string) (any, error) {
+	stop, err := s.stopped()
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, perr := parser.New(s.filename).ProduceAST(expression)
+	if perr != nil {
+		return nil, fmt.Errorf("parser error: %v", perr)
+	}
+	helpers.RewriteCatches(stmt)
+	res, eerr := evaluator.Evaluate(stmt, stop.env, nil)
+	if eerr != nil {
+		return nil, fmt.Errorf("evaluation error: %v", eerr)
+	}
+
+	result := s.variable("", res)
+	return map[string]any{
+		"result":             result.Value,
+		"type":               result.Type,
+		"variablesReference": result.VariablesReference,
+	}, nil
+}
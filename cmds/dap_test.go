@@ -0,0 +1,316 @@
+package cmds
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dev-kas/xel/globals"
+	"github.com/dev-kas/xel/helpers"
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/dev-kas/virtlang-go/v4/debugger"
+	"github.com/urfave/cli/v2"
+)
+
+const dapTestScript = `fn add(a, b) {
+  let sum = a + b
+  return sum
+}
+let x = 1
+let y = add(x, 2)
+print("y is", y)
+`
+
+// dapMessage is any message the adapter sends
+type dapMessage struct {
+	Type       string          `json:"type"`
+	Command    string          `json:"command"`
+	Event      string          `json:"event"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// dapClient drives `xel debug --dap` over its stdin and stdout
+type dapClient struct {
+	t        *testing.T
+	stdin    *os.File
+	messages chan dapMessage
+	seq      int
+	output   strings.Builder
+}
+
+// startDAP runs `xel debug --dap` with stdin and stdout replaced by pipes
+func startDAP(t *testing.T) *dapClient {
+	t.Helper()
+
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, stdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdinReader, stdoutWriter
+
+	done := make(chan error, 1)
+	go func() {
+		app := &cli.App{Name: "xel", Commands: []*cli.Command{DebugCommand()}}
+		done <- app.Run([]string{"xel", "debug", "--dap"})
+	}()
+
+	client := &dapClient{t: t, stdin: stdinWriter, messages: make(chan dapMessage, 64)}
+	go func() {
+		defer close(client.messages)
+		reader := bufio.NewReader(stdoutReader)
+		for {
+			content, err := helpers.ReadProtocolMessage(reader)
+			if err != nil {
+				return
+			}
+			var message dapMessage
+			if json.Unmarshal(content, &message) == nil {
+				client.messages <- message
+			}
+		}
+	}()
+
+	t.Cleanup(func() {
+		stdinWriter.Close()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("xel debug --dap failed: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("xel debug --dap did not return after the client left")
+		}
+		os.Stdin, os.Stdout = stdin, stdout
+		stdoutWriter.Close()
+		stdoutReader.Close()
+		stdinReader.Close()
+	})
+	return client
+}
+
+// request sends a request and returns the body of its response, which must succeed
+func (c *dapClient) request(command string, arguments any) json.RawMessage {
+	c.t.Helper()
+	c.seq++
+	err := helpers.WriteProtocolMessage(c.stdin, map[string]any{
+		"seq":       c.seq,
+		"type":      "request",
+		"command":   command,
+		"arguments": arguments,
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	response := c.expect("response", command)
+	if response.RequestSeq != c.seq || !response.Success {
+		c.t.Fatalf("%s failed: %s", command, response.Message)
+	}
+	return response.Body
+}
+
+// expect waits for the next response or event named name, collecting the output
+// of the script on the way
+func (c *dapClient) expect(kind, name string) dapMessage {
+	c.t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case message, ok := <-c.messages:
+			if !ok {
+				c.t.Fatalf("the adapter stopped before sending %s %s", kind, name)
+			}
+			if message.Event == "output" {
+				var body struct {
+					Output string `json:"output"`
+				}
+				json.Unmarshal(message.Body, &body)
+				c.output.WriteString(body.Output)
+			}
+			if message.Type == kind && (message.Command == name || message.Event == name) {
+				return message
+			}
+		case <-timeout:
+			c.t.Fatalf("timed out waiting for %s %s", kind, name)
+		}
+	}
+}
+
+// expectStop waits for the script to stop for reason, and returns the name and
+// line of the innermost frame
+func (c *dapClient) expectStop(reason string) (string, int) {
+	c.t.Helper()
+	var stopped struct {
+		Reason string `json:"reason"`
+	}
+	json.Unmarshal(c.expect("event", "stopped").Body, &stopped)
+	if stopped.Reason != reason {
+		c.t.Fatalf("stopped for %q, want %q", stopped.Reason, reason)
+	}
+	if state := xShared.XelRootDebugger.State; state != debugger.PausedState {
+		c.t.Fatalf("the debugger is %s while the script is stopped", state)
+	}
+
+	var trace struct {
+		StackFrames []struct {
+			Name string `json:"name"`
+			Line int    `json:"line"`
+		} `json:"stackFrames"`
+	}
+	json.Unmarshal(c.request("stackTrace", map[string]any{"threadId": dapThreadID}), &trace)
+	if len(trace.StackFrames) == 0 {
+		c.t.Fatal("stackTrace returned no frames")
+	}
+	return trace.StackFrames[0].Name, trace.StackFrames[0].Line
+}
+
+// evaluate returns the result of expression in the stopped script
+func (c *dapClient) evaluate(expression string) string {
+	c.t.Helper()
+	var result struct {
+		Result string `json:"result"`
+	}
+	json.Unmarshal(c.request("evaluate", map[string]any{"expression": expression}), &result)
+	return result.Result
+}
+
+func TestDAPSession(t *testing.T) {
+	globals.Globalize(xShared.XelRootEnv)
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "main.xel")
+	if err := os.WriteFile(script, []byte(dapTestScript), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script, _ = filepath.EvalSymlinks(script)
+
+	dbgr := xShared.XelRootDebugger
+	t.Cleanup(dbgr.BreakpointManager.Clear)
+
+	c := startDAP(t)
+	c.request("initialize", map[string]any{"adapterID": "xel"})
+	c.expect("event", "initialized")
+	c.request("launch", map[string]any{"program": script})
+
+	// Breakpoints are those of the debugger, and replace those set before in the same file
+	setBreakpoints := func(lines ...int) {
+		breakpoints := []map[string]any{}
+		for _, line := range lines {
+			breakpoints = append(breakpoints, map[string]any{"line": line})
+		}
+		c.request("setBreakpoints", map[string]any{"source": map[string]any{"path": script}, "breakpoints": breakpoints})
+	}
+	setBreakpoints(2, 3)
+	setBreakpoints(6)
+	if !dbgr.BreakpointManager.Has(script, 6) || dbgr.BreakpointManager.Has(script, 2) || dbgr.BreakpointManager.Has(script, 3) {
+		t.Fatalf("the debugger has the breakpoints %v, want only line 6", dbgr.BreakpointManager.Breakpoints)
+	}
+	c.request("configurationDone", nil)
+
+	if name, line := c.expectStop("breakpoint"); line != 6 {
+		t.Fatalf("stopped in %s at line %d, want line 6", name, line)
+	}
+	if got := c.evaluate("x + 1"); got != "2" {
+		t.Errorf("x + 1 = %s, want 2", got)
+	}
+
+	c.request("stepIn", map[string]any{"threadId": dapThreadID})
+	if name, line := c.expectStop("step"); name != "add" || line != 2 {
+		t.Fatalf("stepped into %s at line %d, want add at line 2", name, line)
+	}
+
+	// The locals of the function are the first scope
+	var scopes struct {
+		Scopes []struct {
+			Name               string `json:"name"`
+			VariablesReference int    `json:"variablesReference"`
+		} `json:"scopes"`
+	}
+	json.Unmarshal(c.request("scopes", map[string]any{"frameId": 0}), &scopes)
+	if len(scopes.Scopes) == 0 || scopes.Scopes[0].Name != "Locals" {
+		t.Fatalf("scopes = %+v, want Locals first", scopes.Scopes)
+	}
+	var variables struct {
+		Variables []dapVariable `json:"variables"`
+	}
+	json.Unmarshal(c.request("variables", map[string]any{"variablesReference": scopes.Scopes[0].VariablesReference}), &variables)
+	locals := map[string]string{}
+	for _, v := range variables.Variables {
+		locals[v.Name] = v.Value
+	}
+	if locals["a"] != "1" || locals["b"] != "2" {
+		t.Errorf("locals = %v, want a = 1 and b = 2", locals)
+	}
+
+	c.request("next", map[string]any{"threadId": dapThreadID})
+	if name, line := c.expectStop("step"); name != "add" || line != 3 {
+		t.Fatalf("stepped over to %s at line %d, want add at line 3", name, line)
+	}
+
+	c.request("stepOut", map[string]any{"threadId": dapThreadID})
+	if _, line := c.expectStop("step"); line != 7 {
+		t.Fatalf("stepped out to line %d, want line 7", line)
+	}
+	if got := c.evaluate("y"); got != "3" {
+		t.Errorf("y = %s, want 3", got)
+	}
+
+	c.request("continue", map[string]any{"threadId": dapThreadID})
+	var exited struct {
+		ExitCode int `json:"exitCode"`
+	}
+	json.Unmarshal(c.expect("event", "exited").Body, &exited)
+	if exited.ExitCode != 0 {
+		t.Errorf("exit code %d, want 0", exited.ExitCode)
+	}
+	c.expect("event", "terminated")
+	if !strings.Contains(c.output.String(), "y is 3") {
+		t.Errorf("output %q does not contain the print of the script", c.output.String())
+	}
+	if dbgr.State != debugger.RunningState || len(debugger.Debuggables) == 0 || len(dbgr.CallStack) != 0 {
+		t.Errorf("the debugger was left %s, with %d debuggable nodes and the stack %v", dbgr.State, len(debugger.Debuggables), dbgr.CallStack)
+	}
+
+	c.request("disconnect", nil)
+}
+
+func TestDAPPause(t *testing.T) {
+	globals.Globalize(xShared.XelRootEnv)
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "loop.xel")
+	if err := os.WriteFile(script, []byte("let n = 0\nwhile (true) {\n  n = n + 1\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := startDAP(t)
+	c.request("initialize", map[string]any{"adapterID": "xel"})
+	c.request("launch", map[string]any{"program": script})
+	c.request("configurationDone", nil)
+
+	c.request("pause", map[string]any{"threadId": dapThreadID})
+	if _, line := c.expectStop("pause"); line != 3 && line != 2 {
+		t.Fatalf("paused at line %d, want inside the loop", line)
+	}
+	if got := c.evaluate("n > 0"); got != "true" {
+		t.Errorf("n > 0 = %s, want true", got)
+	}
+
+	// The script only moves on when told to
+	c.request("next", map[string]any{"threadId": dapThreadID})
+	c.expectStop("step")
+	c.request("disconnect", nil)
+}
@@ -1,7 +1,6 @@
 package cmds
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -13,15 +12,11 @@ import (
 
 	xShared "github.com/dev-kas/xel/shared"
 
-	"github.com/Masterminds/semver/v3"
 	"github.com/chzyer/readline"
 
 	"github.com/dev-kas/virtlang-go/v4/environment"
 	"github.com/dev-kas/virtlang-go/v4/evaluator"
 	"github.com/dev-kas/virtlang-go/v4/parser"
-	"github.com/dev-kas/virtlang-go/v4/shared"
-	"github.com/dev-kas/virtlang-go/v4/values"
-	"github.com/fatih/color"
 	"github.com/urfave/cli/v2"
 )
 
@@ -32,94 +27,50 @@ func DebugCommand() *cli.Command {
 	return &cli.Command{
 		Name:  "debug",
 		Usage: "Debug a VirtLang script file",
+		Flags: append(permissionFlags(),
+			&cli.BoolFlag{
+				Name:  "dap",
+				Usage: "Serve the Debug Adapter Protocol instead of the interactive debugger",
+			},
+			&cli.BoolFlag{
+				Name:  "stdio",
+				Usage: "Serve the Debug Adapter Protocol over stdin and stdout (the default)",
+			},
+			&cli.IntFlag{
+				Name:  "port",
+				Usage: "Serve the Debug Adapter Protocol to the first client connecting to `PORT`",
+			},
+		),
 		Action: func(c *cli.Context) error {
+			if c.Bool("dap") {
+				return serveDAP(c)
+			}
+
 			if c.NArg() < 1 {
 				return fmt.Errorf("filename is required")
 			}
 
-			filename := c.Args().Get(0)
 			cwd, cwd_err := os.Getwd()
 			if cwd_err != nil {
 				return cwd_err
 			}
 
-			// Check if file has .xel extension
-			if !strings.HasSuffix(filename, ".xel") {
-				return fmt.Errorf("file must have .xel extension")
+			if err := checkPermissionValues(c, isScriptPath); err != nil {
+				return err
 			}
 
-			// Check if file exists
-			_, err := os.Stat(filename)
-			if os.IsNotExist(err) {
-				return fmt.Errorf("file %s does not exist", filename)
+			filename, err := resolveScriptPath(c.Args().Get(0))
+			if err != nil {
+				return err
 			}
 
-			// Convert filename to absolute path
-			filename, err = filepath.Abs(filename)
+			manifest, manifestPath, err := loadManifest(filepath.Dir(filename))
 			if err != nil {
 				return err
 			}
 
-			manifest := xShared.ProjectManifest{}
-
-			// Check for xel.json in project directory
-			manifestPath := filepath.Join(filepath.Dir(filename), "xel.json")
-			if _, err := os.Stat(manifestPath); err == nil {
-				// Parse manifest
-				manifestContent, err := os.ReadFile(manifestPath)
-				if err != nil {
-					return fmt.Errorf("failed to read xel.json: %v", err)
-				}
-
-				if err := json.Unmarshal(manifestContent, &manifest); err != nil {
-					return fmt.Errorf("failed to parse xel.json: %v", err)
-				}
-
-				// Check Xel version constraint if specified
-				if *manifest.Xel != "" {
-					// Skip version check in development mode (when version is empty)
-					if xShared.RuntimeVersion == "" {
-						color.New(color.FgYellow).Printf("Skipping Xel version check in development mode\n")
-					} else {
-						constraint, err := semver.NewConstraint(*manifest.Xel)
-						if err != nil {
-							return fmt.Errorf("invalid Xel version constraint in manifest: %v", err)
-						}
-
-						runtimeVersion, err := semver.NewVersion(xShared.RuntimeVersion)
-						if err != nil {
-							return fmt.Errorf("invalid runtime version format: %v", err)
-						}
-
-						if !constraint.Check(runtimeVersion) {
-							return fmt.Errorf("xel version %s does not satisfy required version %s from xel.json, please upgrade your runtime",
-								xShared.RuntimeVersion, *manifest.Xel)
-						}
-					}
-				}
-
-				// Check Engine version constraint if specified
-				if *manifest.Engine != "" {
-					// Skip version check in development mode (when version is empty)
-					if xShared.EngineVersion == "" {
-						color.New(color.FgYellow).Printf("Skipping Engine version check in development mode\n")
-					} else {
-						constraint, err := semver.NewConstraint(*manifest.Engine)
-						if err != nil {
-							return fmt.Errorf("invalid Engine version constraint in manifest: %v", err)
-						}
-
-						engineVersion, err := semver.NewVersion(xShared.EngineVersion)
-						if err != nil {
-							return fmt.Errorf("invalid engine version format: %v", err)
-						}
-
-						if !constraint.Check(engineVersion) {
-							return fmt.Errorf("engine version %s does not satisfy required version %s from xel.json, please upgrade your runtime",
-								xShared.EngineVersion, *manifest.Engine)
-						}
-					}
-				}
+			if err := applyPermissions(c, manifest, manifestPath); err != nil {
+				return err
 			}
 
 			// Get remaining arguments
@@ -130,80 +81,10 @@ func DebugCommand() *cli.Command {
 				}
 			}
 
-			// Convert arguments to []shared.RuntimeValue
-			args := make([]shared.RuntimeValue, len(rawArgs))
-			for i, arg := range rawArgs {
-				args[i] = values.MK_STRING(arg)
-			}
-
-			// Convert manifest to a VirtLang object
-			// Note: This is not reliable because if `manifest` does not exist, it will only use default values
-			manifestConverted := map[string]*shared.RuntimeValue{}
-			nameVal := values.MK_STRING(manifest.Name)
-			manifestConverted["name"] = &nameVal
-			descVal := values.MK_STRING(manifest.Description)
-			manifestConverted["description"] = &descVal
-			versionVal := values.MK_STRING(manifest.Version)
-			manifestConverted["version"] = &versionVal
-			xelVal := values.MK_STRING(*manifest.Xel)
-			manifestConverted["xel"] = &xelVal
-			engineVal := values.MK_STRING(*manifest.Engine)
-			manifestConverted["engine"] = &engineVal
-			mainVal := values.MK_STRING(manifest.Main)
-			manifestConverted["main"] = &mainVal
-			authorVal := values.MK_STRING(manifest.Author)
-			manifestConverted["author"] = &authorVal
-			licenseVal := values.MK_STRING(manifest.License)
-			manifestConverted["license"] = &licenseVal
-			// Convert deps map separately
-			depsObj := values.MK_OBJECT(map[string]*shared.RuntimeValue{})
-			manifestConverted["deps"] = &depsObj
-			depsMap := make(map[string]*shared.RuntimeValue)
-			for k, v := range *manifest.Deps {
-				depVal := values.MK_STRING(v)
-				depsMap[k] = &depVal
-			}
-			(*manifestConverted["deps"]).Value = depsMap
-
-			manifestObj := values.MK_OBJECT(manifestConverted)
-			// Read file content
-			content, err := os.ReadFile(filename)
-			if err != nil {
-				return fmt.Errorf("failed to read file %s: %v", filename, err)
-			}
-
-			program, parseErr := parser.New(filename).ProduceAST(string(content))
-			if parseErr != nil {
-				return parseErr
-			}
-
-			rootEnv := xShared.XelRootEnv
-			RV_proc := map[string]*shared.RuntimeValue{}
-
-			// Check if proc exists
-			if _, err := rootEnv.LookupVar("proc"); err != nil {
-				// Proc doesn't exist, create new one
-				rootEnv.DeclareVar("proc", values.MK_OBJECT(RV_proc), false)
-			} else {
-				// Proc exists, get its value
-				val, err := rootEnv.LookupVar("proc")
-				if err != nil {
-					return fmt.Errorf("failed to lookup proc variable: %v", err)
-				}
-				RV_proc = val.Value.(map[string]*shared.RuntimeValue)
+			if err := setupProc(manifest, rawArgs); err != nil {
+				return err
 			}
 
-			RV_proc_args := values.MK_ARRAY(args)
-			RV_proc["args"] = &RV_proc_args
-			RV_proc["manifest"] = &manifestObj
-
-			// Update the proc variable
-			rootEnv.AssignVar("proc", values.MK_OBJECT(RV_proc))
-
-			env := environment.NewEnvironment(rootEnv)
-			env.DeclareVar("__filename__", values.MK_STRING(filename), true)
-			env.DeclareVar("__dirname__", values.MK_STRING(filepath.Dir(filename)), true)
-
 			// We first have to pause the debugger or
 			// else it will run the program without stopping
 			xShared.XelRootDebugger.Pause()
@@ -213,12 +94,18 @@ func DebugCommand() *cli.Command {
 			// also run it in parallel with the evaluation
 			go debug_repl(filename, cwd)
 
-			_, evalErr := evaluator.Evaluate(program, env, xShared.XelRootDebugger)
+			// Let the debugger evaluate expressions in the script's scope
+			env := environment.NewEnvironment(xShared.XelRootEnv)
+			xShared.XelRootDebugger.Environment = env
+
+			evalErr := evaluateFile(filename, env)
 			if evalErr != nil {
 				// show the stack trace
-				stackTrace := xShared.XelRootDebugger.Snapshots[0]
-				stackTraceStr := helpers.GenerateStackTrace(stackTrace.Stack, cwd)
-				xShared.ColorPalette.Error.Println(stackTraceStr)
+				if len(xShared.XelRootDebugger.Snapshots) > 0 {
+					stackTrace := xShared.XelRootDebugger.Snapshots[0]
+					stackTraceStr := helpers.GenerateStackTrace(stackTrace.Stack, cwd)
+					xShared.ColorPalette.Error.Println(stackTraceStr)
+				}
 				return evalErr
 			}
 
@@ -393,6 +280,7 @@ func debug_repl(file, cwd string) {
 					xShared.ColorPalette.Error.Println("Parser error:", perr)
 					return
 				}
+				helpers.RewriteCatches(stmt)
 				res, eerr := evaluator.Evaluate(stmt, dbgr.Environment, nil)
 				if eerr != nil {
 					xShared.ColorPalette.Error.Println("Evaluation error:", eerr)
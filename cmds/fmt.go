@@ -0,0 +1,105 @@
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dev-kas/xel/helpers"
+
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/urfave/cli/v2"
+)
+
+// FmtCommand returns the cli.Command for the fmt command
+// It rewrites `.xel` files in the canonical layout, or with --check, lists the
+// files that are not formatted yet.
+func FmtCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "fmt",
+		Usage:     "Format .xel files in the canonical style",
+		ArgsUsage: "[files or directories...]",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "check",
+				Usage: "List the files that are not formatted, without changing them, and fail if there are any",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+
+			roots := c.Args().Slice()
+			if len(roots) == 0 {
+				_, manifestPath, err := helpers.FetchManifest(cwd, cwd)
+				if err != nil {
+					return fmt.Errorf("no files given, and no xel.json found in %s or its parents", cwd)
+				}
+				roots = []string{filepath.Dir(manifestPath)}
+			}
+
+			files, err := discoverFiles(roots, ".xel")
+			if err != nil {
+				return err
+			}
+
+			check := c.Bool("check")
+			changed, failed := 0, 0
+			for _, file := range files {
+				display := file
+				if rel, err := filepath.Rel(cwd, file); err == nil {
+					display = rel
+				}
+
+				different, err := formatFile(file, check)
+				if err != nil {
+					xShared.ColorPalette.Error.Printf("%s: %v\n", display, err)
+					failed++
+					continue
+				}
+				if different {
+					fmt.Println(display)
+					changed++
+				}
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d file(s) could not be formatted", failed)
+			}
+			if check && changed > 0 {
+				return fmt.Errorf("%d file(s) are not formatted, run `xel fmt` to fix them", changed)
+			}
+
+			return nil
+		},
+	}
+}
+
+// formatFile formats the file at path in place, unless check is set, and tells
+// whether formatting changes it
+func formatFile(path string, check bool) (bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	formatted, err := helpers.FormatSource(path, string(content))
+	if err != nil {
+		return false, err
+	}
+	if formatted == string(content) {
+		return false, nil
+	}
+	if check {
+		return true, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(path, []byte(formatted), info.Mode())
+}
@@ -0,0 +1,825 @@
+package cmds
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dev-kas/xel/helpers"
+	"github.com/dev-kas/xel/modules"
+
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/dev-kas/virtlang-go/v4/ast"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/lexer"
+	"github.com/dev-kas/virtlang-go/v4/parser"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+// Kinds of completion items, as defined by the Language Server Protocol
+const (
+	lspFunctionItem = 3
+	lspFieldItem    = 5
+	lspVariableItem = 6
+	lspClassItem    = 7
+	lspModuleItem   = 9
+	lspKeywordItem  = 14
+)
+
+var (
+	memberAccessPattern = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\.([A-Za-z0-9_]*)$`)
+	importCallPattern   = regexp.MustCompile(`import\(\s*["']([^"']*)["']\s*\)`)
+	importMemberPattern = regexp.MustCompile(`import\(\s*["']([^"']*)["']\s*\)\.([A-Za-z0-9_]*)$`)
+)
+
+// LSPCommand returns the cli.Command for the lsp command
+// It serves the Language Server Protocol over stdio, for editors to use.
+func LSPCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "lsp",
+		Usage: "Start the language server, speaking LSP over stdin and stdout",
+		Action: func(c *cli.Context) error {
+			// Stdout carries the protocol, so warnings have to go elsewhere
+			color.Output = os.Stderr
+
+			server := &lspServer{
+				reader:    bufio.NewReader(os.Stdin),
+				writer:    os.Stdout,
+				documents: map[string]*lspDocument{},
+			}
+			return server.serve()
+		},
+	}
+}
+
+type lspRequest struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspTextDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+type lspCompletionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// lspDocument is a file opened in the editor
+type lspDocument struct {
+	uri  string
+	path string
+	text string
+	// The last version of the document that parsed without errors
+	program *ast.Program
+}
+
+// lspDecl is a function or class declared at the top level of a file
+type lspDecl struct {
+	Name   string
+	Class  bool
+	Params []string
+	File   string
+	// 1-based position of the name
+	Line, Col int
+}
+
+// signature describes the declaration the way it is written
+func (d *lspDecl) signature() string {
+	if d.Class {
+		return fmt.Sprintf("class %s(%s)", d.Name, strings.Join(d.Params, ", "))
+	}
+	return fmt.Sprintf("fn %s(%s)", d.Name, strings.Join(d.Params, ", "))
+}
+
+// lspMember is a member exported by a module
+type lspMember struct {
+	Name   string
+	Kind   int
+	Detail string
+	// Where the member is declared, for modules written in Xel
+	Decl *lspDecl
+}
+
+// lspMethodNotFound is returned for requests the server does not implement
+type lspMethodNotFound string
+
+func (m lspMethodNotFound) Error() string {
+	return fmt.Sprintf("unsupported method %q", string(m))
+}
+
+// lspServer answers the requests of a single editor
+type lspServer struct {
+	reader *bufio.Reader
+	writer io.Writer
+
+	writeMu sync.Mutex
+
+	documents    map[string]*lspDocument
+	shuttingDown bool
+}
+
+// serve handles messages until the client exits
+func (s *lspServer) serve() error {
+	for {
+		content, err := helpers.ReadProtocolMessage(s.reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req lspRequest
+		if err := json.Unmarshal(content, &req); err != nil {
+			continue
+		}
+
+		if req.Method == "exit" {
+			if !s.shuttingDown {
+				return fmt.Errorf("the client exited without shutting down the language server")
+			}
+			return nil
+		}
+
+		result, err := s.handle(req)
+		// Only requests have an id and expect a response, notifications do not
+		if len(req.ID) > 0 {
+			s.respond(req.ID, result, err)
+		}
+	}
+}
+
+func (s *lspServer) send(message map[string]any) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	message["jsonrpc"] = "2.0"
+	helpers.WriteProtocolMessage(s.writer, message)
+}
+
+func (s *lspServer) respond(id json.RawMessage, result any, err error) {
+	response := map[string]any{"id": id}
+	if err != nil {
+		code := -32603 // Internal error
+		if _, unknown := err.(lspMethodNotFound); unknown {
+			code = -32601
+		}
+		response["error"] = map[string]any{"code": code, "message": err.Error()}
+	} else {
+		response["result"] = result
+	}
+	s.send(response)
+}
+
+func (s *lspServer) notify(method string, params any) {
+	s.send(map[string]any{"method": method, "params": params})
+}
+
+// handle runs a request or notification and returns its result
+func (s *lspServer) handle(req lspRequest) (any, error) {
+	switch req.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": map[string]any{
+					"openClose": true,
+					"change":    1, // The whole document is sent on every change
+				},
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"completionProvider": map[string]any{
+					"triggerCharacters": []string{".", "\"", "'"},
+				},
+			},
+			"serverInfo": map[string]any{"name": "xel", "version": xShared.RuntimeVersion},
+		}, nil
+
+	case "shutdown":
+		s.shuttingDown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		doc := &lspDocument{
+			uri:  params.TextDocument.URI,
+			path: uriToPath(params.TextDocument.URI),
+			text: params.TextDocument.Text,
+		}
+		s.documents[doc.uri] = doc
+		s.diagnose(doc)
+		return nil, nil
+
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		doc, open := s.documents[params.TextDocument.URI]
+		if !open || len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		doc.text = params.ContentChanges[len(params.ContentChanges)-1].Text
+		s.diagnose(doc)
+		return nil, nil
+
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", map[string]any{
+			"uri":         params.TextDocument.URI,
+			"diagnostics": []any{},
+		})
+		return nil, nil
+
+	case "textDocument/completion", "textDocument/hover", "textDocument/definition":
+		var params lspTextDocumentPosition
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		doc, open := s.documents[params.TextDocument.URI]
+		if !open {
+			return nil, nil
+		}
+
+		switch req.Method {
+		case "textDocument/completion":
+			return s.complete(doc, params.Position), nil
+		case "textDocument/hover":
+			return s.hover(doc, params.Position), nil
+		default:
+			return s.definition(doc, params.Position), nil
+		}
+
+	default:
+		if len(req.ID) > 0 && !strings.HasPrefix(req.Method, "$/") {
+			return nil, lspMethodNotFound(req.Method)
+		}
+		return nil, nil
+	}
+}
+
+// diagnose publishes the syntax errors of doc, and the imports that cannot be resolved
+func (s *lspServer) diagnose(doc *lspDocument) {
+	diagnostics := []map[string]any{}
+	diagnostic := func(r lspRange, message string) {
+		diagnostics = append(diagnostics, map[string]any{
+			"range":    r,
+			"severity": 1, // Error
+			"source":   "xel",
+			"message":  message,
+		})
+	}
+
+	program, err := parseSource(doc.path, doc.text)
+	if err != nil {
+		diagnostic(errorRange(err), err.Error())
+	} else {
+		doc.program = program
+
+		for _, imp := range findImports(program) {
+			if imp.Specifier == "" {
+				continue
+			}
+			if _, isNative := modules.GetNativeModuleLoader(imp.Specifier); isNative {
+				continue
+			}
+
+			path, _, err := s.resolveImport(imp.Specifier, doc.path)
+			if err == nil {
+				if _, statErr := os.Stat(path); statErr != nil {
+					err = fmt.Errorf("cannot find module '%s' at %s", imp.Specifier, path)
+				}
+			}
+			if err != nil {
+				// The end of a call is not tracked reliably, so the range stops at the specifier
+				start, end := imp.Call.Callee.GetSourceMetadata(), imp.Call.Args[0].GetSourceMetadata()
+				diagnostic(lspRange{
+					Start: lspPosition{Line: start.StartLine - 1, Character: start.StartColumn - 1},
+					End:   lspPosition{Line: end.EndLine - 1, Character: end.EndColumn - 1},
+				}, err.Error())
+			}
+		}
+	}
+
+	s.notify("textDocument/publishDiagnostics", map[string]any{
+		"uri":         doc.uri,
+		"diagnostics": diagnostics,
+	})
+}
+
+// complete offers the names that can be written at pos: modules inside
+// `import("`, the members of a module after a dot following its import or the
+// variable holding it, and the names in scope otherwise
+func (s *lspServer) complete(doc *lspDocument, pos lspPosition) []lspCompletionItem {
+	before := linePrefix(doc.text, pos)
+	items := []lspCompletionItem{}
+
+	if m := importPrefixPattern.FindStringSubmatch(before); m != nil {
+		for name := range modules.NativeModuleRegistry {
+			items = append(items, lspCompletionItem{Label: name, Kind: lspModuleItem, Detail: "native module"})
+		}
+		if manifest, _, err := helpers.FetchManifest(filepath.Dir(doc.path), filepath.Dir(doc.path)); err == nil {
+			for name, constraint := range manifest.ImportableDeps(true) {
+				items = append(items, lspCompletionItem{Label: name, Kind: lspModuleItem, Detail: "package " + constraint})
+			}
+		}
+		return sortCompletionItems(items)
+	}
+
+	specifier, isMember := "", false
+	if m := importMemberPattern.FindStringSubmatch(before); m != nil {
+		specifier, isMember = m[1], true
+	} else if m := memberAccessPattern.FindStringSubmatch(before); m != nil {
+		specifier, isMember = importBindings(doc.program)[m[1]], true
+	}
+	if isMember {
+		if specifier == "" {
+			return items
+		}
+		members, _ := s.moduleMembers(specifier, doc.path)
+		for _, member := range members {
+			items = append(items, lspCompletionItem{Label: member.Name, Kind: member.Kind, Detail: member.Detail})
+		}
+		return sortCompletionItems(items)
+	}
+
+	seen := map[string]bool{}
+	add := func(item lspCompletionItem) {
+		if !seen[item.Label] {
+			seen[item.Label] = true
+			items = append(items, item)
+		}
+	}
+
+	if doc.program != nil {
+		for _, decl := range topLevelDecls(doc.path, doc.text, doc.program) {
+			kind := lspFunctionItem
+			if decl.Class {
+				kind = lspClassItem
+			}
+			add(lspCompletionItem{Label: decl.Name, Kind: kind, Detail: decl.signature()})
+		}
+		helpers.WalkAST(doc.program, func(node ast.Stmt) bool {
+			if decl, ok := node.(*ast.VarDeclaration); ok {
+				add(lspCompletionItem{Label: decl.Identifier, Kind: lspVariableItem})
+			}
+			return true
+		})
+	}
+
+	xShared.XelRootEnv.Mutex.RLock()
+	for name, value := range xShared.XelRootEnv.Variables {
+		add(lspCompletionItem{Label: name, Kind: completionKind(value), Detail: shared.Stringify(value.Type)})
+	}
+	xShared.XelRootEnv.Mutex.RUnlock()
+
+	for keyword := range lexer.KEYWORDS {
+		add(lspCompletionItem{Label: keyword, Kind: lspKeywordItem})
+	}
+
+	return sortCompletionItems(items)
+}
+
+// hover describes the function, class or module under the cursor
+func (s *lspServer) hover(doc *lspDocument, pos lspPosition) any {
+	if specifier, found := importAt(doc.text, pos); found {
+		description := fmt.Sprintf("module `%s`", specifier)
+		if path, _, err := s.resolveImport(specifier, doc.path); err == nil {
+			description += fmt.Sprintf(" (%s)", path)
+		}
+		return lspMarkdown(description)
+	}
+
+	object, word := wordAt(doc.text, pos)
+	if word == "" || doc.program == nil {
+		return nil
+	}
+
+	if object == "" {
+		if decl := topLevelDecls(doc.path, doc.text, doc.program)[word]; decl != nil {
+			return lspMarkdown("```xel\n" + decl.signature() + "\n```")
+		}
+		if specifier := importBindings(doc.program)[word]; specifier != "" {
+			return lspMarkdown(fmt.Sprintf("module `%s`", specifier))
+		}
+		return nil
+	}
+
+	specifier := importBindings(doc.program)[object]
+	if specifier == "" {
+		return nil
+	}
+	members, _ := s.moduleMembers(specifier, doc.path)
+	for _, member := range members {
+		if member.Name != word {
+			continue
+		}
+		if member.Decl != nil && member.Kind != lspFieldItem {
+			return lspMarkdown("```xel\n" + member.Decl.signature() + "\n```")
+		}
+		return lspMarkdown(fmt.Sprintf("```xel\n%s.%s\n```\n%s", object, word, member.Detail))
+	}
+	return nil
+}
+
+// definition locates the declaration of the top-level function, class or module under the cursor
+func (s *lspServer) definition(doc *lspDocument, pos lspPosition) any {
+	if specifier, found := importAt(doc.text, pos); found {
+		if path, _, err := s.resolveImport(specifier, doc.path); err == nil {
+			return lspLocationOf(path, 1, 1)
+		}
+		return nil
+	}
+
+	object, word := wordAt(doc.text, pos)
+	if word == "" || doc.program == nil {
+		return nil
+	}
+
+	if object == "" {
+		if decl := topLevelDecls(doc.path, doc.text, doc.program)[word]; decl != nil {
+			return lspLocationOf(decl.File, decl.Line, decl.Col)
+		}
+		if specifier := importBindings(doc.program)[word]; specifier != "" {
+			if path, _, err := s.resolveImport(specifier, doc.path); err == nil {
+				return lspLocationOf(path, 1, 1)
+			}
+		}
+		return nil
+	}
+
+	specifier := importBindings(doc.program)[object]
+	if specifier == "" {
+		return nil
+	}
+	members, _ := s.moduleMembers(specifier, doc.path)
+	for _, member := range members {
+		if member.Name == word && member.Decl != nil {
+			return lspLocationOf(member.Decl.File, member.Decl.Line, member.Decl.Col)
+		}
+	}
+	return nil
+}
+
+// resolveImport resolves an import made from file, with the dependencies of the
+// project the file belongs to
+func (s *lspServer) resolveImport(specifier, file string) (string, *xShared.ProjectManifest, error) {
+	deps := map[string]string{}
+	dir := filepath.Dir(file)
+	if manifest, _, err := helpers.FetchManifest(dir, dir); err == nil {
+		deps = manifest.ImportableDeps(true)
+	}
+	return helpers.ResolveImport(specifier, file, deps)
+}
+
+// source returns the content of the file at path, as it is in the editor if it is open there
+func (s *lspServer) source(path string) (string, error) {
+	for _, doc := range s.documents {
+		if doc.path == path {
+			return doc.text, nil
+		}
+	}
+	content, err := os.ReadFile(path)
+	return string(content), err
+}
+
+// moduleMembers lists the members exported by the module imported with specifier.
+// Native modules are loaded to list their members, while modules written in Xel
+// export the members of the object they return at their top level.
+func (s *lspServer) moduleMembers(specifier, fromFile string) ([]lspMember, error) {
+	members := []lspMember{}
+
+	if loader, isNative := modules.GetNativeModuleLoader(specifier); isNative {
+		module, err := loader()
+		if err != nil {
+			return nil, err
+		}
+		exports, _ := module.Value.(map[string]*shared.RuntimeValue)
+		for name, value := range exports {
+			members = append(members, lspMember{Name: name, Kind: completionKind(value), Detail: shared.Stringify(value.Type)})
+		}
+		return members, nil
+	}
+
+	path, _, err := s.resolveImport(specifier, fromFile)
+	if err != nil {
+		return nil, err
+	}
+	text, err := s.source(path)
+	if err != nil {
+		return nil, err
+	}
+	program, err := parseSource(path, text)
+	if err != nil {
+		return nil, err
+	}
+
+	decls := topLevelDecls(path, text, program)
+	for _, stmt := range program.Stmts {
+		ret, ok := stmt.(*ast.ReturnStmt)
+		if !ok {
+			continue
+		}
+		exports, ok := ret.Value.(*ast.ObjectLiteral)
+		if !ok {
+			continue
+		}
+
+		for _, prop := range exports.Properties {
+			member := lspMember{Name: prop.Key, Kind: lspFieldItem, Detail: "field"}
+
+			// `{ name }` and `{ key: name }` export a top-level declaration
+			target := ""
+			if prop.Value == nil {
+				target = prop.Key
+			} else if id, ok := prop.Value.(*ast.Identifier); ok {
+				target = id.Symbol
+			}
+
+			if decl := decls[target]; decl != nil {
+				member.Decl = decl
+			} else if fn, ok := prop.Value.(*ast.FnDeclaration); ok {
+				member.Decl = &lspDecl{Name: prop.Key, Params: append([]string{}, fn.Params...), File: path, Line: fn.StartLine, Col: fn.StartColumn}
+			} else {
+				meta := ret.GetSourceMetadata()
+				if prop.Value != nil {
+					meta = prop.Value.GetSourceMetadata()
+				}
+				member.Decl = &lspDecl{Name: prop.Key, File: path, Line: meta.StartLine, Col: meta.StartColumn}
+			}
+
+			if member.Decl.Class {
+				member.Kind = lspClassItem
+				member.Detail = member.Decl.signature()
+			} else if member.Decl.Params != nil {
+				member.Kind = lspFunctionItem
+				member.Detail = member.Decl.signature()
+			}
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+// parseSource parses text, turning a panic of the parser into an error, as
+// editors routinely send code that is only half written
+func parseSource(path, text string) (program *ast.Program, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			program, err = nil, fmt.Errorf("Syntax Error: %v", r)
+		}
+	}()
+	return parser.New(path).ProduceAST(text)
+}
+
+// topLevelDecls returns the functions and classes declared at the top level of
+// program, including functions assigned to variables
+func topLevelDecls(path, text string, program *ast.Program) map[string]*lspDecl {
+	tokens, _ := lexer.Tokenize(text)
+	decls := map[string]*lspDecl{}
+
+	for _, stmt := range program.Stmts {
+		var decl *lspDecl
+		switch node := stmt.(type) {
+		case *ast.FnDeclaration:
+			if !node.Anonymous && node.Name != "" {
+				decl = &lspDecl{Name: node.Name, Params: node.Params}
+			}
+		case *ast.Class:
+			decl = &lspDecl{Name: node.Name, Class: true, Params: []string{}}
+			if node.Constructor != nil {
+				decl.Params = node.Constructor.Params
+			}
+		case *ast.VarDeclaration:
+			if fn, ok := node.Value.(*ast.FnDeclaration); ok {
+				decl = &lspDecl{Name: node.Identifier, Params: fn.Params}
+			}
+		}
+		if decl == nil {
+			continue
+		}
+		if decl.Params == nil {
+			decl.Params = []string{}
+		}
+
+		decl.File = path
+		decl.Line, decl.Col = namePosition(tokens, stmt.GetSourceMetadata(), decl.Name)
+		decls[decl.Name] = decl
+	}
+	return decls
+}
+
+// namePosition finds where name is first written in the node described by meta
+func namePosition(tokens []lexer.Token, meta ast.SourceMetadata, name string) (int, int) {
+	for _, tok := range tokens {
+		before := tok.StartLine < meta.StartLine || (tok.StartLine == meta.StartLine && tok.StartCol < meta.StartColumn)
+		if !before && tok.Type == lexer.Identifier && tok.Literal == name {
+			return tok.StartLine, tok.StartCol
+		}
+	}
+	return meta.StartLine, meta.StartColumn
+}
+
+// importBindings maps the variables that hold an imported module to its specifier
+func importBindings(program *ast.Program) map[string]string {
+	bindings := map[string]string{}
+	if program == nil {
+		return bindings
+	}
+
+	helpers.WalkAST(program, func(node ast.Stmt) bool {
+		decl, ok := node.(*ast.VarDeclaration)
+		if !ok {
+			return true
+		}
+		call, ok := decl.Value.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if callee, ok := call.Callee.(*ast.Identifier); ok && callee.Symbol == "import" && len(call.Args) == 1 {
+			if specifier, ok := call.Args[0].(*ast.StringLiteral); ok {
+				bindings[decl.Identifier] = specifier.Value
+			}
+		}
+		return true
+	})
+	return bindings
+}
+
+// linePrefix returns the text of the line at pos, up to pos
+func linePrefix(text string, pos lspPosition) string {
+	line := []rune(lineAt(text, pos.Line))
+	return string(line[:min(max(pos.Character, 0), len(line))])
+}
+
+func lineAt(text string, line int) string {
+	lines := strings.Split(text, "\n")
+	if line < 0 || line >= len(lines) {
+		return ""
+	}
+	return strings.TrimSuffix(lines[line], "\r")
+}
+
+// wordAt returns the identifier under pos, along with the object it is accessed on, if any
+func wordAt(text string, pos lspPosition) (string, string) {
+	line := []rune(lineAt(text, pos.Line))
+	isWordChar := func(r rune) bool {
+		return r == '_' || r == '$' || lexer.IsAlphaNumeric(r)
+	}
+
+	start := min(max(pos.Character, 0), len(line))
+	end := start
+	for start > 0 && isWordChar(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isWordChar(line[end]) {
+		end++
+	}
+	word := string(line[start:end])
+
+	object := ""
+	if m := memberAccessPattern.FindStringSubmatch(string(line[:start])); m != nil && m[2] == "" {
+		object = m[1]
+	}
+	return object, word
+}
+
+// importAt returns the specifier of the `import("...")` call under pos
+func importAt(text string, pos lspPosition) (string, bool) {
+	line := lineAt(text, pos.Line)
+	runeOffset := 0
+	for byteOffset := range line {
+		if runeOffset == pos.Character {
+			pos.Character = byteOffset
+			break
+		}
+		runeOffset++
+	}
+
+	for _, m := range importCallPattern.FindAllStringSubmatchIndex(line, -1) {
+		if pos.Character >= m[0] && pos.Character < m[1] {
+			return line[m[2]:m[3]], true
+		}
+	}
+	return "", false
+}
+
+// errorRange returns the range of the source that a parse error is about
+func errorRange(err error) lspRange {
+	var start, end errors.Position
+	switch e := err.(type) {
+	case *errors.SyntaxError:
+		start, end = e.Start, e.End
+	case *errors.ParserError:
+		start, end = e.Start, e.End
+	case *errors.LexerError:
+		start, end = e.Pos, e.Pos
+	default:
+		start, end = errors.Position{Line: 1, Col: 1}, errors.Position{Line: 1, Col: 1}
+	}
+
+	r := lspRange{
+		Start: lspPosition{Line: max(start.Line-1, 0), Character: max(start.Col-1, 0)},
+		End:   lspPosition{Line: max(end.Line-1, 0), Character: max(end.Col-1, 0)},
+	}
+	// Make sure the range covers at least one character, to be visible
+	if r.End.Line < r.Start.Line || (r.End.Line == r.Start.Line && r.End.Character <= r.Start.Character) {
+		r.End = lspPosition{Line: r.Start.Line, Character: r.Start.Character + 1}
+	}
+	return r
+}
+
+func completionKind(value *shared.RuntimeValue) int {
+	switch value.Type {
+	case shared.Function, shared.NativeFN:
+		return lspFunctionItem
+	case shared.Class:
+		return lspClassItem
+	case shared.Object:
+		return lspModuleItem
+	default:
+		return lspVariableItem
+	}
+}
+
+func sortCompletionItems(items []lspCompletionItem) []lspCompletionItem {
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items
+}
+
+func lspMarkdown(value string) map[string]any {
+	return map[string]any{"contents": map[string]any{"kind": "markdown", "value": value}}
+}
+
+// lspLocationOf returns the location of a 1-based line and column in the file at path
+func lspLocationOf(path string, line, col int) lspLocation {
+	start := lspPosition{Line: max(line-1, 0), Character: max(col-1, 0)}
+	return lspLocation{URI: pathToURI(path), Range: lspRange{Start: start, End: start}}
+}
+
+func uriToPath(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(parsed.Path)
+}
+
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
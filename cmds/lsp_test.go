@@ -0,0 +1,267 @@
+package cmds
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dev-kas/xel/helpers"
+
+	_ "github.com/dev-kas/xel/modules/strings"
+
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+const lspTestScript = `const strings = import("xel:strings")
+
+fn greet(name, greeting) {
+  return greeting + name
+}
+
+class Point {
+  public constructor(x, y) {}
+}
+
+greet("xel", "hi ")
+let p = Point(1, 2)
+`
+
+// lspMessage is any message the server sends
+type lspMessage struct {
+	ID     int             `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// lspClient drives `xel lsp` over its stdin and stdout
+type lspClient struct {
+	t        *testing.T
+	stdin    *os.File
+	messages chan lspMessage
+	id       int
+}
+
+// startLSP runs `xel lsp` with stdin and stdout replaced by pipes
+func startLSP(t *testing.T) *lspClient {
+	t.Helper()
+
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, stdout, colorOutput := os.Stdin, os.Stdout, color.Output
+	os.Stdin, os.Stdout = stdinReader, stdoutWriter
+
+	done := make(chan error, 1)
+	go func() {
+		app := &cli.App{Name: "xel", Commands: []*cli.Command{LSPCommand()}}
+		done <- app.Run([]string{"xel", "lsp"})
+	}()
+
+	client := &lspClient{t: t, stdin: stdinWriter, messages: make(chan lspMessage, 64)}
+	go func() {
+		defer close(client.messages)
+		reader := bufio.NewReader(stdoutReader)
+		for {
+			content, err := helpers.ReadProtocolMessage(reader)
+			if err != nil {
+				return
+			}
+			var message lspMessage
+			if json.Unmarshal(content, &message) == nil {
+				client.messages <- message
+			}
+		}
+	}()
+
+	t.Cleanup(func() {
+		stdinWriter.Close()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("xel lsp failed: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("xel lsp did not return after the client left")
+		}
+		os.Stdin, os.Stdout, color.Output = stdin, stdout, colorOutput
+		stdoutWriter.Close()
+		stdoutReader.Close()
+		stdinReader.Close()
+	})
+	return client
+}
+
+// send writes a message of the protocol to the server
+func (c *lspClient) send(message map[string]any) {
+	c.t.Helper()
+	message["jsonrpc"] = "2.0"
+	if err := helpers.WriteProtocolMessage(c.stdin, message); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// request sends a request and returns the result of its response, which must succeed
+func (c *lspClient) request(method string, params any) json.RawMessage {
+	c.t.Helper()
+	c.id++
+	c.send(map[string]any{"id": c.id, "method": method, "params": params})
+
+	response := c.expect(func(m lspMessage) bool { return m.Method == "" && m.ID == c.id })
+	if response.Error != nil {
+		c.t.Fatalf("%s failed: %s", method, response.Error.Message)
+	}
+	return response.Result
+}
+
+// notify sends a notification, which gets no response
+func (c *lspClient) notify(method string, params any) {
+	c.t.Helper()
+	c.send(map[string]any{"method": method, "params": params})
+}
+
+// expect waits for the next message that matches
+func (c *lspClient) expect(matches func(lspMessage) bool) lspMessage {
+	c.t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case message, ok := <-c.messages:
+			if !ok {
+				c.t.Fatal("the server stopped before sending the expected message")
+			}
+			if matches(message) {
+				return message
+			}
+		case <-timeout:
+			c.t.Fatal("timed out waiting for a message of the server")
+		}
+	}
+}
+
+// diagnostics waits for the diagnostics of uri, and returns their messages
+func (c *lspClient) diagnostics(uri string) []string {
+	c.t.Helper()
+	var params struct {
+		URI         string `json:"uri"`
+		Diagnostics []struct {
+			Message string `json:"message"`
+		} `json:"diagnostics"`
+	}
+	c.expect(func(m lspMessage) bool {
+		return m.Method == "textDocument/publishDiagnostics" && json.Unmarshal(m.Params, &params) == nil && params.URI == uri
+	})
+	messages := []string{}
+	for _, d := range params.Diagnostics {
+		messages = append(messages, d.Message)
+	}
+	return messages
+}
+
+// position returns the parameters of a request about line and character of uri
+func position(uri string, line, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": line, "character": character},
+	}
+}
+
+func TestLSPSession(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.xel")
+	uri := pathToURI(path)
+
+	c := startLSP(t)
+	var initialized struct {
+		Capabilities map[string]any `json:"capabilities"`
+	}
+	json.Unmarshal(c.request("initialize", map[string]any{"rootUri": pathToURI(dir)}), &initialized)
+	for _, capability := range []string{"hoverProvider", "definitionProvider", "completionProvider"} {
+		if initialized.Capabilities[capability] == nil {
+			t.Errorf("initialize does not announce %s", capability)
+		}
+	}
+	c.notify("initialized", map[string]any{})
+
+	// Syntax errors are reported when a document is opened or changed
+	c.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "languageId": "xel", "version": 1, "text": "let x = (1 +\n"},
+	})
+	if diagnostics := c.diagnostics(uri); len(diagnostics) != 1 || !strings.Contains(diagnostics[0], "Error") {
+		t.Errorf("diagnostics = %q, want a syntax error", diagnostics)
+	}
+	change := func(version int, text string) {
+		t.Helper()
+		c.notify("textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": uri, "version": version},
+			"contentChanges": []map[string]any{{"text": text}},
+		})
+	}
+	change(2, lspTestScript)
+	if diagnostics := c.diagnostics(uri); len(diagnostics) != 0 {
+		t.Errorf("diagnostics = %q, want none", diagnostics)
+	}
+
+	// Hovering a call shows the parameters of the function
+	var hover struct {
+		Contents struct {
+			Value string `json:"value"`
+		} `json:"contents"`
+	}
+	json.Unmarshal(c.request("textDocument/hover", position(uri, 10, 2)), &hover)
+	if !strings.Contains(hover.Contents.Value, "fn greet(name, greeting)") {
+		t.Errorf("hover on greet = %q, want its parameters", hover.Contents.Value)
+	}
+
+	// Definitions of top-level functions and classes point at their names
+	definition := func(line, character int) lspLocation {
+		t.Helper()
+		var location lspLocation
+		json.Unmarshal(c.request("textDocument/definition", position(uri, line, character)), &location)
+		return location
+	}
+	if location := definition(10, 2); location.URI != uri || location.Range.Start != (lspPosition{Line: 2, Character: 3}) {
+		t.Errorf("definition of greet = %+v, want line 2, character 3", location)
+	}
+	if location := definition(11, 9); location.URI != uri || location.Range.Start != (lspPosition{Line: 6, Character: 6}) {
+		t.Errorf("definition of Point = %+v, want line 6, character 6", location)
+	}
+
+	// Members of a module are completed after its import, even while the line does not parse
+	completed := func(line string) []string {
+		t.Helper()
+		text := lspTestScript + line
+		change(3, text)
+		c.diagnostics(uri)
+
+		var items []lspCompletionItem
+		json.Unmarshal(c.request("textDocument/completion", position(uri, strings.Count(text, "\n"), len(line))), &items)
+		labels := []string{}
+		for _, item := range items {
+			labels = append(labels, item.Label)
+		}
+		return labels
+	}
+	for _, line := range []string{`let s = import("xel:strings").`, "strings."} {
+		if labels := completed(line); !slices.Contains(labels, "upper") || slices.Contains(labels, "greet") {
+			t.Errorf("completion after %s = %v, want the members of xel:strings", line, labels)
+		}
+	}
+
+	c.request("shutdown", nil)
+	c.notify("exit", nil)
+}
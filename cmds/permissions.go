@@ -0,0 +1,162 @@
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/urfave/cli/v2"
+)
+
+// permissionFlag is the value of an --allow-* flag. Given on its own, the flag
+// grants the whole permission, while `--allow-read=./data,/tmp` grants it only
+// for the listed entries. The flag can be repeated.
+type permissionFlag struct {
+	set     bool
+	all     bool
+	bare    bool // Given without a value
+	entries []string
+}
+
+func (f *permissionFlag) Set(value string) error {
+	f.set = true
+	if value == "true" {
+		f.all = true
+		f.bare = true
+		return nil
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			f.entries = append(f.entries, entry)
+		}
+	}
+	return nil
+}
+
+func (f *permissionFlag) String() string {
+	if f == nil || f.all {
+		return ""
+	}
+	return strings.Join(f.entries, ",")
+}
+
+// IsBoolFlag allows the flag to be given without a value
+func (f *permissionFlag) IsBoolFlag() bool {
+	return true
+}
+
+// permissionFlags returns the flags that configure the sandbox of a command
+func permissionFlags() []cli.Flag {
+	flags := []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "sandbox",
+			Usage: "Run sandboxed with only the permissions granted by --allow-* flags, ignoring the permissions of xel.json",
+		},
+	}
+
+	usages := map[xShared.Permission]string{
+		xShared.ReadPermission:  "Allow reading files, optionally only under the given comma-separated `PATHS`",
+		xShared.WritePermission: "Allow writing files, optionally only under the given comma-separated `PATHS`",
+		xShared.ExecPermission:  "Allow running programs, optionally only the given comma-separated `PROGRAMS`",
+		xShared.FFIPermission:   "Allow loading native libraries, optionally only under the given comma-separated `PATHS`",
+		xShared.NetPermission:   "Allow network access, optionally only to the given comma-separated `HOSTS`",
+	}
+
+	for _, perm := range xShared.AllPermissions {
+		flags = append(flags, &cli.GenericFlag{
+			Name:  "allow-" + string(perm),
+			Usage: usages[perm],
+			Value: &permissionFlag{},
+		})
+	}
+
+	return flags
+}
+
+// checkPermissionValues rejects an --allow-* flag given without `=` and followed
+// by its entries, as in `--allow-read ./data`. Such a flag grants the whole
+// permission, and its entries become the first argument of the command, so
+// they are caught when that argument is not what expected says the command takes.
+func checkPermissionValues(c *cli.Context, expected func(arg string) bool) error {
+	if c.NArg() == 0 || expected(c.Args().First()) {
+		return nil
+	}
+	for _, perm := range xShared.AllPermissions {
+		if flag, ok := c.Generic("allow-" + string(perm)).(*permissionFlag); ok && flag.bare {
+			return fmt.Errorf("--allow-%s takes its entries after `=`, as in --allow-%[1]s=%s", perm, c.Args().First())
+		}
+	}
+	return nil
+}
+
+// applyPermissions configures the sandbox from the command's flags and the
+// `permissions` block of the manifest at manifestPath, if any. The sandbox is
+// enabled by --sandbox, by any --allow-* flag, or by the permissions block.
+func applyPermissions(c *cli.Context, manifest *xShared.ProjectManifest, manifestPath string) error {
+	perms := xShared.XelPermissions
+
+	// With --sandbox, only the command line decides what is granted
+	if c.Bool("sandbox") {
+		perms.Sandboxed = true
+	} else if manifest.Permissions != nil {
+		if err := applyManifestPermissions(manifest, filepath.Dir(manifestPath)); err != nil {
+			return err
+		}
+	}
+
+	for _, perm := range xShared.AllPermissions {
+		flag, ok := c.Generic("allow-" + string(perm)).(*permissionFlag)
+		if !ok || !flag.set {
+			continue
+		}
+		perms.Sandboxed = true
+		grantPermission(perm, flag.all, flag.entries, "")
+	}
+
+	return nil
+}
+
+// applyManifestPermissions enables the sandbox and grants the permissions listed
+// in the manifest, resolving relative paths against baseDir
+func applyManifestPermissions(manifest *xShared.ProjectManifest, baseDir string) error {
+	xShared.XelPermissions.Sandboxed = true
+	for name, grant := range manifest.Permissions {
+		perm, ok := xShared.ParsePermission(name)
+		if !ok {
+			return fmt.Errorf("unknown permission %q in xel.json", name)
+		}
+		if grant == nil {
+			continue
+		}
+		grantPermission(perm, grant.All, grant.Entries, baseDir)
+	}
+	return nil
+}
+
+// grantPermission grants perm, resolving relative path entries against baseDir,
+// or against the working directory when baseDir is empty
+func grantPermission(perm xShared.Permission, all bool, entries []string, baseDir string) {
+	if all {
+		xShared.XelPermissions.GrantAll(perm)
+		return
+	}
+
+	resolved := make([]string, len(entries))
+	for i, entry := range entries {
+		resolved[i] = entry
+		isPath := perm.IsPathScoped() || (perm == xShared.ExecPermission && strings.ContainsRune(entry, os.PathSeparator))
+		if isPath && !filepath.IsAbs(entry) {
+			if baseDir != "" {
+				resolved[i] = filepath.Join(baseDir, entry)
+			} else if abs, err := filepath.Abs(entry); err == nil {
+				resolved[i] = abs
+			}
+		}
+	}
+
+	xShared.XelPermissions.Grant(perm, resolved...)
+}
@@ -0,0 +1,29 @@
+package cmds
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestPermissionFlagValues(t *testing.T) {
+	cases := []struct {
+		args []string
+		want string // Part of the error, if any
+	}{
+		{[]string{"xel", "run", "--allow-read", "./data", "main.xel"}, "--allow-read takes its entries after `=`, as in --allow-read=./data"},
+		{[]string{"xel", "run", "--allow-net", "example.com", "main.xel"}, "--allow-net takes its entries after `=`"},
+		{[]string{"xel", "run", "--allow-read=./data", "missing.xel"}, "file missing.xel does not exist"},
+		{[]string{"xel", "run", "--allow-read", "missing.xel"}, "file missing.xel does not exist"},
+	}
+	for _, c := range cases {
+		t.Run(strings.Join(c.args[2:], " "), func(t *testing.T) {
+			app := &cli.App{Name: "xel", Commands: []*cli.Command{RunCommand()}}
+			err := app.Run(c.args)
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("got %v, want an error containing %q", err, c.want)
+			}
+		})
+	}
+}
@@ -2,16 +2,19 @@ package cmds
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/dev-kas/xel/helpers"
 
 	"github.com/dev-kas/xel/shared"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/urfave/cli/v2"
 )
 
@@ -25,7 +28,36 @@ func PackageCommands() *cli.Command {
 				Name:    "add",
 				Aliases: []string{"install"},
 				Usage:   "Add a package",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "frozen",
+						Usage: "Installs exactly the packages of xel.lock, and fails if it does not match xel.json",
+						Value: false,
+					},
+					&cli.BoolFlag{
+						Name:  "dev",
+						Usage: "Adds the packages to devDeps, which are only installed for this project",
+						Value: false,
+					},
+					&cli.BoolFlag{
+						Name:  "optional",
+						Usage: "Adds the packages to optionalDeps, which are skipped when they fail to install",
+						Value: false,
+					},
+					offlineFlag(),
+				},
 				Action: func(c *cli.Context) error {
+					useOffline(c)
+
+					kind := "deps"
+					if c.Bool("dev") && c.Bool("optional") {
+						return fmt.Errorf("cannot specify both dev and optional")
+					} else if c.Bool("dev") {
+						kind = "devDeps"
+					} else if c.Bool("optional") {
+						kind = "optionalDeps"
+					}
+
 					// Get current working directory
 					cwd, err := os.Getwd()
 					if err != nil {
@@ -40,149 +72,122 @@ func PackageCommands() *cli.Command {
 						}
 					}
 
-					// Lockfile integration
-					lockfilePath := ""
-					if mainManifest != nil {
-						lockfilePath = filepath.Join(filepath.Dir(mainManifestPath), "xel.lock")
-					}
-					lockfileData := []byte("{}")
-					if lockfilePath != "" {
-						data, err := os.ReadFile(lockfilePath)
-						if err != nil {
-							if !os.IsNotExist(err) {
-								return err
-							} else {
-								lockfileData = []byte("{}")
-							}
-						} else {
-							lockfileData = data
+					// A frozen install reproduces xel.lock, and never resolves anything
+					if c.Bool("frozen") {
+						if c.Args().Len() != 0 {
+							return fmt.Errorf("--frozen installs the packages of xel.lock, and takes no package names")
+						}
+						if mainManifest == nil {
+							return fmt.Errorf("--frozen needs a project, but no xel.json was found")
 						}
-					}
-					var lockfile shared.Lockfile
-					if err := json.Unmarshal(lockfileData, &lockfile); err != nil {
-						return err
-					}
-
-					err = func() error {
-						for i := 0; i < c.Args().Len(); i++ {
-							// Validate package name
-							packageName := c.Args().Get(i)
-							if packageName == "" {
-								return fmt.Errorf("package name is required")
-							}
-
-							// Split package name and version if provided
-							split := strings.Split(packageName, "@")
-							if len(split) > 2 {
-								return fmt.Errorf("invalid package format: %s", packageName)
-							}
-
-							var name, version string
-							switch len(split) {
-							case 0:
-								return fmt.Errorf("invalid package format: %s", packageName)
-							case 1:
-								name = strings.Join(split, "@")
-								version = "*"
-								if mainManifest != nil && mainManifest.Deps != nil {
-									if ver, ok := (*mainManifest.Deps)[name]; ok {
-										version = ver
-									}
-								}
 
-							default:
-								name = strings.Join(split[:len(split)-1], "@")
-								version = split[len(split)-1]
-							}
+						lockfilePath := filepath.Join(filepath.Dir(mainManifestPath), "xel.lock")
+						if _, err := os.Stat(lockfilePath); os.IsNotExist(err) {
+							return fmt.Errorf("--frozen needs xel.lock, but none was found next to %s", mainManifestPath)
+						}
+						lockfile, err := shared.ReadLockfile(lockfilePath)
+						if err != nil {
+							return err
+						}
 
-							// Validate name
-							if len(strings.TrimSpace(name)) == 0 {
-								return fmt.Errorf("package name is required")
-							}
+						if err := helpers.CheckLockfile(mainManifest, lockfile); err != nil {
+							return err
+						}
+						if err := helpers.InstallLocked(lockfile); err != nil {
+							return err
+						}
 
-							// Check if an installed package satisfies the requirements
-							versions := helpers.GetVersions(name)
+						shared.ColorPalette.Info.Printf("Installed %d package(s) from xel.lock\n", len(lockfile.Packages))
+						return nil
+					}
 
-							if len(versions) != 0 && len(version) != 0 && version != "latest" {
-								_, manifest, err := helpers.ResolveModuleLocal(name, version)
-								if err != nil {
-									return err
-								}
+					// Without a project, only the given packages are installed, and nothing is recorded
+					project := &shared.ProjectManifest{Name: "xel"}
+					if mainManifest != nil {
+						project = mainManifest
+					} else if kind != "deps" {
+						return fmt.Errorf("--dev and --optional need a project, but no xel.json was found")
+					}
+					existing := project.InstalledDeps(true)
+					requested := map[string]string{}
+					unpinned := []string{}
 
-								shared.ColorPalette.Warning.Printf("Package `%s@%s` already installed\n", name, manifest.Version)
-
-								if mainManifest != nil {
-									if mainManifest.Deps == nil {
-										mainManifest.Deps = &map[string]string{}
-									}
-									(*mainManifest.Deps)[manifest.Name] = manifest.Version
-									manifestData, err := json.MarshalIndent(mainManifest, "", "  ")
-									if err != nil {
-										return err
-									}
-									if err := os.WriteFile(mainManifestPath, manifestData, 0644); err != nil {
-										return err
-									}
-								}
-								return nil
-							}
+					for i := 0; i < c.Args().Len(); i++ {
+						name, spec, err := parsePackageArg(c.Args().Get(i))
+						if err != nil {
+							return err
+						}
 
-							// download the package
-							manifestPath, manifest, err := helpers.DownloadModule(name, version, &lockfile)
+						if gitURL, constraint := helpers.ParseDependency(spec); gitURL != "" {
+							// The name of the package is only known from its manifest
+							_, manifest, err := helpers.DownloadModuleGit(gitURL, constraint)
 							if err != nil {
-								return err
+								return fmt.Errorf("failed to install %s: %v", gitURL, err)
 							}
-
-							if mainManifest != nil {
-								if mainManifest.Deps == nil {
-									mainManifest.Deps = &map[string]string{}
-								}
-								(*mainManifest.Deps)[manifest.Name] = manifest.Version
-								manifestData, err := json.MarshalIndent(mainManifest, "", "  ")
-								if err != nil {
-									return err
-								}
-								if err := os.WriteFile(mainManifestPath, manifestData, 0644); err != nil {
-									return err
-								}
+							name = manifest.Name
+							if !strings.Contains(spec, "#") {
+								spec = fmt.Sprintf("git+%s#^%s", gitURL, manifest.Version)
 							}
-							for depName, depVersion := range *manifest.Deps {
-								exePath, err := os.Executable()
-								if err != nil {
-									return err
-								}
-								xelPath, err := filepath.EvalSymlinks(exePath)
-								if err != nil {
-									return err
-								}
-
-								cmd := exec.Command(xelPath, "pkg", "add", fmt.Sprintf("%s@%s", depName, depVersion))
-								cmd.Stderr = os.Stderr
-								cmd.Stdout = os.Stdout
-								cmd.Dir = filepath.Dir(manifestPath)
-								if err := cmd.Run(); err != nil {
-									return err
-								}
+						} else if spec == "" {
+							// Keep the constraint of a dependency the project has already
+							if constraint, ok := existing[name]; ok {
+								spec = constraint
+							} else {
+								spec = "*"
+								unpinned = append(unpinned, name)
 							}
+						}
+
+						setDependency(project, kind, name, spec)
+						requested[name] = spec
+					}
 
-							shared.ColorPalette.Info.Printf("Package `%s@%s` installed\n", name, manifest.Version)
+					// Lockfile integration
+					var lockfile *shared.Lockfile
+					lockfilePath := ""
+					if mainManifest != nil {
+						lockfilePath = filepath.Join(filepath.Dir(mainManifestPath), "xel.lock")
+						lockfile, err = shared.ReadLockfile(lockfilePath)
+						if err != nil {
+							return err
 						}
-						return nil
-					}()
+					}
+
+					resolver := &helpers.Resolver{Name: project.Name, Lockfile: lockfile}
+					resolved, err := resolver.Resolve(project)
 					if err != nil {
 						return err
 					}
 
-					// update lockfile
-					if lockfilePath != "" {
-						lockfileData, err = json.MarshalIndent(lockfile, "", "  ")
+					// New dependencies accept the compatible updates of the version they were installed at
+					for _, name := range unpinned {
+						if version, installed := resolved.Deps[name]; installed {
+							setDependency(project, kind, name, "^"+version)
+						}
+					}
+
+					if mainManifest != nil {
+						manifestData, err := json.MarshalIndent(mainManifest, "", "  ")
 						if err != nil {
 							return err
 						}
-						if err := os.WriteFile(lockfilePath, lockfileData, 0644); err != nil {
+						if err := os.WriteFile(mainManifestPath, manifestData, 0644); err != nil {
+							return err
+						}
+
+						// update lockfile
+						if err := resolved.Write(lockfilePath); err != nil {
 							return err
 						}
 					}
+
+					for name := range requested {
+						if version, installed := resolved.Deps[name]; installed {
+							shared.ColorPalette.Info.Printf("Package `%s@%s` installed\n", name, version)
+						} else {
+							shared.ColorPalette.Warning.Printf("Package `%s` was not installed\n", name)
+						}
+					}
 					return nil
 				},
 			},
@@ -247,7 +252,7 @@ func PackageCommands() *cli.Command {
 
 						var ok bool
 						if mainManifest != nil {
-							_, ok = (*mainManifest.Deps)[name]
+							_, ok = mainManifest.InstalledDeps(true)[name]
 						}
 						if !ok {
 							removalMode = "global"
@@ -258,10 +263,10 @@ func PackageCommands() *cli.Command {
 							removalMode = "local"
 						}
 
-						if mainManifest.Deps == nil {
+						if mainManifest == nil {
 							removalMode = "global"
 						} else {
-							if _, ok := (*mainManifest.Deps)[name]; !ok {
+							if _, ok := mainManifest.InstalledDeps(true)[name]; !ok {
 								removalMode = "global"
 							} else {
 								removalMode = "local"
@@ -280,7 +285,7 @@ func PackageCommands() *cli.Command {
 						}
 
 						if removalMode == "local" {
-							delete(*mainManifest.Deps, name)
+							removeDependency(mainManifest, name)
 							manifestData, err := json.MarshalIndent(mainManifest, "", "  ")
 							if err != nil {
 								return err
@@ -290,22 +295,13 @@ func PackageCommands() *cli.Command {
 							}
 
 							lfPath := filepath.Join(filepath.Dir(mainManifestPath), "xel.lock")
-							lfData, err := os.ReadFile(lfPath)
+							lockfile, err := shared.ReadLockfile(lfPath)
 							if err != nil {
-								if !os.IsNotExist(err) {
-									return err
-								}
-							}
-							var lockfile shared.Lockfile
-							if err := json.Unmarshal(lfData, &lockfile); err != nil {
 								return err
 							}
-							delete(lockfile, name)
-							lfData, err = json.MarshalIndent(lockfile, "", "  ")
-							if err != nil {
-								return err
-							}
-							if err := os.WriteFile(lfPath, lfData, 0644); err != nil {
+							delete(lockfile.Deps, name)
+							lockfile.Prune()
+							if err := lockfile.Write(lfPath); err != nil {
 								return err
 							}
 						} else {
@@ -315,12 +311,468 @@ func PackageCommands() *cli.Command {
 							if err := os.RemoveAll(filepath.Dir(manifestPath)); err != nil {
 								return err
 							}
+							helpers.InvalidateVersionsCache(name)
+						}
+					}
+
+					return nil
+				},
+			},
+			{
+				Name:  "outdated",
+				Usage: "List the dependencies that have newer versions",
+				Flags: []cli.Flag{
+					offlineFlag(),
+				},
+				Action: func(c *cli.Context) error {
+					useOffline(c)
+
+					mainManifest, _, lockfile, _, err := openProject()
+					if err != nil {
+						return err
+					}
+
+					deps := mainManifest.InstalledDeps(true)
+					if len(deps) == 0 {
+						shared.ColorPalette.Info.Println("No packages installed")
+						return nil
+					}
+
+					names := make([]string, 0, len(deps))
+					for name := range deps {
+						names = append(names, name)
+					}
+					sort.Strings(names)
+
+					resolver := &helpers.Resolver{Name: mainManifest.Name}
+					rows := [][]string{{"Package", "Current", "Wanted", "Latest"}}
+					outdated := []bool{false}
+					for _, name := range names {
+						current, wanted, latest, err := dependencyVersions(resolver, lockfile, name, deps[name])
+						if err != nil {
+							return err
+						}
+						rows = append(rows, []string{name, current, wanted, latest})
+						outdated = append(outdated, current != latest)
+					}
+
+					printTable(rows, outdated)
+					upToDate := true
+					for _, isOutdated := range outdated {
+						upToDate = upToDate && !isOutdated
+					}
+					if upToDate {
+						shared.ColorPalette.Info.Println("All packages are up to date")
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "update",
+				Usage:     "Update packages to the newest version their constraint allows",
+				ArgsUsage: "[names...]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "latest",
+						Usage: "Updates to the latest version, and changes the constraints in xel.json to allow it",
+						Value: false,
+					},
+					offlineFlag(),
+				},
+				Action: func(c *cli.Context) error {
+					useOffline(c)
+
+					mainManifest, mainManifestPath, lockfile, lockfilePath, err := openProject()
+					if err != nil {
+						return err
+					}
+
+					deps := mainManifest.InstalledDeps(true)
+
+					// Without names, every dependency is updated
+					names := c.Args().Slice()
+					if len(names) == 0 {
+						for name := range deps {
+							names = append(names, name)
+						}
+					}
+					sort.Strings(names)
+
+					resolver := &helpers.Resolver{Name: mainManifest.Name}
+					previous := map[string]string{}
+					for _, name := range names {
+						spec, ok := deps[name]
+						if !ok {
+							return fmt.Errorf("package `%s` is not a dependency of %s", name, mainManifest.Name)
+						}
+						previous[name] = lockfile.Deps[name]
+
+						if c.Bool("latest") {
+							versions, err := resolver.Versions(name, spec)
+							if err != nil {
+								return err
+							}
+							latest := latestVersion(versions)
+							if latest == nil {
+								return fmt.Errorf("package `%s` has no version that can be installed", name)
+							}
+							if gitURL, _ := helpers.ParseDependency(spec); gitURL != "" {
+								spec = fmt.Sprintf("git+%s#^%s", gitURL, latest)
+							} else {
+								spec = "^" + latest.String()
+							}
+							setDependency(mainManifest, dependencyKind(mainManifest, name), name, spec)
+						}
+
+						// Forget the locked versions of the package, and of the packages only it depended on
+						delete(lockfile.Deps, name)
+					}
+					lockfile.Prune()
+
+					resolver.Lockfile = lockfile
+					resolved, err := resolver.Resolve(mainManifest)
+					if err != nil {
+						return err
+					}
+
+					manifestData, err := json.MarshalIndent(mainManifest, "", "  ")
+					if err != nil {
+						return err
+					}
+					if err := os.WriteFile(mainManifestPath, manifestData, 0644); err != nil {
+						return err
+					}
+					if err := resolved.Write(lockfilePath); err != nil {
+						return err
+					}
+
+					for _, name := range names {
+						if previous[name] == resolved.Deps[name] {
+							shared.ColorPalette.Info.Printf("Package `%s@%s` is up to date\n", name, resolved.Deps[name])
+						} else if previous[name] == "" {
+							shared.ColorPalette.Info.Printf("Package `%s@%s` installed\n", name, resolved.Deps[name])
+						} else {
+							shared.ColorPalette.Info.Printf("Package `%s` updated from %s to %s\n", name, previous[name], resolved.Deps[name])
+						}
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "mirror",
+				Usage:     "Copy the packages of xel.lock into a directory usable as a file:// registry",
+				ArgsUsage: "<dir>",
+				Flags: []cli.Flag{
+					offlineFlag(),
+				},
+				Action: func(c *cli.Context) error {
+					useOffline(c)
+
+					if c.Args().Len() != 1 {
+						return fmt.Errorf("expected the directory to mirror into")
+					}
+					dir, err := filepath.Abs(c.Args().First())
+					if err != nil {
+						return err
+					}
+
+					mainManifest, _, lockfile, _, err := openProject()
+					if err != nil {
+						return err
+					}
+
+					// The mirror holds what xel.lock records, so it must be up to date
+					if err := helpers.CheckLockfile(mainManifest, lockfile); err != nil {
+						return err
+					}
+					if err := helpers.InstallLocked(lockfile); err != nil {
+						return err
+					}
+					if err := helpers.MirrorLockfile(dir, lockfile); err != nil {
+						return err
+					}
+
+					shared.ColorPalette.Info.Printf("Mirrored %d package(s) into %s\n", len(lockfile.Packages), dir)
+					shared.ColorPalette.Info.Printf("Set PackageRegistryURI to %s and use --offline to install from it\n", (&url.URL{Scheme: "file", Path: filepath.ToSlash(dir) + "/"}).String())
+					return nil
+				},
+			},
+			{
+				Name:  "pack",
+				Usage: "Validate the package and build its tarball",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Path of the tarball, `<name>-<version>.tar.gz` next to xel.json by default",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					pkg, manifestPath, err := packProject()
+					if err != nil {
+						return err
+					}
+
+					output := c.String("output")
+					if output == "" {
+						output = filepath.Join(filepath.Dir(manifestPath), pkg.TarballName())
+					}
+					if err := os.WriteFile(output, pkg.Tarball, 0644); err != nil {
+						return err
+					}
+
+					shared.ColorPalette.Info.Printf("Wrote %s\n", output)
+					return nil
+				},
+			},
+			{
+				Name:  "publish",
+				Usage: "Publish the package to the registry",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "token",
+						Usage:   "Token to authenticate with, instead of XEL_REGISTRY_TOKEN or RegistryToken in the config",
+						EnvVars: []string{"XEL_REGISTRY_TOKEN"},
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if err := helpers.CheckPublishRegistry(); err != nil {
+						return err
+					}
+
+					token := c.String("token")
+					if token == "" {
+						token = shared.XelConfig.RegistryToken
+					}
+					if token == "" {
+						return fmt.Errorf("publishing needs a registry token: pass --token, set XEL_REGISTRY_TOKEN, or set RegistryToken in %s", filepath.Join(shared.XelDir(), "config.json"))
+					}
+
+					pkg, _, err := packProject()
+					if err != nil {
+						return err
+					}
+
+					if err := helpers.PublishPackage(pkg, token); err != nil {
+						return fmt.Errorf("failed to publish `%s@%s`: %v", pkg.Manifest.Name, pkg.Manifest.Version, err)
+					}
+
+					shared.ColorPalette.Info.Printf("Published `%s@%s` to %s\n", pkg.Manifest.Name, pkg.Manifest.Version, shared.XelConfig.PackageRegistryURI)
+					return nil
+				},
+			},
+			{
+				Name:  "tree",
+				Usage: "Print the tree of installed dependencies",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Prints the tree as JSON",
+						Value: false,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					mainManifest, _, lockfile, _, err := openProject()
+					if err != nil {
+						return err
+					}
+
+					tree := helpers.DependencyTree(mainManifest, lockfile)
+					if c.Bool("json") {
+						data, err := json.MarshalIndent(tree, "", "  ")
+						if err != nil {
+							return err
 						}
+						fmt.Println(string(data))
+					} else {
+						shared.ColorPalette.Info.Println(dependencyLabel(tree))
+						printDependencyTree(tree.Deps, "")
 					}
 
+					if problems := countDependencyProblems(tree); problems > 0 {
+						return fmt.Errorf("%d dependencies are missing or do not satisfy their constraint; run `xel pkg add` to install them", problems)
+					}
 					return nil
 				},
 			},
+			{
+				Name:      "why",
+				Usage:     "Show why a package is installed",
+				ArgsUsage: "<name>",
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() != 1 {
+						return fmt.Errorf("expected the name of a package")
+					}
+					name := c.Args().First()
+
+					mainManifest, _, lockfile, _, err := openProject()
+					if err != nil {
+						return err
+					}
+
+					paths := helpers.DependencyPaths(mainManifest, lockfile, name)
+					if len(paths) == 0 {
+						return fmt.Errorf("`%s` does not depend on `%s`", mainManifest.Name, name)
+					}
+
+					shared.ColorPalette.Info.Printf("`%s` is required through %d path(s):\n", name, len(paths))
+					for _, path := range paths {
+						steps := make([]string, len(path))
+						for i, node := range path {
+							steps[i] = node.Name + "@" + node.Version
+						}
+						target := path[len(path)-1]
+						steps[len(steps)-1] = dependencyLabel(target)
+						line := "  " + strings.Join(steps, " > ")
+						if isDependencyProblem(target) {
+							shared.ColorPalette.Warning.Println(line)
+						} else {
+							shared.ColorPalette.Info.Println(line)
+						}
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "cache",
+				Usage: "Manage the installed packages of the module paths",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: "List the installed packages, with their size and when they were last used",
+						Action: func(c *cli.Context) error {
+							packages, err := helpers.ListCache()
+							if err != nil {
+								return err
+							}
+							if len(packages) == 0 {
+								shared.ColorPalette.Info.Println("No packages installed")
+								return nil
+							}
+
+							rows := [][]string{{"Package", "Version", "Size", "Last used", "Path"}}
+							var total int64
+							for _, pkg := range packages {
+								rows = append(rows, []string{pkg.Name, pkg.Version, formatSize(pkg.Size), pkg.LastUsed.Format("2006-01-02 15:04"), pkg.Dir})
+								total += pkg.Size
+							}
+							printTable(rows, nil)
+							shared.ColorPalette.Info.Printf("%d package(s), %s\n", len(packages), formatSize(total))
+							return nil
+						},
+					},
+					{
+						Name:  "verify",
+						Usage: "Check the installed packages of the project against the integrity hashes of xel.lock",
+						Action: func(c *cli.Context) error {
+							_, _, lockfile, _, err := openProject()
+							if err != nil {
+								return err
+							}
+
+							keys := make([]string, 0, len(lockfile.Packages))
+							for key := range lockfile.Packages {
+								keys = append(keys, key)
+							}
+							sort.Strings(keys)
+
+							failed := 0
+							for _, key := range keys {
+								err := helpers.VerifyPackage(lockfile.Packages[key])
+								switch {
+								case err == nil:
+									shared.ColorPalette.Info.Printf("%s is intact\n", key)
+								case errors.Is(err, helpers.ErrCannotVerify):
+									shared.ColorPalette.Warning.Printf("%s %v\n", key, err)
+								default:
+									failed++
+									shared.ColorPalette.Error.Printf("%s: %v\n", key, err)
+								}
+							}
+
+							if failed > 0 {
+								return fmt.Errorf("%d package(s) failed verification; remove them with `xel pkg cache clean` and run `xel pkg install --frozen` to reinstall them", failed)
+							}
+							return nil
+						},
+					},
+					{
+						Name:  "clean",
+						Usage: "Remove every installed package",
+						Flags: []cli.Flag{dryRunFlag()},
+						Action: func(c *cli.Context) error {
+							packages, err := helpers.ListCache()
+							if err != nil {
+								return err
+							}
+							return removeCached(packages, c.Bool("dry-run"))
+						},
+					},
+					{
+						Name:      "prune",
+						Usage:     "Remove the installed packages that no xel.lock under a directory uses",
+						ArgsUsage: "[dir]",
+						Flags: []cli.Flag{
+							dryRunFlag(),
+							&cli.BoolFlag{
+								Name:  "all",
+								Usage: "Remove every installed package when no xel.lock is found",
+								Value: false,
+							},
+						},
+						Action: func(c *cli.Context) error {
+							// Flags after the directory would not be parsed, and --dry-run would be ignored
+							if c.Args().Len() > 1 {
+								return fmt.Errorf("expected at most one directory, and flags before it")
+							}
+							root := c.Args().First()
+							if root == "" {
+								cwd, err := os.Getwd()
+								if err != nil {
+									return err
+								}
+								root = cwd
+							}
+
+							lockfilePaths, err := helpers.FindLockfiles(root)
+							if err != nil {
+								return err
+							}
+							used := map[string]bool{}
+							for _, lockfilePath := range lockfilePaths {
+								lockfile, err := shared.ReadLockfile(lockfilePath)
+								if err != nil {
+									// Pruning without it could remove packages it uses
+									return fmt.Errorf("failed to read %s: %v", lockfilePath, err)
+								}
+								for name, version := range lockfile.Deps {
+									used[shared.LockKey(name, version)] = true
+								}
+								for key := range lockfile.Packages {
+									used[key] = true
+								}
+							}
+							// Most likely, the command was run from the wrong directory
+							if len(lockfilePaths) == 0 && !c.Bool("all") {
+								return fmt.Errorf("no xel.lock was found under %s, so every installed package would be removed\nrun it from a directory holding your projects, or pass --all to remove them all", root)
+							}
+							shared.ColorPalette.Info.Printf("Found %d xel.lock file(s) under %s\n", len(lockfilePaths), root)
+
+							packages, err := helpers.ListCache()
+							if err != nil {
+								return err
+							}
+							unused := []helpers.CachedPackage{}
+							for _, pkg := range packages {
+								if !used[shared.LockKey(pkg.Name, pkg.Version)] {
+									unused = append(unused, pkg)
+								}
+							}
+							return removeCached(unused, c.Bool("dry-run"))
+						},
+					},
+				},
+			},
 			{
 				Name:  "list",
 				Usage: "List installed packages",
@@ -338,10 +790,23 @@ func PackageCommands() *cli.Command {
 					}
 					shared.ColorPalette.Info.Printf("Installed Packages in %s@%s:\n", mainManifest.Name, mainManifest.Version)
 					shared.ColorPalette.Info.Println(strings.Repeat("-", 20))
-					for name, version := range *mainManifest.Deps {
-						shared.ColorPalette.Info.Printf("- %s@%s\n", name, version)
+					deps := mainManifest.InstalledDeps(true)
+					names := []string{}
+					for name := range deps {
+						names = append(names, name)
 					}
-					if len(*mainManifest.Deps) == 0 {
+					sort.Strings(names)
+					for _, name := range names {
+						note := ""
+						switch dependencyKind(mainManifest, name) {
+						case "devDeps":
+							note = " (dev)"
+						case "optionalDeps":
+							note = " (optional)"
+						}
+						shared.ColorPalette.Info.Printf("- %s@%s%s\n", name, deps[name], note)
+					}
+					if len(deps) == 0 {
 						shared.ColorPalette.Info.Println("No packages installed")
 					}
 					return nil
@@ -350,3 +815,341 @@ func PackageCommands() *cli.Command {
 		},
 	}
 }
+
+// printTable prints rows with aligned columns, the first row being the header.
+// The rows for which highlighted is true are printed as warnings.
+func printTable(rows [][]string, highlighted []bool) {
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+	for i, row := range rows {
+		line := ""
+		for j, cell := range row {
+			line += cell + strings.Repeat(" ", widths[j]-len(cell)+2)
+		}
+		if i < len(highlighted) && highlighted[i] {
+			shared.ColorPalette.Warning.Println(strings.TrimRight(line, " "))
+		} else {
+			shared.ColorPalette.Info.Println(strings.TrimRight(line, " "))
+		}
+	}
+}
+
+// formatSize formats a number of bytes for humans
+func formatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	value, unit := float64(size), 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", size, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+// dryRunFlag is the flag of the commands that remove installed packages to only list them
+func dryRunFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Lists the packages that would be removed, without removing them",
+		Value: false,
+	}
+}
+
+// removeCached removes installed packages, or only lists them for a dry run
+func removeCached(packages []helpers.CachedPackage, dryRun bool) error {
+	if len(packages) == 0 {
+		shared.ColorPalette.Info.Println("Nothing to remove")
+		return nil
+	}
+
+	var total int64
+	for _, pkg := range packages {
+		total += pkg.Size
+		if dryRun {
+			shared.ColorPalette.Info.Printf("Would remove `%s@%s` (%s)\n", pkg.Name, pkg.Version, pkg.Dir)
+			continue
+		}
+		if err := helpers.RemoveCached(pkg); err != nil {
+			return fmt.Errorf("failed to remove `%s@%s`: %v", pkg.Name, pkg.Version, err)
+		}
+		shared.ColorPalette.Info.Printf("Removed `%s@%s` (%s)\n", pkg.Name, pkg.Version, pkg.Dir)
+	}
+
+	if dryRun {
+		shared.ColorPalette.Info.Printf("%d package(s) would be removed, freeing %s\n", len(packages), formatSize(total))
+	} else {
+		shared.ColorPalette.Info.Printf("Removed %d package(s), freeing %s\n", len(packages), formatSize(total))
+	}
+	return nil
+}
+
+// dependencyLabel describes a package of the dependency tree
+func dependencyLabel(node *helpers.DependencyNode) string {
+	label := node.Name + "@" + node.Version
+	notes := []string{}
+	if node.Dev {
+		notes = append(notes, "dev")
+	}
+	if node.Optional {
+		notes = append(notes, "optional")
+	}
+	switch {
+	case node.Missing:
+		label = node.Name + " " + node.Constraint
+		notes = append(notes, "missing")
+	case node.Unsatisfied:
+		notes = append(notes, "does not satisfy "+node.Constraint)
+	case node.Deduped:
+		notes = append(notes, "deduped")
+	}
+
+	if len(notes) > 0 {
+		label += " (" + strings.Join(notes, ", ") + ")"
+	}
+	return label
+}
+
+// printDependencyTree prints the dependencies of a package, below it
+func printDependencyTree(deps []*helpers.DependencyNode, indent string) {
+	for i, node := range deps {
+		prefix, childIndent := "├─ ", "│  "
+		if i == len(deps)-1 {
+			prefix, childIndent = "└─ ", "   "
+		}
+
+		line := indent + prefix + dependencyLabel(node)
+		if isDependencyProblem(node) {
+			shared.ColorPalette.Warning.Println(line)
+		} else {
+			shared.ColorPalette.Info.Println(line)
+		}
+		printDependencyTree(node.Deps, indent+childIndent)
+	}
+}
+
+// isDependencyProblem reports whether a package of the dependency tree is missing,
+// which optional dependencies may be, or does not satisfy its constraint
+func isDependencyProblem(node *helpers.DependencyNode) bool {
+	return (node.Missing && !node.Optional) || node.Unsatisfied
+}
+
+// countDependencyProblems counts the packages of a dependency tree that are problems
+func countDependencyProblems(node *helpers.DependencyNode) int {
+	count := 0
+	if isDependencyProblem(node) {
+		count++
+	}
+	for _, dep := range node.Deps {
+		count += countDependencyProblems(dep)
+	}
+	return count
+}
+
+// dependencyKinds returns the kinds of dependencies a project can add packages to
+func dependencyKinds(manifest *shared.ProjectManifest) map[string]**map[string]string {
+	return map[string]**map[string]string{
+		"deps":         &manifest.Deps,
+		"devDeps":      &manifest.DevDeps,
+		"optionalDeps": &manifest.OptionalDeps,
+	}
+}
+
+// dependencyKind returns the kind of dependencies of the project that lists name
+func dependencyKind(manifest *shared.ProjectManifest, name string) string {
+	kinds := dependencyKinds(manifest)
+	for _, kind := range []string{"deps", "devDeps", "optionalDeps"} {
+		if deps := *kinds[kind]; deps != nil {
+			if _, listed := (*deps)[name]; listed {
+				return kind
+			}
+		}
+	}
+	return "deps"
+}
+
+// setDependency lists name as a dependency of the project in the given kind of
+// dependencies (`deps`, `devDeps` or `optionalDeps`), and removes it from the others
+func setDependency(manifest *shared.ProjectManifest, kind, name, spec string) {
+	removeDependency(manifest, name)
+	deps := dependencyKinds(manifest)[kind]
+	if *deps == nil {
+		*deps = &map[string]string{}
+	}
+	(**deps)[name] = spec
+}
+
+// removeDependency removes name from every kind of dependencies of the project
+func removeDependency(manifest *shared.ProjectManifest, name string) {
+	for kind, deps := range dependencyKinds(manifest) {
+		if *deps == nil {
+			continue
+		}
+		delete(**deps, name)
+		// Empty kinds are left out of xel.json, except for deps
+		if len(**deps) == 0 && kind != "deps" {
+			*deps = nil
+		}
+	}
+}
+
+// offlineFlag is the flag of the commands that install packages to stay off the network
+func offlineFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "offline",
+		Usage: "Only uses installed packages and a file:// registry, like Offline in the config",
+		Value: false,
+	}
+}
+
+// useOffline applies the offline flag of a command to the config
+func useOffline(c *cli.Context) {
+	if c.Bool("offline") {
+		shared.XelConfig.Offline = true
+	}
+}
+
+// parsePackageArg splits a package given to `pkg add` into its name and the
+// constraint it was given, which is empty if there is none. Packages from git are
+// given as `git+<url>[#<constraint>]`; their name is empty, and their spec is
+// the whole argument.
+func parsePackageArg(arg string) (string, string, error) {
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		return "", "", fmt.Errorf("package name is required")
+	}
+	if strings.HasPrefix(arg, "git+") {
+		return "", arg, nil
+	}
+
+	// Split package name and version if provided
+	split := strings.Split(arg, "@")
+	if len(split) > 2 {
+		return "", "", fmt.Errorf("invalid package format: %s", arg)
+	}
+
+	name := split[0]
+	version := ""
+	if len(split) == 2 {
+		version = split[1]
+		if strings.TrimSpace(version) == "" {
+			return "", "", fmt.Errorf("invalid package format: %s", arg)
+		}
+	}
+
+	// Validate name
+	if len(strings.TrimSpace(name)) == 0 {
+		return "", "", fmt.Errorf("package name is required")
+	}
+
+	return name, version, nil
+}
+
+// openProject returns the manifest of the project containing the working
+// directory, its path, its lockfile and the path of its lockfile
+func openProject() (*shared.ProjectManifest, string, *shared.Lockfile, string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, "", nil, "", err
+	}
+
+	mainManifest, mainManifestPath, err := helpers.FetchManifest(cwd, cwd)
+	if err != nil {
+		return nil, "", nil, "", err
+	}
+	if mainManifest == nil {
+		return nil, "", nil, "", fmt.Errorf("no manifest found")
+	}
+
+	lockfilePath := filepath.Join(filepath.Dir(mainManifestPath), "xel.lock")
+	lockfile, err := shared.ReadLockfile(lockfilePath)
+	if err != nil {
+		return nil, "", nil, "", err
+	}
+
+	return mainManifest, mainManifestPath, lockfile, lockfilePath, nil
+}
+
+// dependencyVersions returns the version a dependency of the project is at, the
+// newest version its constraint allows and its latest version. Versions that are
+// unknown are "-".
+func dependencyVersions(resolver *helpers.Resolver, lockfile *shared.Lockfile, name, spec string) (string, string, string, error) {
+	current, wanted, latest := "-", "-", "-"
+
+	if version, ok := lockfile.Deps[name]; ok {
+		current = version
+	} else if _, manifest, err := helpers.ResolveModuleLocal(name, spec); err == nil {
+		current = manifest.Version
+	}
+
+	versions, err := resolver.Versions(name, spec)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	_, constraint := helpers.ParseDependency(spec)
+	versionConstraint, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid version constraint `%s` for `%s`: %v", spec, name, err)
+	}
+	for _, version := range versions {
+		if versionConstraint.Check(version) {
+			wanted = version.String()
+			break
+		}
+	}
+	if version := latestVersion(versions); version != nil {
+		latest = version.String()
+	}
+
+	return current, wanted, latest, nil
+}
+
+// latestVersion returns the newest stable version of versions, which are sorted
+// newest first, or the newest prerelease if there are only prereleases
+func latestVersion(versions []*semver.Version) *semver.Version {
+	for _, version := range versions {
+		if version.Prerelease() == "" {
+			return version
+		}
+	}
+	if len(versions) > 0 {
+		return versions[0]
+	}
+	return nil
+}
+
+// packProject packs the project containing the working directory, and lists
+// what went into its tarball
+func packProject() (*helpers.PackedPackage, string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, "", err
+	}
+
+	mainManifest, mainManifestPath, err := helpers.FetchManifest(cwd, cwd)
+	if err != nil {
+		return nil, "", err
+	}
+	if mainManifest == nil {
+		return nil, "", fmt.Errorf("no manifest found")
+	}
+
+	pkg, err := helpers.PackPackage(mainManifest, mainManifestPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	shared.ColorPalette.Info.Printf("Packed `%s@%s` (%d file(s), %d bytes)\n", pkg.Manifest.Name, pkg.Manifest.Version, len(pkg.Files), len(pkg.Tarball))
+	for _, file := range pkg.Files {
+		shared.ColorPalette.Info.Printf("  %s\n", file)
+	}
+	shared.ColorPalette.Info.Printf("%s: %s\n", pkg.Algorithm, pkg.Hash)
+
+	return pkg, mainManifestPath, nil
+}
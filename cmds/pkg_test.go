@@ -0,0 +1,37 @@
+package cmds
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+func TestPkgList(t *testing.T) {
+	dir := t.TempDir()
+	manifest := `{"name": "app", "version": "1.0.0", "devDeps": {"foo": "^1.0.0"}, "optionalDeps": {"bar": "^2.0.0"}}`
+	if err := os.WriteFile(filepath.Join(dir, "xel.json"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	var output bytes.Buffer
+	colorOutput := color.Output
+	color.Output = &output
+	t.Cleanup(func() { color.Output = colorOutput })
+
+	// A project without `deps` lists its other dependencies
+	app := &cli.App{Name: "xel", Commands: []*cli.Command{PackageCommands()}}
+	if err := app.Run([]string{"xel", "pkg", "list"}); err != nil {
+		t.Fatalf("xel pkg list failed: %v", err)
+	}
+	for _, want := range []string{"- bar@^2.0.0 (optional)\n", "- foo@^1.0.0 (dev)\n"} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("xel pkg list printed %q, want %q", output.String(), want)
+		}
+	}
+}
@@ -0,0 +1,534 @@
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/dev-kas/xel/helpers"
+	"github.com/dev-kas/xel/modules"
+
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/chzyer/readline"
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/evaluator"
+	"github.com/dev-kas/virtlang-go/v4/lexer"
+	"github.com/dev-kas/virtlang-go/v4/parser"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+	"github.com/urfave/cli/v2"
+)
+
+// replSession holds the state of an interactive REPL session
+type replSession struct {
+	env     *environment.Environment
+	buffer  string   // Input of a statement that spans several lines
+	history []string // Inputs evaluated so far, written out by `.save`
+	sigChan chan os.Signal
+}
+
+// replCommand is a meta-command, typed at the start of a line with a leading dot
+type replCommand struct {
+	Name        string
+	Description string
+	Usage       string
+	// Execute runs the command, and reports whether the REPL should exit
+	Execute func(s *replSession, args []string) bool
+}
+
+var replCommands []replCommand
+
+func init() {
+	replCommands = []replCommand{
+		{
+			Name:        "help",
+			Description: "Show this help",
+			Usage:       ".help",
+			Execute: func(s *replSession, args []string) bool {
+				xShared.ColorPalette.Info.Println("REPL commands:")
+				for _, cmd := range replCommands {
+					fmt.Printf("  %-16s %s\n", cmd.Usage, cmd.Description)
+				}
+				xShared.ColorPalette.GrayMessage.Println("Statements continue on the next line until their brackets are balanced.")
+				xShared.ColorPalette.GrayMessage.Println("Press Ctrl-C to cancel the current input or stop a running evaluation, and Ctrl-D to exit.")
+				return false
+			},
+		},
+		{
+			Name:        "load",
+			Description: "Evaluate a file in the REPL environment",
+			Usage:       ".load <file>",
+			Execute: func(s *replSession, args []string) bool {
+				if len(args) != 1 {
+					xShared.ColorPalette.Error.Println("Usage: .load <file>")
+					return false
+				}
+
+				filename, err := filepath.Abs(args[0])
+				if err != nil {
+					xShared.ColorPalette.Error.Printf("Error: %s\n", err.Error())
+					return false
+				}
+
+				content, err := os.ReadFile(filename)
+				if err != nil {
+					xShared.ColorPalette.Error.Printf("Error: failed to read file %s: %v\n", args[0], err)
+					return false
+				}
+
+				// Loaded code becomes part of the session, so that `.save` reproduces it
+				if s.eval(string(content), filename) {
+					s.history = append(s.history, string(content))
+				}
+				return false
+			},
+		},
+		{
+			Name:        "save",
+			Description: "Save the inputs of this session to a file",
+			Usage:       ".save <file>",
+			Execute: func(s *replSession, args []string) bool {
+				if len(args) != 1 {
+					xShared.ColorPalette.Error.Println("Usage: .save <file>")
+					return false
+				}
+
+				content := strings.Join(s.history, "\n")
+				if content != "" {
+					content += "\n"
+				}
+
+				if err := os.WriteFile(args[0], []byte(content), 0644); err != nil {
+					xShared.ColorPalette.Error.Printf("Error: failed to write file %s: %v\n", args[0], err)
+					return false
+				}
+
+				xShared.ColorPalette.Info.Printf("Session saved to %s\n", args[0])
+				return false
+			},
+		},
+		{
+			Name:        "env",
+			Description: "List the bindings of the REPL environment",
+			Usage:       ".env",
+			Execute: func(s *replSession, args []string) bool {
+				s.env.Mutex.RLock()
+				defer s.env.Mutex.RUnlock()
+
+				if len(s.env.Variables) == 0 {
+					xShared.ColorPalette.GrayMessage.Println("No bindings yet.")
+					return false
+				}
+
+				names := make([]string, 0, len(s.env.Variables))
+				for name := range s.env.Variables {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+
+				for _, name := range names {
+					kind := "let"
+					if _, isConst := s.env.Constants[name]; isConst {
+						kind = "const"
+					}
+
+					value := helpers.Stringify(*s.env.Variables[name], true)
+					if lines := strings.Split(value, "\n"); len(lines) > 1 {
+						value = lines[0] + " ..."
+					}
+
+					xShared.ColorPalette.GrayMessage.Printf("  %-5s ", kind)
+					fmt.Printf("%s = %s\n", name, value)
+				}
+				return false
+			},
+		},
+		{
+			Name:        "clear",
+			Description: "Reset the REPL environment and the session",
+			Usage:       ".clear",
+			Execute: func(s *replSession, args []string) bool {
+				s.env = environment.NewEnvironment(xShared.XelRootEnv)
+				s.history = nil
+				xShared.ColorPalette.GrayMessage.Println("Environment cleared.")
+				return false
+			},
+		},
+		{
+			Name:        "exit",
+			Description: "Exit the REPL",
+			Usage:       ".exit",
+			Execute: func(s *replSession, args []string) bool {
+				return true
+			},
+		},
+	}
+}
+
+// StartREPL runs the interactive REPL until the user exits it
+func StartREPL(c *cli.Context) error {
+	xShared.ColorPalette.Welcome("Welcome to Xel v%s REPL (VirtLang v%s)!", xShared.RuntimeVersion, xShared.EngineVersion)
+	xShared.ColorPalette.GrayMessage.Println("Type '.help' for more information, or '.exit' to exit the REPL.")
+
+	// Expose the manifest of the project the REPL is started in, if any
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	manifest, _, err := loadManifest(cwd)
+	if err != nil {
+		return err
+	}
+	if err := setupProc(manifest, []string{}); err != nil {
+		return err
+	}
+
+	helpers.EnableInterrupts()
+	session := &replSession{
+		env:     environment.NewEnvironment(xShared.XelRootEnv),
+		sigChan: make(chan os.Signal, 1),
+	}
+
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:            xShared.ColorPalette.PromptStr("> "),
+		HistoryFile:       filepath.Join(os.TempDir(), "xel_history.tmp"),
+		AutoComplete:      &replCompleter{session: session},
+		InterruptPrompt:   "^C",
+		EOFPrompt:         ".exit",
+		HistorySearchFold: true,
+	})
+	if err != nil {
+		xShared.ColorPalette.Error.Printf("Error initializing readline: %s", err.Error())
+		return err
+	}
+	defer rl.Close()
+
+	// While a line is being read, Ctrl-C is handled by readline. While an
+	// evaluation is running, it arrives as a signal and stops the evaluation.
+	signal.Notify(session.sigChan, syscall.SIGINT)
+	defer signal.Stop(session.sigChan)
+
+	for {
+		if session.buffer == "" {
+			rl.SetPrompt(xShared.ColorPalette.PromptStr("> "))
+		} else {
+			rl.SetPrompt(xShared.ColorPalette.PromptStr("... "))
+		}
+
+		line, err := rl.Readline()
+		if err == readline.ErrInterrupt {
+			if session.buffer != "" {
+				session.buffer = ""
+				continue
+			}
+			xShared.ColorPalette.GrayMessage.Println("(To exit, press Ctrl-D or type .exit)")
+			continue
+		}
+		if err != nil {
+			// EOF
+			xShared.ColorPalette.ExitMessage.Println("Exiting REPL.")
+			return nil
+		}
+
+		if session.buffer == "" {
+			trimmed := strings.TrimSpace(line)
+
+			// `!exit` predates the meta-commands and is kept working
+			if trimmed == "!exit" {
+				xShared.ColorPalette.ExitMessage.Println("Exiting REPL.")
+				return nil
+			}
+
+			if strings.HasPrefix(trimmed, ".") {
+				if session.runCommand(trimmed) {
+					xShared.ColorPalette.ExitMessage.Println("Exiting REPL.")
+					return nil
+				}
+				continue
+			}
+
+			if trimmed == "" {
+				continue
+			}
+			session.buffer = line
+		} else {
+			session.buffer += "\n" + line
+		}
+
+		if !inputComplete(session.buffer) {
+			continue
+		}
+
+		input := session.buffer
+		session.buffer = ""
+		if session.eval(input, "<REPL>") {
+			session.history = append(session.history, input)
+		}
+	}
+}
+
+// runCommand executes a meta-command line, and reports whether the REPL should exit
+func (s *replSession) runCommand(line string) bool {
+	fields := strings.Fields(strings.TrimPrefix(line, "."))
+	if len(fields) == 0 {
+		return false
+	}
+
+	for _, cmd := range replCommands {
+		if cmd.Name == fields[0] {
+			return cmd.Execute(s, fields[1:])
+		}
+	}
+
+	xShared.ColorPalette.Error.Printf("Unknown command: .%s (see .help)\n", fields[0])
+	return false
+}
+
+// eval parses and evaluates src in the REPL environment and prints its result.
+// The evaluation can be stopped with Ctrl-C. It reports whether src ran without errors.
+func (s *replSession) eval(src string, filename string) bool {
+	program, perr := parser.New(filename).ProduceAST(src)
+	if perr != nil {
+		xShared.ColorPalette.Error.Printf("Error: %s\n", perr.Error())
+		return false
+	}
+	// Let Ctrl-C stop the program between statements, and catch blocks receive error values
+	helpers.InstrumentSteps(program)
+	helpers.RewriteCatches(program)
+
+	type evalResult struct {
+		output *shared.RuntimeValue
+		err    *errors.RuntimeError
+	}
+
+	// Discard interrupts that arrived while no evaluation was running
+	for len(s.sigChan) > 0 {
+		<-s.sigChan
+	}
+
+	dbgr := xShared.XelRootDebugger
+	done := make(chan evalResult, 1)
+	go func() {
+		output, err := evaluator.Evaluate(program, s.env, dbgr)
+		done <- evalResult{output, err}
+	}()
+
+	var result evalResult
+	select {
+	case <-s.sigChan:
+		helpers.InterruptEvaluation(func() { <-done })
+		dbgr.Snapshots = nil
+		xShared.ColorPalette.GrayMessage.Println("\nExecution interrupted.")
+		return false
+	case result = <-done:
+	}
+
+	if result.err != nil {
+		if len(dbgr.Snapshots) > 0 {
+			cwd, _ := os.Getwd()
+			stackTrace := dbgr.Snapshots[0]
+			stackTraceStr := helpers.GenerateStackTrace(stackTrace.Stack, cwd)
+			xShared.ColorPalette.Error.Println(stackTraceStr)
+		}
+		xShared.ColorPalette.Error.Printf("Error: %s\n", result.err.Error())
+		dbgr.Snapshots = nil
+		return false
+	}
+
+	if result.output != nil {
+		outputStr := helpers.Stringify(*result.output, true)
+		lines := strings.Split(outputStr, "\n")
+		for i, line := range lines {
+			if i == 0 {
+				xShared.ColorPalette.GrayMessage.Printf("< %s", line)
+			} else {
+				xShared.ColorPalette.GrayMessage.Printf("  %s", line)
+			}
+			if i < len(lines)-1 {
+				fmt.Println()
+			}
+		}
+		fmt.Println()
+	}
+
+	return true
+}
+
+// inputComplete reports whether src can be handed to the parser, i.e. whether it has
+// no unclosed brackets, strings or block comments. Closing brackets without a matching
+// opening one are left for the parser to report.
+func inputComplete(src string) bool {
+	runes := []rune(src)
+	depth := 0
+
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case '"', '\'':
+			// Strings may span lines and end at the first unescaped matching quote
+			closed := false
+			for i++; i < len(runes); i++ {
+				if runes[i] == r && runes[i-1] != '\\' {
+					closed = true
+					break
+				}
+			}
+			if !closed {
+				return false
+			}
+		case '/':
+			if i+1 >= len(runes) {
+				continue
+			}
+			if runes[i+1] == '/' {
+				for i < len(runes) && runes[i] != '\n' {
+					i++
+				}
+			} else if runes[i+1] == '*' {
+				closed := false
+				for i += 2; i+1 < len(runes); i++ {
+					if runes[i] == '*' && runes[i+1] == '/' {
+						closed = true
+						i++
+						break
+					}
+				}
+				if !closed {
+					return false
+				}
+			}
+		}
+	}
+
+	return depth <= 0
+}
+
+var (
+	importPrefixPattern = regexp.MustCompile(`import\(\s*["']([^"']*)$`)
+	memberPathPattern   = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)*\.?$`)
+)
+
+// replCompleter implements readline.AutoCompleter for the REPL. It completes
+// meta-commands, native module names inside `import("...")`, members of objects
+// and class instances, and identifiers visible from the REPL environment.
+type replCompleter struct {
+	session *replSession
+}
+
+func (rc *replCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	before := string(line[:pos])
+
+	if rc.session.buffer == "" && strings.HasPrefix(before, ".") && !strings.ContainsAny(before, " \t") {
+		names := make([]string, 0, len(replCommands))
+		for _, cmd := range replCommands {
+			names = append(names, "."+cmd.Name)
+		}
+		return completeFrom(before, names)
+	}
+
+	if m := importPrefixPattern.FindStringSubmatch(before); m != nil {
+		names := make([]string, 0, len(modules.NativeModuleRegistry))
+		for name := range modules.NativeModuleRegistry {
+			names = append(names, name)
+		}
+		return completeFrom(m[1], names)
+	}
+
+	path := memberPathPattern.FindString(before)
+	if path == "" {
+		return nil, 0
+	}
+
+	parts := strings.Split(path, ".")
+	if len(parts) == 1 {
+		return completeFrom(path, visibleIdentifiers(rc.session.env))
+	}
+
+	value, err := rc.session.env.LookupVar(parts[0])
+	if err != nil {
+		return nil, 0
+	}
+	for _, part := range parts[1 : len(parts)-1] {
+		members := memberValues(value)
+		if members == nil || members[part] == nil {
+			return nil, 0
+		}
+		value = members[part]
+	}
+
+	names := []string{}
+	for name := range memberValues(value) {
+		names = append(names, name)
+	}
+	return completeFrom(parts[len(parts)-1], names)
+}
+
+// visibleIdentifiers lists the keywords and every name declared in env or its parents
+func visibleIdentifiers(env *environment.Environment) []string {
+	names := []string{}
+	for keyword := range lexer.KEYWORDS {
+		names = append(names, keyword)
+	}
+	for scope := env; scope != nil; scope = scope.Parent {
+		scope.Mutex.RLock()
+		for name := range scope.Variables {
+			names = append(names, name)
+		}
+		scope.Mutex.RUnlock()
+	}
+	return names
+}
+
+// memberValues returns the members of an object or the public members of a class instance
+func memberValues(value *shared.RuntimeValue) map[string]*shared.RuntimeValue {
+	switch value.Type {
+	case shared.Object:
+		members, _ := value.Value.(map[string]*shared.RuntimeValue)
+		return members
+	case shared.ClassInstance:
+		instance, ok := value.Value.(values.ClassInstanceValue)
+		if !ok {
+			return nil
+		}
+		members := map[string]*shared.RuntimeValue{}
+		for name, public := range instance.Publics {
+			if !public {
+				continue
+			}
+			if member, err := instance.Data.LookupVar(name); err == nil {
+				members[name] = member
+			}
+		}
+		return members
+	default:
+		return nil
+	}
+}
+
+// completeFrom returns the suffixes of the candidates starting with prefix, in the
+// form expected by readline.AutoCompleter
+func completeFrom(prefix string, candidates []string) ([][]rune, int) {
+	sort.Strings(candidates)
+
+	matches := [][]rune{}
+	seen := map[string]bool{}
+	for _, candidate := range candidates {
+		if seen[candidate] || !strings.HasPrefix(candidate, prefix) || candidate == prefix {
+			continue
+		}
+		seen[candidate] = true
+		matches = append(matches, []rune(strings.TrimPrefix(candidate, prefix)))
+	}
+
+	return matches, len([]rune(prefix))
+}
@@ -3,8 +3,10 @@ package cmds
 import (
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/dev-kas/xel/helpers"
 
@@ -28,95 +30,33 @@ func RunCommand() *cli.Command {
 	return &cli.Command{
 		Name:  "run",
 		Usage: "Execute a VirtLang script file",
+		Flags: append(permissionFlags(),
+			&cli.BoolFlag{
+				Name:  "watch",
+				Usage: "Run the script again whenever it, a module it imports or xel.json changes",
+			},
+		),
 		Action: func(c *cli.Context) error {
 			if c.NArg() < 1 {
 				return fmt.Errorf("filename is required")
 			}
 
-			filename := c.Args().Get(0)
-			cwd, cwd_err := os.Getwd()
-			if cwd_err != nil {
-				return cwd_err
-			}
-
-			// Check if file has .xel extension
-			if !strings.HasSuffix(filename, ".xel") {
-				return fmt.Errorf("file must have .xel extension")
-			}
-
-			// Check if file exists
-			_, err := os.Stat(filename)
-			if os.IsNotExist(err) {
-				return fmt.Errorf("file %s does not exist", filename)
+			if err := checkPermissionValues(c, isScriptPath); err != nil {
+				return err
 			}
 
-			// Convert filename to absolute path
-			filename, err = filepath.Abs(filename)
+			filename, err := resolveScriptPath(c.Args().Get(0))
 			if err != nil {
 				return err
 			}
 
-			// Check for xel.json in project directory
-			manifest, _, err := helpers.FetchManifest(filepath.Dir(filename), filepath.Dir(filename))
+			manifest, manifestPath, err := loadManifest(filepath.Dir(filename))
 			if err != nil {
-				// Ignore error if manifest is not found
-				if err.Error() != "cannot find manifest" {
-					return err
-				}
+				return err
 			}
-			if manifest != nil {
-				// Check Xel version constraint if specified
-				if *manifest.Xel != "" {
-					// Skip version check in development mode (when version is empty)
-					if xShared.RuntimeVersion == "" {
-						color.New(color.FgYellow).Printf("Skipping Xel version check in development mode\n")
-					} else {
-						constraint, err := semver.NewConstraint(*manifest.Xel)
-						if err != nil {
-							return fmt.Errorf("invalid Xel version constraint in manifest: %v", err)
-						}
-
-						runtimeVersion, err := semver.NewVersion(xShared.RuntimeVersion)
-						if err != nil {
-							return fmt.Errorf("invalid runtime version format: %v", err)
-						}
-
-						if !constraint.Check(runtimeVersion) {
-							return fmt.Errorf("xel version %s does not satisfy required version %s from xel.json, please upgrade your runtime",
-								xShared.RuntimeVersion, *manifest.Xel)
-						}
-					}
-				}
 
-				// Check Engine version constraint if specified
-				if *manifest.Engine != "" {
-					// Skip version check in development mode (when version is empty)
-					if xShared.EngineVersion == "" {
-						color.New(color.FgYellow).Printf("Skipping Engine version check in development mode\n")
-					} else {
-						constraint, err := semver.NewConstraint(*manifest.Engine)
-						if err != nil {
-							return fmt.Errorf("invalid Engine version constraint in manifest: %v", err)
-						}
-
-						engineVersion, err := semver.NewVersion(xShared.EngineVersion)
-						if err != nil {
-							return fmt.Errorf("invalid engine version format: %v", err)
-						}
-
-						if !constraint.Check(engineVersion) {
-							return fmt.Errorf("engine version %s does not satisfy required version %s from xel.json, please upgrade your runtime",
-								xShared.EngineVersion, *manifest.Engine)
-						}
-					}
-				}
-			} else {
-				// No manifest found, use default values
-				manifest = &xShared.ProjectManifest{
-					Name:    "Unknown",
-					Version: "0.0.0",
-					Deps:    &map[string]string{},
-				}
+			if err := applyPermissions(c, manifest, manifestPath); err != nil {
+				return err
 			}
 
 			// Get remaining arguments
@@ -127,90 +67,201 @@ func RunCommand() *cli.Command {
 				}
 			}
 
-			// Convert arguments to []shared.RuntimeValue
-			args := make([]shared.RuntimeValue, len(rawArgs))
-			for i, arg := range rawArgs {
-				args[i] = values.MK_STRING(arg)
+			if c.Bool("watch") {
+				// Watching ends on Ctrl-C
+				signals := make(chan os.Signal, 1)
+				signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+				defer signal.Stop(signals)
+				return watchScript(filename, manifest, manifestPath, rawArgs, signals)
+			}
+			return runScript(filename, manifest, rawArgs)
+		},
+	}
+}
+
+// runScript runs the script at filename as the main script of the project
+// described by manifest, with rawArgs as `proc.args`. The stack trace of the
+// error that stops the script, if any, is printed before it is returned.
+func runScript(filename string, manifest *xShared.ProjectManifest, rawArgs []string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	if err := setupProc(manifest, rawArgs); err != nil {
+		return err
+	}
+
+	evalErr := evaluateFile(filename, environment.NewEnvironment(xShared.XelRootEnv))
+	if evalErr != nil {
+		// show the stack trace, unless the script was stopped on purpose
+		if len(xShared.XelRootDebugger.Snapshots) > 0 && !helpers.IsInterrupted(evalErr) {
+			stackTrace := xShared.XelRootDebugger.Snapshots[0]
+			stackTraceStr := helpers.GenerateStackTrace(stackTrace.Stack, cwd)
+			xShared.ColorPalette.Error.Println(stackTraceStr)
+		}
+		// Do not let the snapshots of this run leak into the next one
+		xShared.XelRootDebugger.Snapshots = nil
+		return evalErr
+	}
+
+	return nil
+}
+
+// isScriptPath reports whether filename names a script, which has the .xel extension
+func isScriptPath(filename string) bool {
+	return strings.HasSuffix(filename, ".xel")
+}
+
+// resolveScriptPath checks that filename refers to an existing .xel file
+// and returns its absolute path.
+func resolveScriptPath(filename string) (string, error) {
+	// Check if file has .xel extension
+	if !isScriptPath(filename) {
+		return "", fmt.Errorf("file must have .xel extension")
+	}
+
+	// Check if file exists
+	_, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("file %s does not exist", filename)
+	}
+
+	// Convert filename to absolute path
+	return filepath.Abs(filename)
+}
+
+// loadManifest looks up the manifest (xel.json) of the project containing dir
+// and checks its runtime and engine version constraints. It returns the manifest
+// along with its path. When no manifest can be found, a manifest holding default
+// values and an empty path are returned instead.
+func loadManifest(dir string) (*xShared.ProjectManifest, string, error) {
+	manifest, manifestPath, err := helpers.FetchManifest(dir, dir)
+	if err != nil {
+		// Ignore error if manifest is not found
+		if err.Error() != "cannot find manifest" {
+			return nil, "", err
+		}
+	}
+
+	if manifest == nil {
+		// No manifest found, use default values
+		return &xShared.ProjectManifest{
+			Name:    "Unknown",
+			Version: "0.0.0",
+			Deps:    &map[string]string{},
+		}, "", nil
+	}
+
+	// Check Xel version constraint if specified
+	if manifest.Xel != nil && *manifest.Xel != "" {
+		// Skip version check in development mode (when version is empty)
+		if xShared.RuntimeVersion == "" {
+			color.New(color.FgYellow).Printf("Skipping Xel version check in development mode\n")
+		} else {
+			constraint, err := semver.NewConstraint(*manifest.Xel)
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid Xel version constraint in manifest: %v", err)
+			}
+
+			runtimeVersion, err := semver.NewVersion(xShared.RuntimeVersion)
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid runtime version format: %v", err)
 			}
 
-			// Convert manifest to a VirtLang object
-			// Note: This is not reliable because if `manifest` does not exist, it will only use default values
-			manifestConverted := map[string]*shared.RuntimeValue{}
-			nameVal := values.MK_STRING(manifest.Name)
-			manifestConverted["name"] = &nameVal
-			descVal := values.MK_STRING(manifest.Description)
-			manifestConverted["description"] = &descVal
-			versionVal := values.MK_STRING(manifest.Version)
-			manifestConverted["version"] = &versionVal
-			xelVal := values.MK_STRING(*manifest.Xel)
-			manifestConverted["xel"] = &xelVal
-			engineVal := values.MK_STRING(*manifest.Engine)
-			manifestConverted["engine"] = &engineVal
-			mainVal := values.MK_STRING(manifest.Main)
-			manifestConverted["main"] = &mainVal
-			authorVal := values.MK_STRING(manifest.Author)
-			manifestConverted["author"] = &authorVal
-			licenseVal := values.MK_STRING(manifest.License)
-			manifestConverted["license"] = &licenseVal
-			// Convert deps map separately
-			depsObj := values.MK_OBJECT(map[string]*shared.RuntimeValue{})
-			manifestConverted["deps"] = &depsObj
-			depsMap := make(map[string]*shared.RuntimeValue)
-			for k, v := range *manifest.Deps {
-				depVal := values.MK_STRING(v)
-				depsMap[k] = &depVal
+			if !constraint.Check(runtimeVersion) {
+				return nil, "", fmt.Errorf("xel version %s does not satisfy required version %s from xel.json, please upgrade your runtime",
+					xShared.RuntimeVersion, *manifest.Xel)
 			}
-			(*manifestConverted["deps"]).Value = depsMap
+		}
+	}
 
-			manifestObj := values.MK_OBJECT(manifestConverted)
-			// Read file content
-			content, err := os.ReadFile(filename)
+	// Check Engine version constraint if specified
+	if manifest.Engine != nil && *manifest.Engine != "" {
+		// Skip version check in development mode (when version is empty)
+		if xShared.EngineVersion == "" {
+			color.New(color.FgYellow).Printf("Skipping Engine version check in development mode\n")
+		} else {
+			constraint, err := semver.NewConstraint(*manifest.Engine)
 			if err != nil {
-				return fmt.Errorf("failed to read file %s: %v", filename, err)
+				return nil, "", fmt.Errorf("invalid Engine version constraint in manifest: %v", err)
 			}
 
-			program, parseErr := parser.New(filename).ProduceAST(string(content))
-			if parseErr != nil {
-				return parseErr
+			engineVersion, err := semver.NewVersion(xShared.EngineVersion)
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid engine version format: %v", err)
 			}
 
-			rootEnv := xShared.XelRootEnv
-			RV_proc := map[string]*shared.RuntimeValue{}
-
-			// Check if proc exists
-			if _, err := rootEnv.LookupVar("proc"); err != nil {
-				// Proc doesn't exist, create new one
-				rootEnv.DeclareVar("proc", values.MK_OBJECT(RV_proc), false)
-			} else {
-				// Proc exists, get its value
-				val, err := rootEnv.LookupVar("proc")
-				if err != nil {
-					return fmt.Errorf("failed to lookup proc variable: %v", err)
-				}
-				RV_proc = val.Value.(map[string]*shared.RuntimeValue)
+			if !constraint.Check(engineVersion) {
+				return nil, "", fmt.Errorf("engine version %s does not satisfy required version %s from xel.json, please upgrade your runtime",
+					xShared.EngineVersion, *manifest.Engine)
 			}
+		}
+	}
+
+	return manifest, manifestPath, nil
+}
 
-			RV_proc_args := values.MK_ARRAY(args)
-			RV_proc["args"] = &RV_proc_args
-			RV_proc["manifest"] = &manifestObj
+// setupProc populates `proc.args` and `proc.manifest` in the root environment
+func setupProc(manifest *xShared.ProjectManifest, rawArgs []string) error {
+	// Convert arguments to []shared.RuntimeValue
+	args := make([]shared.RuntimeValue, len(rawArgs))
+	for i, arg := range rawArgs {
+		args[i] = values.MK_STRING(arg)
+	}
 
-			// Update the proc variable
-			rootEnv.AssignVar("proc", values.MK_OBJECT(RV_proc))
+	manifestObj := helpers.ManifestToObject(manifest)
 
-			env := environment.NewEnvironment(rootEnv)
-			env.DeclareVar("__filename__", values.MK_STRING(filename), true)
-			env.DeclareVar("__dirname__", values.MK_STRING(filepath.Dir(filename)), true)
+	rootEnv := xShared.XelRootEnv
+	RV_proc := map[string]*shared.RuntimeValue{}
 
-			_, evalErr := evaluator.Evaluate(program, env, xShared.XelRootDebugger)
-			if evalErr != nil {
-				// show the stack trace
-				stackTrace := xShared.XelRootDebugger.Snapshots[0]
-				stackTraceStr := helpers.GenerateStackTrace(stackTrace.Stack, cwd)
-				xShared.ColorPalette.Error.Println(stackTraceStr)
-				return evalErr
-			}
+	// Check if proc exists
+	if _, err := rootEnv.LookupVar("proc"); err != nil {
+		// Proc doesn't exist, create new one
+		rootEnv.DeclareVar("proc", values.MK_OBJECT(RV_proc), false)
+	} else {
+		// Proc exists, get its value
+		val, err := rootEnv.LookupVar("proc")
+		if err != nil {
+			return fmt.Errorf("failed to lookup proc variable: %v", err)
+		}
+		RV_proc = val.Value.(map[string]*shared.RuntimeValue)
+	}
 
-			return nil
-		},
+	RV_proc_args := values.MK_ARRAY(args)
+	RV_proc["args"] = &RV_proc_args
+	RV_proc["manifest"] = &manifestObj
+
+	// Update the proc variable
+	rootEnv.AssignVar("proc", values.MK_OBJECT(RV_proc))
+
+	return nil
+}
+
+// evaluateFile parses the script at filename and evaluates it in env,
+// after declaring `__filename__` and `__dirname__` in it.
+func evaluateFile(filename string, env *environment.Environment) error {
+	// Read file content
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %v", filename, err)
+	}
+
+	program, parseErr := parser.New(filename).ProduceAST(string(content))
+	if parseErr != nil {
+		return parseErr
 	}
+	// Let a step hook stop the script between statements, and catch blocks receive error values
+	helpers.InstrumentSteps(program)
+	helpers.RewriteCatches(program)
+
+	env.DeclareVar("__filename__", values.MK_STRING(filename), true)
+	env.DeclareVar("__dirname__", values.MK_STRING(filepath.Dir(filename)), true)
+
+	_, evalErr := evaluator.Evaluate(program, env, xShared.XelRootDebugger)
+	if evalErr != nil {
+		return evalErr
+	}
+
+	return nil
 }
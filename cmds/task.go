@@ -0,0 +1,213 @@
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/urfave/cli/v2"
+)
+
+// TaskCommand returns the cli.Command for the task command
+// It runs a script of the project's manifest (xel.json), after the tasks it
+// depends on and its `pre` hook, and before its `post` hook. Without a name, it
+// lists the scripts of the project.
+func TaskCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "task",
+		Usage:     "Run a script of xel.json, or list them",
+		ArgsUsage: "[name] [args...]",
+		Flags:     permissionFlags(),
+		Action: func(c *cli.Context) error {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+
+			manifest, manifestPath, err := loadManifest(cwd)
+			if err != nil {
+				return err
+			}
+			if manifestPath == "" {
+				return fmt.Errorf("tasks need a project, but no xel.json was found")
+			}
+
+			if c.NArg() == 0 {
+				listTasks(manifest)
+				return nil
+			}
+
+			isTask := func(name string) bool {
+				_, ok := manifest.Scripts[name]
+				return ok
+			}
+			if err := checkPermissionValues(c, isTask); err != nil {
+				return err
+			}
+			if err := applyPermissions(c, manifest, manifestPath); err != nil {
+				return err
+			}
+
+			// Tasks run from the project root, wherever they are started from
+			if err := os.Chdir(filepath.Dir(manifestPath)); err != nil {
+				return err
+			}
+
+			runner := &taskRunner{
+				manifest:     manifest,
+				manifestPath: manifestPath,
+				done:         map[string]bool{},
+			}
+			return runner.run(c.Args().First(), c.Args().Tail(), true)
+		},
+	}
+}
+
+// listTasks prints the scripts of the project, with what they run and what they depend on
+func listTasks(manifest *xShared.ProjectManifest) {
+	if len(manifest.Scripts) == 0 {
+		xShared.ColorPalette.Warning.Println("No tasks are defined in the `scripts` of xel.json.")
+		return
+	}
+
+	names := make([]string, 0, len(manifest.Scripts))
+	for name := range manifest.Scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rows := [][]string{{"Task", "Runs", "After"}}
+	for _, name := range names {
+		script := manifest.Scripts[name]
+		if script == nil {
+			continue
+		}
+		runs := script.Run
+		if script.Description != "" {
+			runs = script.Description
+		}
+		rows = append(rows, []string{name, runs, strings.Join(script.Deps, ", ")})
+	}
+	printTable(rows, nil)
+}
+
+// taskRunner runs the scripts of a project, each at most once
+type taskRunner struct {
+	manifest     *xShared.ProjectManifest
+	manifestPath string
+	done         map[string]bool // Tasks that have run
+	running      []string        // Tasks that have started but not finished, outermost first
+}
+
+// run runs the task name with args, after the tasks it depends on. With hooks,
+// the tasks `pre<name>` and `post<name>` run right before and after it, if they
+// exist.
+func (r *taskRunner) run(name string, args []string, hooks bool) error {
+	if r.done[name] {
+		return nil
+	}
+	for i, running := range r.running {
+		if running == name {
+			cycle := append(append([]string{}, r.running[i:]...), name)
+			return fmt.Errorf("tasks depend on each other: %s", strings.Join(cycle, " > "))
+		}
+	}
+
+	script := r.manifest.Scripts[name]
+	if script == nil {
+		if len(r.running) > 0 {
+			return fmt.Errorf("task `%s` depends on `%s`, which is not in the `scripts` of xel.json", r.running[len(r.running)-1], name)
+		}
+		return fmt.Errorf("task `%s` is not in the `scripts` of xel.json; run `xel task` to list them", name)
+	}
+
+	r.running = append(r.running, name)
+	for _, dep := range script.Deps {
+		if err := r.run(dep, nil, true); err != nil {
+			return err
+		}
+	}
+
+	if hooks {
+		if err := r.runHook("pre" + name); err != nil {
+			return err
+		}
+	}
+	if err := r.exec(name, script, args); err != nil {
+		return err
+	}
+	r.done[name] = true
+	if hooks {
+		if err := r.runHook("post" + name); err != nil {
+			return err
+		}
+	}
+	r.running = r.running[:len(r.running)-1]
+
+	return nil
+}
+
+// runHook runs the hook name if the project has it. Hooks have no hooks of their own.
+func (r *taskRunner) runHook(name string) error {
+	if r.manifest.Scripts[name] == nil {
+		return nil
+	}
+	return r.run(name, nil, false)
+}
+
+// exec runs the command of a task, which is a .xel file if its first word ends
+// with `.xel`, and a shell command line otherwise. args are added to the arguments
+// of the command.
+func (r *taskRunner) exec(name string, script *xShared.Script, args []string) error {
+	// A task may only group the tasks it depends on
+	if strings.TrimSpace(script.Run) == "" {
+		return nil
+	}
+	xShared.ColorPalette.GrayMessage.Printf("> %s: %s\n", name, strings.TrimSpace(strings.Join(append([]string{script.Run}, args...), " ")))
+
+	fields := strings.Fields(script.Run)
+	if strings.HasSuffix(fields[0], ".xel") {
+		filename, err := resolveScriptPath(filepath.Join(filepath.Dir(r.manifestPath), fields[0]))
+		if err != nil {
+			return fmt.Errorf("task `%s`: %v", name, err)
+		}
+		if err := runScript(filename, r.manifest, append(fields[1:], args...)); err != nil {
+			return fmt.Errorf("task `%s` failed: %v", name, err)
+		}
+		return nil
+	}
+
+	cmd := shellCommand(script.Run, args)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), "XEL_TASK="+name, "XEL_MANIFEST="+r.manifestPath)
+	if executable, err := os.Executable(); err == nil {
+		cmd.Env = append(cmd.Env, "XEL="+executable)
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("task `%s` failed: %v", name, err)
+	}
+	return nil
+}
+
+// shellCommand returns the command running line in the shell of the system,
+// with args passed to it as separate arguments
+func shellCommand(line string, args []string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		for _, arg := range args {
+			line += ` "` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+		}
+		return exec.Command("cmd", "/C", line)
+	}
+
+	// The arguments become "$@", so that the shell does not split or expand them
+	if len(args) > 0 {
+		line += ` "$@"`
+	}
+	return exec.Command("sh", append([]string{"-c", line, "sh"}, args...)...)
+}
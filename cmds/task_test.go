@@ -0,0 +1,99 @@
+package cmds
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/dev-kas/xel/globals"
+	xShared "github.com/dev-kas/xel/shared"
+
+	_ "github.com/dev-kas/xel/modules/os"
+
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+const taskTestManifest = `{
+  "name": "app",
+  "version": "1.0.0",
+  "scripts": {
+    "build": { "run": "noop.xel", "deps": ["clean", "gen"] },
+    "prebuild": "noop.xel",
+    "postbuild": "noop.xel",
+    "clean": "noop.xel",
+    "gen": { "run": "noop.xel", "deps": ["clean"] },
+    "pregen": "noop.xel",
+    "name": "name.xel",
+    "loop": { "deps": ["again"] },
+    "again": { "run": "noop.xel", "deps": ["loop"] }
+  }
+}`
+
+// A task that writes the name of its project to name.txt
+const nameTaskScript = `const os = import("xel:os")
+os.write("name.txt", proc.manifest.name)
+`
+
+// runTask runs `xel task` with args in dir, and returns the names of the tasks it ran, in order
+func runTask(t *testing.T, dir string, args ...string) ([]string, error) {
+	t.Helper()
+	t.Chdir(dir)
+
+	var output bytes.Buffer
+	colorOutput := color.Output
+	color.Output = &output
+	defer func() { color.Output = colorOutput }()
+
+	app := &cli.App{Name: "xel", Commands: []*cli.Command{TaskCommand()}}
+	err := app.Run(append([]string{"xel", "task"}, args...))
+
+	ran := []string{}
+	for _, match := range regexp.MustCompile(`(?m)^> ([^:]+):`).FindAllStringSubmatch(output.String(), -1) {
+		ran = append(ran, match[1])
+	}
+	return ran, err
+}
+
+func TestTask(t *testing.T) {
+	globals.Globalize(xShared.XelRootEnv)
+
+	dir := t.TempDir()
+	files := map[string]string{"xel.json": taskTestManifest, "noop.xel": "", "name.xel": nameTaskScript}
+	for file, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Dependencies run first and once, then the hooks around the task; dependencies run their own hooks
+	ran, err := runTask(t, dir, "build")
+	if err != nil {
+		t.Fatalf("xel task build failed: %v", err)
+	}
+	if want := "clean pregen gen prebuild build postbuild"; strings.Join(ran, " ") != want {
+		t.Errorf("xel task build ran %v, want %s", ran, want)
+	}
+
+	// Hooks run by themselves without the task
+	ran, err = runTask(t, dir, "prebuild")
+	if err != nil || strings.Join(ran, " ") != "prebuild" {
+		t.Errorf("xel task prebuild ran %v (%v), want only prebuild", ran, err)
+	}
+
+	_, err = runTask(t, dir, "loop")
+	if err == nil || err.Error() != "tasks depend on each other: loop > again > loop" {
+		t.Errorf("xel task loop = %v, want the cycle", err)
+	}
+
+	// .xel tasks see the manifest of the project
+	if _, err := runTask(t, dir, "name"); err != nil {
+		t.Fatalf("xel task name failed: %v", err)
+	}
+	if name, err := os.ReadFile(filepath.Join(dir, "name.txt")); err != nil || string(name) != "app" {
+		t.Errorf("the task wrote %q (%v), want the name of the project", name, err)
+	}
+}
@@ -0,0 +1,368 @@
+package cmds
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dev-kas/xel/helpers"
+	xTest "github.com/dev-kas/xel/modules/test"
+
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/dev-kas/virtlang-go/v4/debugger"
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/urfave/cli/v2"
+)
+
+// testFileReport holds the outcome of running a single test file
+type testFileReport struct {
+	Path     string
+	Results  []xTest.Result
+	Err      error              // Error that aborted the file, if any
+	Stack    debugger.CallStack // Call stack at the point Err was raised
+	Duration time.Duration
+}
+
+// TestCommand returns the cli.Command for the test command
+// It discovers `*_test.xel` files in the current project, runs each of them
+// in an isolated environment and reports the results collected by `xel:test`.
+func TestCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "test",
+		Usage:     "Run the project's *_test.xel files",
+		ArgsUsage: "[files or directories...]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "junit",
+				Usage: "Write a JUnit XML report to `FILE`",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+
+			// Tests are discovered from the project root, or from
+			// the current directory when outside of a project
+			projectDir := cwd
+			if _, manifestPath, err := helpers.FetchManifest(cwd, cwd); err == nil {
+				projectDir = filepath.Dir(manifestPath)
+			}
+
+			roots := c.Args().Slice()
+			if len(roots) == 0 {
+				roots = []string{projectDir}
+			}
+
+			files, err := discoverFiles(roots, "_test.xel")
+			if err != nil {
+				return err
+			}
+
+			if len(files) == 0 {
+				xShared.ColorPalette.Warning.Println("No test files found.")
+				return nil
+			}
+
+			manifest, _, err := loadManifest(projectDir)
+			if err != nil {
+				return err
+			}
+
+			if err := setupProc(manifest, []string{}); err != nil {
+				return err
+			}
+
+			reports := make([]testFileReport, 0, len(files))
+			start := time.Now()
+			for _, file := range files {
+				report := runTestFile(file)
+				printTestFileReport(report, cwd)
+				reports = append(reports, report)
+			}
+
+			passed, failed, skipped, errored := 0, 0, 0, 0
+			for _, report := range reports {
+				if report.Err != nil {
+					errored++
+				}
+				for _, result := range report.Results {
+					switch result.Status {
+					case xTest.Passed:
+						passed++
+					case xTest.Failed:
+						failed++
+					case xTest.Skipped:
+						skipped++
+					}
+				}
+			}
+
+			fmt.Println()
+			summary := fmt.Sprintf("Tests: %d passed, %d failed, %d skipped, %d total", passed, failed, skipped, passed+failed+skipped)
+			if failed > 0 || errored > 0 {
+				xShared.ColorPalette.Error.Println(summary)
+			} else {
+				xShared.ColorPalette.Info.Println(summary)
+			}
+			xShared.ColorPalette.GrayMessage.Printf("Files: %d run, %d aborted (%s)\n", len(reports), errored, time.Since(start).Round(time.Millisecond))
+
+			if junitPath := c.String("junit"); junitPath != "" {
+				if err := writeJUnitReport(junitPath, reports, cwd); err != nil {
+					return fmt.Errorf("failed to write JUnit report: %v", err)
+				}
+			}
+
+			if failed > 0 || errored > 0 {
+				return fmt.Errorf("%d test(s) failed, %d test file(s) aborted", failed, errored)
+			}
+
+			return nil
+		},
+	}
+}
+
+// discoverFiles expands roots into a sorted list of absolute file paths.
+// Directories are searched recursively for files whose name ends with suffix,
+// skipping hidden directories, while files are taken as they are.
+func discoverFiles(roots []string, suffix string) ([]string, error) {
+	seen := map[string]bool{}
+	files := []string{}
+
+	for _, root := range roots {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, fmt.Errorf("cannot access %s: %v", root, err)
+		}
+
+		if !info.IsDir() {
+			if !strings.HasSuffix(root, ".xel") {
+				return nil, fmt.Errorf("file must have .xel extension: %s", root)
+			}
+			if !seen[root] {
+				seen[root] = true
+				files = append(files, root)
+			}
+			continue
+		}
+
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(d.Name(), suffix) && !seen[path] {
+				seen[path] = true
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// runTestFile evaluates a test file in its own environment and collects its results
+func runTestFile(file string) testFileReport {
+	report := testFileReport{Path: file}
+	dbgr := xShared.XelRootDebugger
+
+	xTest.Collect(file)
+	start := time.Now()
+	err := evaluateFile(file, environment.NewEnvironment(xShared.XelRootEnv))
+	report.Duration = time.Since(start)
+	report.Results = xTest.Results()
+
+	if err != nil {
+		report.Err = err
+		if len(dbgr.Snapshots) > 0 {
+			report.Stack = dbgr.Snapshots[0].Stack
+		}
+	}
+	// Do not let the snapshots of one file leak into the next one
+	dbgr.Snapshots = dbgr.Snapshots[:0]
+
+	return report
+}
+
+func printTestFileReport(report testFileReport, cwd string) {
+	relPath := report.Path
+	if rel, err := filepath.Rel(cwd, report.Path); err == nil {
+		relPath = rel
+	}
+
+	failed := report.Err != nil
+	for _, result := range report.Results {
+		if result.Status == xTest.Failed {
+			failed = true
+		}
+	}
+
+	if failed {
+		xShared.ColorPalette.Error.Printf("FAIL %s", relPath)
+	} else {
+		xShared.ColorPalette.Info.Printf("PASS %s", relPath)
+	}
+	xShared.ColorPalette.GrayMessage.Printf(" (%s)\n", report.Duration.Round(time.Millisecond))
+
+	for _, result := range report.Results {
+		switch result.Status {
+		case xTest.Passed:
+			xShared.ColorPalette.Info.Printf("  ✓ %s", result.FullName())
+			xShared.ColorPalette.GrayMessage.Printf(" (%s)\n", result.Duration.Round(time.Millisecond))
+		case xTest.Skipped:
+			xShared.ColorPalette.Warning.Printf("  - %s (skipped)\n", result.FullName())
+		case xTest.Failed:
+			xShared.ColorPalette.Error.Printf("  ✗ %s\n", result.FullName())
+			xShared.ColorPalette.Error.Printf("    %s\n", result.Message)
+			printIndented(helpers.GenerateStackTrace(result.Stack, cwd), "    ")
+		}
+	}
+
+	if report.Err != nil {
+		xShared.ColorPalette.Error.Printf("  Test file aborted: %s\n", report.Err.Error())
+		if len(report.Stack) > 0 {
+			printIndented(helpers.GenerateStackTrace(report.Stack, cwd), "    ")
+		}
+	}
+}
+
+func printIndented(text, indent string) {
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		fmt.Println(indent + line)
+	}
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// writeJUnitReport writes the reports as JUnit XML, with one test suite per test file
+func writeJUnitReport(path string, reports []testFileReport, cwd string) error {
+	seconds := func(d time.Duration) string {
+		return fmt.Sprintf("%.3f", d.Seconds())
+	}
+	// Stack traces are written without colors
+	plainStackTrace := func(stack debugger.CallStack) string {
+		out := ""
+		for i := len(stack) - 1; i >= 0; i-- {
+			fname := stack[i].Filename
+			if rel, err := filepath.Rel(cwd, fname); err == nil {
+				fname = rel
+			}
+			out += fmt.Sprintf("at %s (%s:%d)\n", stack[i].Name, fname, stack[i].Line)
+		}
+		return out
+	}
+
+	doc := junitTestSuites{}
+	var total time.Duration
+
+	for _, report := range reports {
+		name := report.Path
+		if rel, err := filepath.Rel(cwd, report.Path); err == nil {
+			name = rel
+		}
+
+		suite := junitTestSuite{Name: name, Time: seconds(report.Duration)}
+		for _, result := range report.Results {
+			tc := junitTestCase{
+				Name:      result.FullName(),
+				Classname: name,
+				Time:      seconds(result.Duration),
+			}
+			switch result.Status {
+			case xTest.Failed:
+				tc.Failure = &junitProblem{Message: result.Message, Body: plainStackTrace(result.Stack)}
+				suite.Failures++
+			case xTest.Skipped:
+				tc.Skipped = &struct{}{}
+				suite.Skipped++
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+
+		if report.Err != nil {
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      "(file)",
+				Classname: name,
+				Time:      seconds(report.Duration),
+				Error:     &junitProblem{Message: report.Err.Error(), Body: plainStackTrace(report.Stack)},
+			})
+			suite.Errors++
+		}
+
+		suite.Tests = len(suite.Cases)
+		doc.Tests += suite.Tests
+		doc.Failures += suite.Failures
+		doc.Errors += suite.Errors
+		doc.Skipped += suite.Skipped
+		total += report.Duration
+		doc.Suites = append(doc.Suites, suite)
+	}
+	doc.Time = seconds(total)
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(path, append([]byte(xml.Header), append(out, '\n')...), 0644)
+}
@@ -0,0 +1,155 @@
+package cmds
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dev-kas/xel/globals"
+	"github.com/dev-kas/xel/helpers"
+
+	xShared "github.com/dev-kas/xel/shared"
+)
+
+// How often the watched files are checked for changes. Polling works the same
+// on every platform, and a project has few enough files for it to stay cheap.
+const watchInterval = 200 * time.Millisecond
+
+// How long the watched files must stay unchanged after a change before the
+// script restarts, so that saving several files at once restarts it only once
+const watchDebounce = 300 * time.Millisecond
+
+// fileStamp is what the watcher compares to notice that a file changed
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// statFile returns the stamp of the file at path, which may not exist
+func statFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// watchedFiles returns the files a run of the script at filename depends on: the
+// script, the manifest at manifestPath if any, and the modules it imported so far
+func watchedFiles(filename, manifestPath string) []string {
+	files := []string{filename}
+	if manifestPath != "" {
+		files = append(files, manifestPath)
+	}
+	files = append(files, globals.ImportedFiles()...)
+	return files
+}
+
+// changedFiles updates stamps with the current state of files, and returns the
+// files whose stamp changed. Files seen for the first time are only recorded.
+func changedFiles(files []string, stamps map[string]fileStamp) []string {
+	changed := []string{}
+	for _, file := range files {
+		stamp := statFile(file)
+		previous, known := stamps[file]
+		stamps[file] = stamp
+		if known && stamp != previous {
+			changed = append(changed, file)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// watchScript runs the script at filename like runScript, and runs it again
+// whenever one of its files changes, interrupting the run that is in progress.
+// The manifest is read again before each restart. It runs until a signal
+// arrives on stop, such as Ctrl-C.
+func watchScript(filename string, manifest *xShared.ProjectManifest, manifestPath string, rawArgs []string, stop <-chan os.Signal) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	helpers.EnableInterrupts()
+
+	for {
+		stamps := map[string]fileStamp{}
+		changedFiles(watchedFiles(filename, manifestPath), stamps)
+
+		done := make(chan error, 1)
+		if manifest != nil {
+			go func() {
+				done <- runScript(filename, manifest, rawArgs)
+			}()
+		}
+		running := manifest != nil
+
+		// Wait for a change, reporting how the run ends if it ends first
+		var changed []string
+		for len(changed) == 0 {
+			select {
+			case err := <-done:
+				running = false
+				if err != nil {
+					xShared.ColorPalette.Error.Println(err.Error())
+				}
+				xShared.ColorPalette.GrayMessage.Println("Waiting for changes...")
+			case <-stop:
+				if running {
+					helpers.InterruptEvaluation(func() { <-done })
+				}
+				return nil
+			case <-time.After(watchInterval):
+				changed = changedFiles(watchedFiles(filename, manifestPath), stamps)
+			}
+		}
+
+		// Let rapid edits settle before restarting
+		for {
+			time.Sleep(watchDebounce)
+			if len(changedFiles(watchedFiles(filename, manifestPath), stamps)) == 0 {
+				break
+			}
+		}
+
+		if running {
+			helpers.InterruptEvaluation(func() { <-done })
+		}
+		globals.ResetImports()
+
+		names := make([]string, len(changed))
+		for i, file := range changed {
+			names[i] = file
+			if rel, err := filepath.Rel(cwd, file); err == nil {
+				names[i] = rel
+			}
+		}
+		xShared.ColorPalette.GrayMessage.Printf("Restarting, %s changed\n", joinNames(names))
+
+		// A broken manifest is reported, and the script waits for it to be fixed
+		manifest, _, err = loadManifest(filepath.Dir(filename))
+		if err != nil {
+			xShared.ColorPalette.Error.Println(err.Error())
+			manifest = nil
+		}
+	}
+}
+
+// joinNames lists names for a message, such as `a, b and c`
+func joinNames(names []string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0]
+	}
+	last := len(names) - 1
+	list := names[0]
+	for _, name := range names[1:last] {
+		list += ", " + name
+	}
+	return list + " and " + names[last]
+}
@@ -0,0 +1,88 @@
+package cmds
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dev-kas/xel/globals"
+	xShared "github.com/dev-kas/xel/shared"
+)
+
+func TestWatchScript(t *testing.T) {
+	globals.Globalize(xShared.XelRootEnv)
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "main.xel")
+	writeScript := func(run string) {
+		t.Helper()
+		// Runs never end on their own, so each one has to be interrupted
+		src := "print(\"started " + run + "\")\nwhile (true) {}\n"
+		if err := os.WriteFile(script, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeScript("first")
+
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = stdoutWriter
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		stdoutWriter.Close()
+		stdoutReader.Close()
+	})
+
+	lines := make(chan string, 64)
+	go func() {
+		scanner := bufio.NewScanner(stdoutReader)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	expect := func(want string) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case line := <-lines:
+				if strings.Contains(line, want) {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for %q", want)
+			}
+		}
+	}
+
+	manifest, manifestPath, err := loadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- watchScript(script, manifest, manifestPath, nil, stop)
+	}()
+
+	expect("started first")
+	writeScript("second")
+	expect("started second")
+
+	// Watching only ends once the run in progress returned
+	stop <- os.Interrupt
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("watchScript failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watchScript did not return after Ctrl-C")
+	}
+}
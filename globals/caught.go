@@ -0,0 +1,36 @@
+package globals
+
+import (
+	"github.com/dev-kas/xel/helpers"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Caught exchanges the object that `catch` declares for the error value that was
+// raised. helpers.RewriteCatches adds its calls to every catch block.
+var Caught = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) != 1 {
+		return nil, &errors.RuntimeError{Message: "__caught__() takes exactly one argument"}
+	}
+
+	caught := helpers.CaughtError(args[0])
+	return &caught, nil
+})
+
+// Try starts a try block for helpers.EnterTry. helpers.RewriteCatches adds its
+// calls to every try block.
+var Try = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	helpers.EnterTry()
+	result := values.MK_NIL()
+	return &result, nil
+})
+
+// Tried ends a try block that ran without an error for helpers.LeaveTry
+var Tried = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	helpers.LeaveTry()
+	result := values.MK_NIL()
+	return &result, nil
+})
@@ -4,6 +4,7 @@ import (
 	"math"
 	"path/filepath"
 
+	"github.com/dev-kas/xel/helpers"
 	xShared "github.com/dev-kas/xel/shared"
 
 	"github.com/dev-kas/virtlang-go/v4/environment"
@@ -27,4 +28,8 @@ func Globalize(env *environment.Environment) {
 
 	env.DeclareVar("proc", Proc(), false)
 	env.DeclareVar("throw", Throw, false)
+	env.DeclareVar(helpers.StepFunctionName, Step, true)
+	env.DeclareVar(helpers.TryFunctionName, Try, true)
+	env.DeclareVar(helpers.TriedFunctionName, Tried, true)
+	env.DeclareVar(helpers.CaughtFunctionName, Caught, true)
 }
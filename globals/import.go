@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	// Internal imports
 	"github.com/dev-kas/xel/helpers"
@@ -35,6 +36,34 @@ var importCache = map[string]*shared.RuntimeValue{}
 // This helps in providing meaningful error messages for circular dependencies.
 var resolvingImports = map[string]bool{}
 
+// importsMu guards importCache and resolvingImports, which `xel run --watch`
+// reads and resets while scripts are running.
+var importsMu sync.Mutex
+
+// ImportedFiles returns the absolute paths of the module files imported so far,
+// including the ones still being evaluated.
+func ImportedFiles() []string {
+	importsMu.Lock()
+	defer importsMu.Unlock()
+
+	files := make([]string, 0, len(importCache))
+	for libpath := range importCache {
+		files = append(files, libpath)
+	}
+	return files
+}
+
+// ResetImports forgets every imported module, so that importing them again
+// evaluates their files anew. Imports that are still running keep the cache
+// they started with, so that an interrupted evaluation cannot fill the new one.
+func ResetImports() {
+	importsMu.Lock()
+	defer importsMu.Unlock()
+
+	importCache = map[string]*shared.RuntimeValue{}
+	resolvingImports = map[string]bool{}
+}
+
 // Import is the native function implementation for the `import` statement in Xel.
 // It handles module resolution, caching, and circular dependency detection.
 //
@@ -90,11 +119,15 @@ var Import = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environme
 	// Local imports start with './' or '../'
 	if libname[0] == '.' {
 		// Handle local file import (relative to current file)
-		// Get the directory of the current file from the debugger context
-		dirname := filepath.Dir(xShared.XelRootDebugger.CurrentFile)
-
-		// Resolve the full path to the target module
-		libpath = filepath.Join(dirname, libpath)
+		// The current file is known from the debugger context
+		libpath, _, _ = helpers.ResolveImport(libname, xShared.XelRootDebugger.CurrentFile, nil)
+
+		// The modules of a package see the package's process object, with its own
+		// manifest, so that its dependencies, and not the project's, apply to them too
+		rootProcess, _ := xShared.XelRootEnv.LookupVar("proc")
+		if processRuntimeVal, err := env.LookupVar("proc"); err == nil && processRuntimeVal != rootProcess {
+			modEnv.DeclareVar("proc", *processRuntimeVal, true)
+		}
 	} else {
 		// Handle package import (from node_modules or package registry)
 
@@ -146,92 +179,87 @@ var Import = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environme
 				Message: "Project manifest is missing or has invalid 'dependencies' section",
 			}
 		}
-		dependencies := depsVal.Value.(map[string]*shared.RuntimeValue)
 
-		// Verify the requested package is in the dependencies
-		pkgConstraint, exists := dependencies[libname]
-		if !exists {
+		// Dev dependencies are only installed for the root project, so only its own scripts may import them
+		rootProcess, _ := xShared.XelRootEnv.LookupVar("proc")
+		isRootProject := processRuntimeVal == rootProcess
+		if devDeps := manifestDeps(manifest, "devDeps"); !isRootProject && devDeps[libname] != "" {
 			return nil, &errors.RuntimeError{
-				Message: fmt.Sprintf("Package '%s' is not listed in the project's dependencies", libname),
+				Message: fmt.Sprintf("Package '%s' is a dev dependency, which only the project listing it can import", libname),
 			}
 		}
 
-		// Extract the version constraint
-		constraint := pkgConstraint.Value.(string)
+		// Collect the version constraints of the packages the module may import:
+		// its dependencies, and its peer dependencies, which its project provides
+		deps := map[string]string{}
+		kinds := []string{"peerDeps", "optionalDeps", "deps"}
+		if isRootProject {
+			kinds = append(kinds, "devDeps")
+		}
+		for _, kind := range kinds {
+			for depName, depConstraint := range manifestDeps(manifest, kind) {
+				deps[depName] = depConstraint
+			}
+		}
 
-		// Resolve the module using the package manager to get its actual location
-		pkgManifestPath, pkgManifest, resolutionErr := helpers.ResolveModuleLocal(libname, constraint)
+		// Verify the requested package is in the dependencies, and resolve its
+		// actual location using the package manager
+		pkgEntryPath, pkgManifest, resolutionErr := helpers.ResolveImport(libname, xShared.XelRootDebugger.CurrentFile, deps)
 		if resolutionErr != nil {
 			return nil, &errors.RuntimeError{
-				Message: fmt.Sprintf("Failed to resolve package '%s' (constraint: %s): %v",
-					libname, constraint, resolutionErr),
+				Message: resolutionErr.Error(),
 			}
 		}
-
-		// Convert the resolved package manifest into a runtime-compatible format
-		// This ensures the imported module has access to the correct manifest information
-		manifestConverted := map[string]*shared.RuntimeValue{}
-
-		// Helper to store string values in the manifest
-		addStringField := func(key, value string) {
-			val := values.MK_STRING(value)
-			manifestConverted[key] = &val
-		}
-
-		// Convert each manifest field to a runtime string value
-		addStringField("name", pkgManifest.Name)
-		addStringField("description", pkgManifest.Description)
-		addStringField("version", pkgManifest.Version)
-		addStringField("xel", *pkgManifest.Xel)
-		addStringField("engine", *pkgManifest.Engine)
-		addStringField("main", pkgManifest.Main)
-		addStringField("author", pkgManifest.Author)
-		addStringField("license", pkgManifest.License)
-
-		// Convert dependencies map to runtime format
-		depsMap := make(map[string]*shared.RuntimeValue, len(*pkgManifest.Deps))
-		for depName, depConstraint := range *pkgManifest.Deps {
-			depVal := values.MK_STRING(depConstraint)
-			depsMap[depName] = &depVal
+		// Only imports made by running scripts count as a use, for `xel pkg cache`
+		if pkgDir, ok := helpers.PackageDir(pkgEntryPath, pkgManifest); ok {
+			helpers.TouchPackage(pkgDir)
 		}
-		depsObj := values.MK_OBJECT(depsMap)
-		manifestConverted["deps"] = &depsObj
 
 		// Create a deep copy of the process object to avoid modifying the original
 		modifiedProc := helpers.DeepCopyObject(processRuntimeVal.Value.(map[string]*shared.RuntimeValue))
 
-		// Create a new manifest value with the converted package manifest
-		manifestVal := values.MK_OBJECT(manifestConverted)
+		// Replace the manifest with the package's own, converted to a runtime-compatible format
+		manifestVal := helpers.ManifestToObject(pkgManifest)
 		modifiedProc["manifest"] = &manifestVal
 
 		// Update the module's environment with the modified process object
 		// This ensures the imported module sees itself with its own manifest
 		modEnv.DeclareVar("proc", values.MK_OBJECT(modifiedProc), true)
 
-		// Resolve the full path to the package's main entry point
-		pkgPath := filepath.Dir(pkgManifestPath)
-		libpath = filepath.Join(pkgPath, pkgManifest.Main)
+		// Load the package's main entry point
+		libpath = pkgEntryPath
 	}
 
+	// The maps are only read here, so that ResetImports does not affect this import
+	importsMu.Lock()
+	cache, resolving := importCache, resolvingImports
+
 	// Check for circular dependencies before proceeding with the import
-	if resolvingImports[libpath] {
+	if resolving[libpath] {
+		importsMu.Unlock()
 		return nil, &errors.RuntimeError{
 			Message: fmt.Sprintf("Circular import detected while importing '%s'", libpath),
 		}
 	}
 
 	// Return cached module if available and caching is enabled
-	if val, exists := importCache[libpath]; exists && useCache {
+	if val, exists := cache[libpath]; exists && useCache {
+		importsMu.Unlock()
 		return val, nil
 	}
 
 	// Mark this module as being imported to detect circular dependencies
-	resolvingImports[libpath] = true
+	resolving[libpath] = true
+	importsMu.Unlock()
 	// Ensure we clean up the resolvingImports map when done
-	defer delete(resolvingImports, libpath)
+	defer func() {
+		importsMu.Lock()
+		delete(resolving, libpath)
+		importsMu.Unlock()
+	}()
 
 	// Evaluate the module and get its exports
-	libExports, err := evaluateModule(libpath, modEnv)
+	libExports, err := evaluateModule(libpath, modEnv, cache)
 	if err != nil {
 		return nil, err
 	}
@@ -245,11 +273,12 @@ var Import = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environme
 // Parameters:
 //   - libpath: The absolute path to the module file to evaluate
 //   - env: The parent environment to inherit from
+//   - cache: The import cache to record the module's exports in
 //
 // Returns:
 //   - The module's exports as a RuntimeValue
 //   - An error if any step of the evaluation fails
-func evaluateModule(libpath string, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+func evaluateModule(libpath string, env *environment.Environment, cache map[string]*shared.RuntimeValue) (*shared.RuntimeValue, *errors.RuntimeError) {
 	// Read the module source code
 	content, readErr := os.ReadFile(libpath)
 	if readErr != nil {
@@ -266,6 +295,9 @@ func evaluateModule(libpath string, env *environment.Environment) (*shared.Runti
 			Message: fmt.Sprintf("Syntax error in '%s': %v", libpath, parserError),
 		}
 	}
+	// Let a step hook stop the module between statements, and catch blocks receive error values
+	helpers.InstrumentSteps(lib)
+	helpers.RewriteCatches(lib)
 
 	// Create a new scope for this module, inheriting from the parent
 	libScope := environment.NewEnvironment(env)
@@ -280,7 +312,9 @@ func evaluateModule(libpath string, env *environment.Environment) (*shared.Runti
 
 	// Add a placeholder to the cache to handle circular references
 	placeholderExports := values.MK_NIL()
-	importCache[libpath] = &placeholderExports
+	importsMu.Lock()
+	cache[libpath] = &placeholderExports
+	importsMu.Unlock()
 
 	// Evaluate the module's AST in the new scope
 	libExports, evaluatorError := evaluator.Evaluate(
@@ -297,7 +331,25 @@ func evaluateModule(libpath string, env *environment.Environment) (*shared.Runti
 	}
 
 	// Update the cache with the actual exports
-	importCache[libpath] = libExports
+	importsMu.Lock()
+	cache[libpath] = libExports
+	importsMu.Unlock()
 
 	return libExports, nil
 }
+
+// manifestDeps returns the version constraints of a kind of dependencies
+// (`deps`, `devDeps`, ...) of a manifest object; the kind may be missing
+func manifestDeps(manifest map[string]*shared.RuntimeValue, kind string) map[string]string {
+	deps := map[string]string{}
+	kindVal, exists := manifest[kind]
+	if !exists || kindVal == nil || kindVal.Type != shared.Object {
+		return deps
+	}
+	for depName, depConstraint := range kindVal.Value.(map[string]*shared.RuntimeValue) {
+		if depConstraint != nil && depConstraint.Type == shared.String {
+			deps[depName] = depConstraint.Value.(string)
+		}
+	}
+	return deps
+}
@@ -0,0 +1,24 @@
+package globals
+
+import (
+	"github.com/dev-kas/xel/helpers"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Step runs the step hook before a statement, given its file and line.
+// helpers.InstrumentSteps adds its calls to every statement.
+var Step = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) != 2 || args[0].Type != shared.String || args[1].Type != shared.Number {
+		return nil, &errors.RuntimeError{Message: "__step__() takes a file and a line"}
+	}
+
+	if err := helpers.RunStepHook(env, args[0].Value.(string), int(args[1].Value.(float64))); err != nil {
+		return nil, err
+	}
+	result := values.MK_NIL()
+	return &result, nil
+})
@@ -1,7 +1,7 @@
 package globals
 
 import (
-	"fmt"
+	"github.com/dev-kas/xel/helpers"
 
 	"github.com/dev-kas/virtlang-go/v4/environment"
 	"github.com/dev-kas/virtlang-go/v4/errors"
@@ -9,17 +9,13 @@ import (
 	"github.com/dev-kas/virtlang-go/v4/values"
 )
 
+// Throw raises an error: a message, or an error value, which is an object or a
+// class instance with a `name`, `message`, `code` and `cause`. `catch` receives
+// the error value, along with the `stack` where it was thrown.
 var Throw = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
 	if len(args) != 1 {
 		return nil, &errors.RuntimeError{Message: "throw() takes exactly one argument"}
 	}
 
-	if args[0].Type != shared.String {
-		return nil, &errors.RuntimeError{
-			Message: fmt.Sprintf("throw() takes a string as an argument, but got %s", shared.Stringify(args[0].Type)),
-		}
-	}
-
-	out := args[0].Value.(string)
-	return nil, &errors.RuntimeError{Message: out}
+	return nil, helpers.RaiseError(args[0])
 })
@@ -0,0 +1,186 @@
+package helpers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// bundleMagic marks the end of an executable that carries a bundle. A bundle is a
+// tar.gz archive appended to the xel executable, followed by its size as a
+// big-endian uint64 and this magic.
+const bundleMagic = "XELBUNDLE\x00\x00\x01"
+
+const bundleFooterSize = 8 + len(bundleMagic)
+
+// BundleFile is a file to embed in a bundle
+type BundleFile struct {
+	// Name is the slash-separated path of the file inside the bundle
+	Name string
+	// Path is the path of the file on disk
+	Path string
+}
+
+// readBundleFooter returns the size of the bundle appended to f, or 0 when f
+// carries none, along with the size of f itself
+func readBundleFooter(f *os.File) (int64, int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	size := info.Size()
+	if size < int64(bundleFooterSize) {
+		return 0, size, nil
+	}
+
+	footer := make([]byte, bundleFooterSize)
+	if _, err := f.ReadAt(footer, size-int64(bundleFooterSize)); err != nil {
+		return 0, size, err
+	}
+	if string(footer[8:]) != bundleMagic {
+		return 0, size, nil
+	}
+
+	payloadSize := int64(binary.BigEndian.Uint64(footer[:8]))
+	if payloadSize <= 0 || payloadSize > size-int64(bundleFooterSize) {
+		return 0, size, fmt.Errorf("corrupted bundle in %s", f.Name())
+	}
+	return payloadSize, size, nil
+}
+
+// WriteBundle writes a copy of the running executable with files appended to it
+// to output, so that the result runs them on its own
+func WriteBundle(output string, files []BundleFile) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot locate the xel executable: %v", err)
+	}
+
+	self, err := os.Open(executable)
+	if err != nil {
+		return err
+	}
+	defer self.Close()
+
+	// When running from a bundle, only copy the runtime and leave its own payload out
+	payloadSize, size, err := readBundleFooter(self)
+	if err != nil {
+		return err
+	}
+	runtimeSize := size
+	if payloadSize > 0 {
+		runtimeSize -= payloadSize + int64(bundleFooterSize)
+	}
+
+	// Archive the files first
+	var payload bytes.Buffer
+	gzw := gzip.NewWriter(&payload)
+	tw := tar.NewWriter(gzw)
+	for _, file := range files {
+		content, err := os.ReadFile(file.Path)
+		if err != nil {
+			return err
+		}
+
+		header := &tar.Header{
+			Name:     file.Name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gzw.Close(); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, io.NewSectionReader(self, 0, runtimeSize)); err != nil {
+		return err
+	}
+	if _, err := out.Write(payload.Bytes()); err != nil {
+		return err
+	}
+
+	footer := make([]byte, 8, bundleFooterSize)
+	binary.BigEndian.PutUint64(footer, uint64(payload.Len()))
+	footer = append(footer, bundleMagic...)
+	if _, err := out.Write(footer); err != nil {
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+	// Make sure the result is executable even if output already existed
+	return os.Chmod(output, 0755)
+}
+
+// OpenBundle extracts the bundle appended to the running executable into a new
+// temporary directory and returns its path. It returns an empty path when the
+// executable does not carry a bundle. The caller is responsible for removing
+// the directory.
+func OpenBundle() (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", nil
+	}
+
+	self, err := os.Open(executable)
+	if err != nil {
+		return "", nil
+	}
+	defer self.Close()
+
+	payloadSize, size, err := readBundleFooter(self)
+	if err != nil || payloadSize == 0 {
+		return "", err
+	}
+
+	dir, err := os.MkdirTemp("", "xel-bundle-")
+	if err != nil {
+		return "", err
+	}
+
+	// Copy the payload out so it can be extracted like any other tarball
+	archivePath := filepath.Join(dir, "bundle.tar.gz")
+	archive, err := os.Create(archivePath)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	payload := io.NewSectionReader(self, size-int64(bundleFooterSize)-payloadSize, payloadSize)
+	_, err = io.Copy(archive, payload)
+	archive.Close()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	err = ExtractTarGz(archivePath, dir)
+	os.Remove(archivePath)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("cannot extract bundle: %v", err)
+	}
+
+	return dir, nil
+}
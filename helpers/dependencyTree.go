@@ -0,0 +1,163 @@
+package helpers
+
+import (
+	"github.com/dev-kas/xel/shared"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// DependencyNode is a package in the dependency tree of a project, as installed
+type DependencyNode struct {
+	Name        string            `json:"name"`
+	Version     string            `json:"version,omitempty"`     // Empty when no version is installed
+	Constraint  string            `json:"constraint,omitempty"`  // What the parent requires, empty for the project
+	Dev         bool              `json:"dev,omitempty"`         // A dev dependency of the project
+	Optional    bool              `json:"optional,omitempty"`    // An optional dependency, which may be missing
+	Missing     bool              `json:"missing,omitempty"`     // No version is installed
+	Unsatisfied bool              `json:"unsatisfied,omitempty"` // The installed version does not satisfy Constraint
+	Deduped     bool              `json:"deduped,omitempty"`     // Its dependencies are listed where it first appears
+	Deps        []*DependencyNode `json:"deps,omitempty"`
+}
+
+// dependencyEdge is a dependency of an installed package, with the manifest it resolved to
+type dependencyEdge struct {
+	node     DependencyNode
+	manifest *shared.ProjectManifest // Nil when Missing
+}
+
+// dependencyGraph finds the installed packages a project depends on. The
+// versions recorded in the lockfile are preferred, so that the graph is the one
+// that was resolved, and the newest installed version satisfying the constraint
+// is used otherwise.
+type dependencyGraph struct {
+	lockfile *shared.Lockfile
+	edges    map[string][]dependencyEdge
+}
+
+// newDependencyGraph prepares the graph of a project, whose lockfile may be nil
+func newDependencyGraph(lockfile *shared.Lockfile) *dependencyGraph {
+	if lockfile == nil {
+		lockfile = shared.NewLockfile()
+	}
+	return &dependencyGraph{lockfile: lockfile, edges: map[string][]dependencyEdge{}}
+}
+
+// dependencies returns the dependencies of the package at key, whose manifest is
+// given, in order; the key of the project is empty
+func (g *dependencyGraph) dependencies(key string, manifest *shared.ProjectManifest) []dependencyEdge {
+	if edges, ok := g.edges[key]; ok {
+		return edges
+	}
+
+	edges := []dependencyEdge{}
+	deps := manifest.InstalledDeps(key == "")
+	for _, name := range sortedKeys(deps) {
+		edge := g.resolve(key, name, deps[name])
+		edge.node.Dev = key == "" && manifest.IsDev(name)
+		edge.node.Optional = manifest.IsOptional(name)
+		edges = append(edges, edge)
+	}
+	g.edges[key] = edges
+	return edges
+}
+
+// resolve finds the installed version of a dependency of the package at key
+func (g *dependencyGraph) resolve(key, name, spec string) dependencyEdge {
+	edge := dependencyEdge{node: DependencyNode{Name: name, Constraint: spec}}
+
+	if locked := g.lockfile.Locked(key, name); locked != nil {
+		if version, err := semver.NewVersion(locked.Version); err == nil {
+			if data, installed := findInstalled(name, version); installed {
+				edge.manifest = data.manifest
+				edge.node.Unsatisfied = !LockedSatisfies(locked, spec)
+			}
+		}
+	}
+
+	if edge.manifest == nil {
+		if _, manifest, err := ResolveModuleLocal(name, spec); err == nil {
+			edge.manifest = manifest
+		} else {
+			// Show the newest version that is installed, even though it does not fit
+			var newest *semver.Version
+			for version, data := range GetVersions(name) {
+				if newest == nil || version.GreaterThan(newest) {
+					newest, edge.manifest = version, data.manifest
+				}
+			}
+			edge.node.Unsatisfied = edge.manifest != nil
+		}
+	}
+
+	if edge.manifest == nil {
+		edge.node.Missing = true
+	} else {
+		edge.node.Version = edge.manifest.Version
+	}
+	return edge
+}
+
+// DependencyTree returns the tree of the installed packages a project depends
+// on, given its manifest and lockfile, which may be nil. A package that appears
+// more than once only lists its dependencies the first time. Dev dependencies
+// are only part of it for the project, like when they are installed.
+func DependencyTree(manifest *shared.ProjectManifest, lockfile *shared.Lockfile) *DependencyNode {
+	graph := newDependencyGraph(lockfile)
+	root := &DependencyNode{Name: manifest.Name, Version: manifest.Version}
+	graph.expand(root, "", manifest, map[string]bool{})
+	return root
+}
+
+// expand adds the dependencies of the package at key to its node
+func (g *dependencyGraph) expand(node *DependencyNode, key string, manifest *shared.ProjectManifest, seen map[string]bool) {
+	for _, edge := range g.dependencies(key, manifest) {
+		child := edge.node
+		node.Deps = append(node.Deps, &child)
+		if child.Missing {
+			continue
+		}
+
+		childKey := shared.LockKey(child.Name, child.Version)
+		if seen[childKey] {
+			child.Deduped = true
+			continue
+		}
+		seen[childKey] = true
+		g.expand(&child, childKey, edge.manifest, seen)
+	}
+}
+
+// DependencyPaths returns every path from a project to the installed versions of
+// the package name, given its manifest and lockfile, which may be nil. Paths
+// start with the project and end with the package; their nodes have no Deps.
+func DependencyPaths(manifest *shared.ProjectManifest, lockfile *shared.Lockfile, name string) [][]*DependencyNode {
+	graph := newDependencyGraph(lockfile)
+	root := &DependencyNode{Name: manifest.Name, Version: manifest.Version}
+
+	paths := [][]*DependencyNode{}
+	var walk func(path []*DependencyNode, key string, manifest *shared.ProjectManifest, onPath map[string]bool)
+	walk = func(path []*DependencyNode, key string, manifest *shared.ProjectManifest, onPath map[string]bool) {
+		for _, edge := range graph.dependencies(key, manifest) {
+			child := edge.node
+			childPath := append(append([]*DependencyNode{}, path...), &child)
+			if child.Name == name {
+				paths = append(paths, childPath)
+			}
+			if child.Missing {
+				continue
+			}
+
+			// Cycles are followed once
+			childKey := shared.LockKey(child.Name, child.Version)
+			if onPath[childKey] {
+				continue
+			}
+			onPath[childKey] = true
+			walk(childPath, childKey, edge.manifest, onPath)
+			delete(onPath, childKey)
+		}
+	}
+	walk([]*DependencyNode{root}, "", manifest, map[string]bool{})
+
+	return paths
+}
@@ -0,0 +1,386 @@
+package helpers
+
+import (
+	errors_ "errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/dev-kas/virtlang-go/v4/ast"
+	"github.com/dev-kas/virtlang-go/v4/debugger"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Errors raised by `throw` and by native modules carry an error value: an object
+// with the `name`, `message`, `code`, `cause` and `stack` of the error, or the
+// class instance that was thrown. The evaluator only passes the message of an
+// error to `catch`, and drops the runtime error itself, so the values of the
+// errors raised inside a try block are kept here until they are caught, and
+// RewriteCatches makes every catch block exchange the message for the value
+// with `__caught__`.
+//
+// An error is raised and caught on the goroutine evaluating the script, so the
+// values are kept apart for each goroutine, and a thread cannot catch the error
+// of another. Within a goroutine, the message is all that ties a catch block to
+// a value: the most recent error with that message is the one it receives. An
+// error with the same message that the evaluator raised itself after it, which
+// has no value, is therefore caught with the value of the earlier one.
+
+// maxRaisedErrors bounds the errors kept for a `catch` by each goroutine, as a
+// try block may raise many errors that it does not catch itself
+const maxRaisedErrors = 64
+
+// raisedError is an error value waiting to be caught
+type raisedError struct {
+	message string // The message of the runtime error that raised it
+	value   shared.RuntimeValue
+}
+
+// tryState is what a goroutine keeps while it runs try blocks
+type tryState struct {
+	snapshots []int         // Number of snapshots before each try block that is running, innermost last
+	raised    []raisedError // Errors raised in them, most recent last
+}
+
+var tryMu sync.Mutex
+var tryStates = map[int64]*tryState{} // By goroutine, while it runs a try block
+
+// The globals that RewriteCatches calls: TryFunctionName when a try block
+// starts, TriedFunctionName when it ends without an error, and
+// CaughtFunctionName when a catch block starts
+const (
+	TryFunctionName    = "__try__"
+	TriedFunctionName  = "__tried__"
+	CaughtFunctionName = "__caught__"
+)
+
+// caughtVarPrefix starts the name a catch block receives the evaluator's error object under
+const caughtVarPrefix = "__caught_"
+
+// RaiseError returns the runtime error that raises value, which is a string, an
+// object or a class instance. Strings become the message of an error object.
+// Objects get the name `Error`, a nil code and cause, and the current stack when
+// they do not have them; class instances are raised as they are, and have their
+// public `stack` set if it is nil.
+func RaiseError(value shared.RuntimeValue) *errors.RuntimeError {
+	switch value.Type {
+	case shared.String:
+		return raise(newErrorObject("Error", "", value.Value.(string), nil))
+
+	case shared.Object:
+		fields := value.Value.(map[string]*shared.RuntimeValue)
+		if message, ok := fields["message"]; ok && message != nil && message.Type != shared.String && message.Type != shared.Nil {
+			return &errors.RuntimeError{Message: fmt.Sprintf("the `message` of an error must be a string, but got %s", shared.Stringify(message.Type))}
+		}
+
+		// The thrown object is left untouched
+		errorFields := make(map[string]*shared.RuntimeValue, len(fields)+4)
+		for key, field := range fields {
+			errorFields[key] = field
+		}
+		defaults := map[string]shared.RuntimeValue{
+			"name":    values.MK_STRING("Error"),
+			"message": values.MK_STRING(""),
+			"code":    values.MK_NIL(),
+			"cause":   values.MK_NIL(),
+			"stack":   captureStack(),
+		}
+		for key, defaultValue := range defaults {
+			if field, ok := errorFields[key]; !ok || field == nil || (key != "code" && key != "cause" && field.Type == shared.Nil) {
+				defaultValue := defaultValue
+				errorFields[key] = &defaultValue
+			}
+		}
+		return raise(values.MK_OBJECT(errorFields))
+
+	case shared.ClassInstance:
+		instance := value.Value.(values.ClassInstanceValue)
+		if stack, ok := instance.Data.Variables["stack"]; ok && instance.Publics["stack"] && (stack == nil || stack.Type == shared.Nil) {
+			instance.Data.AssignVar("stack", captureStack())
+		}
+		return raise(value)
+
+	default:
+		return &errors.RuntimeError{Message: fmt.Sprintf("only strings, objects and class instances can be thrown, but got %s", shared.Stringify(value.Type))}
+	}
+}
+
+// NewError returns the runtime error that raises an error object with name,
+// code and message, for native functions. code may be empty.
+func NewError(name, code, message string) *errors.RuntimeError {
+	return raise(newErrorObject(name, code, message, nil))
+}
+
+// SystemError returns the runtime error for err, which a native function got
+// from the system. Errors of the file system and of programs get a code such as
+// `ENOENT`, and refused permissions are a `PermissionError` with the code `EPERMISSION`.
+func SystemError(err error) *errors.RuntimeError {
+	var permErr *xShared.PermissionError
+	if errors_.As(err, &permErr) {
+		return NewError("PermissionError", "EPERMISSION", err.Error())
+	}
+
+	codes := []struct {
+		target error
+		code   string
+	}{
+		{fs.ErrNotExist, "ENOENT"},
+		{exec.ErrNotFound, "ENOENT"},
+		{fs.ErrExist, "EEXIST"},
+		{fs.ErrPermission, "EACCES"},
+		{syscall.ENOTDIR, "ENOTDIR"},
+		{syscall.EISDIR, "EISDIR"},
+		{syscall.ENOTEMPTY, "ENOTEMPTY"},
+		{syscall.EXDEV, "EXDEV"},
+		{syscall.EBUSY, "EBUSY"},
+		{syscall.ENOSPC, "ENOSPC"},
+		{syscall.EROFS, "EROFS"},
+		{syscall.EMFILE, "EMFILE"},
+		{syscall.ENAMETOOLONG, "ENAMETOOLONG"},
+	}
+	for _, c := range codes {
+		if errors_.Is(err, c.target) {
+			return NewError("SystemError", c.code, err.Error())
+		}
+	}
+	return NewError("SystemError", "", err.Error())
+}
+
+// newErrorObject builds the error object of an error raised now
+func newErrorObject(name, code, message string, cause *shared.RuntimeValue) shared.RuntimeValue {
+	nameVal := values.MK_STRING(name)
+	messageVal := values.MK_STRING(message)
+	codeVal := values.MK_NIL()
+	if code != "" {
+		codeVal = values.MK_STRING(code)
+	}
+	causeVal := values.MK_NIL()
+	if cause != nil {
+		causeVal = *cause
+	}
+	stackVal := captureStack()
+
+	return values.MK_OBJECT(map[string]*shared.RuntimeValue{
+		"name":    &nameVal,
+		"message": &messageVal,
+		"code":    &codeVal,
+		"cause":   &causeVal,
+		"stack":   &stackVal,
+	})
+}
+
+// captureStack returns the current call stack of the root debugger, most recent
+// call last, in the form `catch` gives it
+func captureStack() shared.RuntimeValue {
+	frames := []shared.RuntimeValue{}
+	for _, frame := range xShared.XelRootDebugger.CallStack {
+		name := values.MK_STRING(frame.Name)
+		line := values.MK_NUMBER(float64(frame.Line))
+		file := values.MK_STRING(frame.Filename)
+		frames = append(frames, values.MK_OBJECT(map[string]*shared.RuntimeValue{
+			"name": &name,
+			"line": &line,
+			"file": &file,
+		}))
+	}
+	return values.MK_ARRAY(frames)
+}
+
+// raise keeps value until it is caught, and returns the runtime error raising it.
+// The message of the runtime error is the one printed if nothing catches it.
+func raise(value shared.RuntimeValue) *errors.RuntimeError {
+	name, message := errorField(value, "name"), errorField(value, "message")
+	if name != "" && name != "Error" {
+		if message == "" {
+			message = name
+		} else {
+			message = name + ": " + message
+		}
+	}
+
+	// Errors raised outside of any try block cannot be caught
+	tryMu.Lock()
+	defer tryMu.Unlock()
+	if state := tryStates[goroutineID()]; state != nil {
+		state.raised = append(state.raised, raisedError{message: message, value: value})
+		if len(state.raised) > maxRaisedErrors {
+			state.raised = state.raised[len(state.raised)-maxRaisedErrors:]
+		}
+	}
+	return &errors.RuntimeError{Message: message}
+}
+
+// goroutineID returns the ID of the calling goroutine, which the runtime only
+// gives in stack traces
+func goroutineID() int64 {
+	var buf [64]byte
+	trace := strings.TrimPrefix(string(buf[:runtime.Stack(buf[:], false)]), "goroutine ")
+	id, _ := strconv.ParseInt(trace[:strings.IndexByte(trace, ' ')], 10, 64)
+	return id
+}
+
+// errorField returns a string field of an error object or class instance
+func errorField(value shared.RuntimeValue, key string) string {
+	var field *shared.RuntimeValue
+	switch value.Type {
+	case shared.Object:
+		field = value.Value.(map[string]*shared.RuntimeValue)[key]
+	case shared.ClassInstance:
+		instance := value.Value.(values.ClassInstanceValue)
+		if instance.Publics[key] {
+			field = instance.Data.Variables[key]
+		}
+	}
+	if field == nil || field.Type != shared.String {
+		return ""
+	}
+	return field.Value.(string)
+}
+
+// The evaluator drops the snapshots of caught errors by cutting its snapshots
+// to the depth of the call stack at the try block, which fails when there are
+// fewer of them. EnterTry adds empty snapshots up to that depth, and LeaveTry
+// takes them out again once the try block is done. These writes hold tryMu, but
+// the evaluator writes the snapshots of the root debugger without a lock of its
+// own, so threads that fail at the same time may still mix up their snapshots.
+
+// EnterTry prepares the snapshots of the root debugger for a try block
+func EnterTry() {
+	tryMu.Lock()
+	defer tryMu.Unlock()
+
+	id := goroutineID()
+	state := tryStates[id]
+	if state == nil {
+		state = &tryState{}
+		tryStates[id] = state
+	}
+
+	dbgr := xShared.XelRootDebugger
+	state.snapshots = append(state.snapshots, len(dbgr.Snapshots))
+	for len(dbgr.Snapshots) < len(dbgr.CallStack) {
+		dbgr.Snapshots = append(dbgr.Snapshots, debugger.Snapshot{})
+	}
+}
+
+// LeaveTry removes the snapshots EnterTry added for the innermost try block of
+// the calling goroutine. Once its outermost one is done, the errors it kept are
+// forgotten.
+func LeaveTry() {
+	tryMu.Lock()
+	defer tryMu.Unlock()
+	leaveTry(goroutineID())
+}
+
+// leaveTry is LeaveTry for the goroutine id, with tryMu held
+func leaveTry(id int64) {
+	state := tryStates[id]
+	if state == nil {
+		return
+	}
+	count := state.snapshots[len(state.snapshots)-1]
+	state.snapshots = state.snapshots[:len(state.snapshots)-1]
+	if len(state.snapshots) == 0 {
+		delete(tryStates, id)
+	}
+
+	dbgr := xShared.XelRootDebugger
+	if len(dbgr.Snapshots) > count {
+		dbgr.Snapshots = dbgr.Snapshots[:count]
+	}
+}
+
+// CaughtError returns the error value of an error caught by `catch`, given the
+// object the evaluator declares in the catch block, which has the `message` and
+// `stack` of the error. Errors raised without a value, such as the ones of the
+// evaluator itself, get an error object named `Error`.
+func CaughtError(caught shared.RuntimeValue) shared.RuntimeValue {
+	message := ""
+	var fields map[string]*shared.RuntimeValue
+	if caught.Type == shared.Object {
+		fields = caught.Value.(map[string]*shared.RuntimeValue)
+		if messageVal, ok := fields["message"]; ok && messageVal != nil && messageVal.Type == shared.String {
+			message = messageVal.Value.(string)
+		}
+	}
+
+	// The error was raised in the try block being left, or in one it is nested in
+	tryMu.Lock()
+	id := goroutineID()
+	var value *shared.RuntimeValue
+	if state := tryStates[id]; state != nil && fields != nil {
+		for i := len(state.raised) - 1; i >= 0; i-- {
+			raised := state.raised[i]
+			// Errors that leave a module are prefixed with the module's path
+			if message == raised.message || strings.HasSuffix(message, "Runtime Error: "+raised.message) {
+				state.raised = append(state.raised[:i], state.raised[i+1:]...)
+				value = &raised.value
+				break
+			}
+		}
+	}
+	leaveTry(id)
+	tryMu.Unlock()
+
+	if fields == nil {
+		return caught
+	}
+	if value != nil {
+		return *value
+	}
+
+	errorObject := newErrorObject("Error", "", message, nil)
+	if stack, ok := fields["stack"]; ok && stack != nil {
+		errorObject.Value.(map[string]*shared.RuntimeValue)["stack"] = stack
+	}
+	return errorObject
+}
+
+// RewriteCatches makes the catch blocks of program receive error values: each
+// catch variable is declared by a call to `__caught__` with the object the
+// evaluator gives, which is declared under another name. Try blocks also start
+// with a call to `__try__` and end with one to `__tried__` (see EnterTry).
+func RewriteCatches(program *ast.Program) {
+	WalkAST(program, func(node ast.Stmt) bool {
+		tryCatch, ok := node.(*ast.TryCatchStmt)
+		if !ok || strings.HasPrefix(tryCatch.CatchVar, caughtVarPrefix) {
+			return true
+		}
+
+		// The new statements take the position of the catch block, which
+		// is what the debugger reports while they run
+		metadata := tryCatch.SourceMetadata
+		if len(tryCatch.Catch) > 0 {
+			metadata = tryCatch.Catch[0].GetSourceMetadata()
+		}
+
+		call := func(name string, metadata ast.SourceMetadata, args ...ast.Expr) *ast.CallExpr {
+			return &ast.CallExpr{
+				Callee:         &ast.Identifier{Symbol: name, SourceMetadata: metadata},
+				Args:           args,
+				SourceMetadata: metadata,
+			}
+		}
+		tryCatch.Try = append([]ast.Stmt{call(TryFunctionName, tryCatch.SourceMetadata)}, tryCatch.Try...)
+		tryCatch.Try = append(tryCatch.Try, call(TriedFunctionName, tryCatch.SourceMetadata))
+
+		caughtVar := caughtVarPrefix + tryCatch.CatchVar
+		declaration := &ast.VarDeclaration{
+			Identifier:     tryCatch.CatchVar,
+			Value:          call(CaughtFunctionName, metadata, &ast.Identifier{Symbol: caughtVar, SourceMetadata: metadata}),
+			SourceMetadata: metadata,
+		}
+		tryCatch.CatchVar = caughtVar
+		tryCatch.Catch = append([]ast.Stmt{declaration}, tryCatch.Catch...)
+		return true
+	})
+}
@@ -0,0 +1,150 @@
+package helpers_test
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/dev-kas/xel/globals"
+	"github.com/dev-kas/xel/helpers"
+	xShared "github.com/dev-kas/xel/shared"
+
+	_ "github.com/dev-kas/xel/modules/array"
+	_ "github.com/dev-kas/xel/modules/threads"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/evaluator"
+	"github.com/dev-kas/virtlang-go/v4/parser"
+)
+
+// evaluateScript runs src like `xel run` does, and returns the environment it ran in
+func evaluateScript(t *testing.T, src string) *environment.Environment {
+	t.Helper()
+	program, err := parser.New("main.xel").ProduceAST(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	helpers.RewriteCatches(program)
+
+	env := environment.NewEnvironment(nil)
+	globals.Globalize(env)
+	if _, err := evaluator.Evaluate(program, env, xShared.XelRootDebugger); err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+// lookup returns the printed Go value of the variable name in env
+func lookup(t *testing.T, env *environment.Environment, name string) string {
+	t.Helper()
+	value, err := env.LookupVar(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprint(value.Value)
+}
+
+func TestCaughtErrorPerThread(t *testing.T) {
+	// Both threads keep throwing the same message, and only ever catch their own errors
+	env := evaluateScript(t, `const threads = import("xel:threads")
+
+fn work(id) {
+  let wrong = 0
+  let i = 0
+  while (i < 200) {
+    try {
+      throw({ message: "boom", id: id })
+    } catch e {
+      if (e.id != id) {
+        wrong = wrong + 1
+      }
+    }
+    i = i + 1
+  }
+  return wrong
+}
+
+let first = threads.spawn(work, 1)
+let second = threads.spawn(work, 2)
+let wrong = first.join() + second.join()
+`)
+	if wrong := lookup(t, env, "wrong"); wrong != "0" {
+		t.Errorf("the threads caught %s errors of the other thread", wrong)
+	}
+}
+
+func TestCaughtErrorRethrown(t *testing.T) {
+	env := evaluateScript(t, `let rethrown = nil
+let wrapped = nil
+
+try {
+  try {
+    throw({ name: "InnerError", message: "boom", code: "EINNER" })
+  } catch e {
+    throw(e)
+  }
+} catch e {
+  rethrown = e
+}
+
+try {
+  try {
+    throw({ name: "InnerError", message: "boom", code: "EINNER" })
+  } catch e {
+    throw({ name: "OuterError", message: "wrapped", cause: e })
+  }
+} catch e {
+  wrapped = e
+}
+
+let rethrownName = rethrown.name
+let rethrownCode = rethrown.code
+let wrappedName = wrapped.name
+let causeName = wrapped.cause.name
+`)
+	// The outer catch receives the value its inner catch threw, not the one the inner catch received
+	for name, want := range map[string]string{"rethrownName": "InnerError", "rethrownCode": "EINNER", "wrappedName": "OuterError", "causeName": "InnerError"} {
+		if got := lookup(t, env, name); got != want {
+			t.Errorf("%s = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestCaughtErrorSameMessageAsEngine(t *testing.T) {
+	// The message of the evaluator's own error, when a variable is not declared
+	env := evaluateScript(t, `let message = nil
+try {
+  missing
+} catch e {
+  message = e.message
+}
+`)
+	message := lookup(t, env, "message")
+	if message == "" || message == "<nil>" {
+		t.Fatalf("the evaluator's error has the message %q", message)
+	}
+
+	// array.sort drops the errors of its comparator, so the thrown error is never
+	// caught, and the error of the evaluator that follows gets its value
+	env = evaluateScript(t, `const array = import("xel:array")
+let message = `+strconv.Quote(message)+`
+let caught = nil
+fn compare(a, b) {
+  throw({ name: "Error", message: message, code: "ETHROWN" })
+}
+try {
+  array.sort([2, 1], compare)
+  missing
+} catch e {
+  caught = e
+}
+let caughtMessage = caught.message
+let caughtCode = caught.code
+`)
+	if got := lookup(t, env, "caughtMessage"); got != message {
+		t.Errorf("caught the message %s, want %s", got, message)
+	}
+	if got := lookup(t, env, "caughtCode"); got != "ETHROWN" {
+		t.Errorf("caught the code %s, want the one of the thrown error", got)
+	}
+}
@@ -0,0 +1,62 @@
+package helpers
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// catchObject is the object the evaluator declares in a catch block for message
+func catchObject(message string) shared.RuntimeValue {
+	messageVal := values.MK_STRING(message)
+	return values.MK_OBJECT(map[string]*shared.RuntimeValue{"message": &messageVal})
+}
+
+func TestCaughtErrorPerGoroutine(t *testing.T) {
+	const goroutines = 16
+
+	var wg sync.WaitGroup
+	caughtIDs := make([]float64, goroutines)
+	for i := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			messageVal, idVal := values.MK_STRING("boom"), values.MK_NUMBER(float64(i))
+			thrown := values.MK_OBJECT(map[string]*shared.RuntimeValue{"message": &messageVal, "id": &idVal})
+
+			// Every goroutine raises the same message at the same time
+			EnterTry()
+			err := RaiseError(thrown)
+			caught := CaughtError(catchObject(err.Message))
+
+			if id := caught.Value.(map[string]*shared.RuntimeValue)["id"]; id != nil {
+				caughtIDs[i] = id.Value.(float64)
+			} else {
+				caughtIDs[i] = -1
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, id := range caughtIDs {
+		if id != float64(i) {
+			t.Errorf("goroutine %d caught the error of goroutine %v", i, id)
+		}
+	}
+	if len(tryStates) != 0 {
+		t.Errorf("%d goroutines are still recorded as running a try block", len(tryStates))
+	}
+}
+
+func TestCaughtErrorOutsideTry(t *testing.T) {
+	// An error raised outside of any try block is not kept for a later catch
+	NewError("TypeError", "", "stale")
+
+	EnterTry()
+	caught := CaughtError(catchObject("TypeError: stale"))
+	if name := caught.Value.(map[string]*shared.RuntimeValue)["name"].Value.(string); name != "Error" {
+		t.Errorf("caught a %s, want a plain Error", name)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/dev-kas/virtlang-go/v4/ast"
+	"github.com/dev-kas/virtlang-go/v4/debugger"
 	"github.com/dev-kas/virtlang-go/v4/environment"
 	"github.com/dev-kas/virtlang-go/v4/errors"
 	"github.com/dev-kas/virtlang-go/v4/evaluator"
@@ -12,7 +13,7 @@ import (
 	"github.com/dev-kas/virtlang-go/v4/values"
 )
 
-func evalFnValCore(ctx context.Context, fnValue *shared.RuntimeValue, args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+func evalFnValCore(ctx context.Context, fnValue *shared.RuntimeValue, args []shared.RuntimeValue, env *environment.Environment, dbgr *debugger.Debugger) (*shared.RuntimeValue, *errors.RuntimeError) {
 	select {
 	case <-ctx.Done():
 		nilVal := values.MK_NIL()
@@ -68,8 +69,17 @@ func evalFnValCore(ctx context.Context, fnValue *shared.RuntimeValue, args []sha
 			Args:   argExprs,
 		}
 
+		// Attribute the call to the position the debugger is currently at,
+		// so that it shows up sensibly in stack traces
+		if dbgr != nil {
+			callExpr.SourceMetadata = ast.SourceMetadata{
+				Filename:  dbgr.CurrentFile,
+				StartLine: dbgr.CurrentLine,
+			}
+		}
+
 		// Evaluate the call expression
-		ret, evalerr := evaluator.Evaluate(callExpr, tempEnv, nil)
+		ret, evalerr := evaluator.Evaluate(callExpr, tempEnv, dbgr)
 		if evalerr != nil {
 			if evalerr.InternalCommunicationProtocol != nil &&
 				evalerr.InternalCommunicationProtocol.Type == errors.ICP_Return {
@@ -152,9 +162,15 @@ func convertSingleArgToVirtLang(arg interface{}) (*shared.RuntimeValue, *errors.
 }
 
 func EvalFnVal(fnValue *shared.RuntimeValue, args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
-	return evalFnValCore(context.Background(), fnValue, args, env)
+	return evalFnValCore(context.Background(), fnValue, args, env, nil)
 }
 
 func EvalCancellableFnVal(ctx context.Context, fnValue *shared.RuntimeValue, args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
-	return evalFnValCore(ctx, fnValue, args, env)
+	return evalFnValCore(ctx, fnValue, args, env, nil)
+}
+
+// EvalTracedFnVal calls fnValue like EvalFnVal, but under dbgr, so that the call
+// is recorded on the debugger's call stack and uncaught errors leave snapshots behind.
+func EvalTracedFnVal(fnValue *shared.RuntimeValue, args []shared.RuntimeValue, env *environment.Environment, dbgr *debugger.Debugger) (*shared.RuntimeValue, *errors.RuntimeError) {
+	return evalFnValCore(context.Background(), fnValue, args, env, dbgr)
 }
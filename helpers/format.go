@@ -0,0 +1,734 @@
+package helpers
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dev-kas/virtlang-go/v4/ast"
+	"github.com/dev-kas/virtlang-go/v4/lexer"
+	"github.com/dev-kas/virtlang-go/v4/parser"
+)
+
+// formatIndent is the indentation of one level of nesting
+const formatIndent = "  "
+
+// fmtRole tells what a token is used for, where its type alone is ambiguous
+type fmtRole int
+
+const (
+	roleNone   fmtRole = iota
+	roleBlock          // `{` `}` around statements
+	roleObject         // `{` `}` of an object literal
+	roleArray          // `[` `]` of an array literal
+	roleIndex          // `[` `]` of a computed member
+	roleCall           // `(` `)` around arguments or parameters
+	roleGroup          // `(` `)` around an expression or a condition
+	roleUnary          // `!`
+)
+
+// fmtComment is a comment found between two tokens
+type fmtComment struct {
+	text string
+	// Line breaks between the previous token or comment and this comment
+	newlines int
+	// Whether it is a `//` comment, which runs to the end of the line
+	line bool
+}
+
+// fmtToken is a token of the source, along with the comments before it and
+// what the formatter learned about it from the grammar
+type fmtToken struct {
+	lexer.Token
+	text     string
+	comments []fmtComment
+	// Line breaks between the previous token or comment and this token
+	newlines int
+
+	role fmtRole
+	// Position of the token, and of the matching bracket for brackets
+	idx, match int
+	// Whether the token starts a statement
+	stmt bool
+	// Index of the literal opener, for tokens starting an element of an object or array literal
+	parent  int
+	element bool
+	// Position of the element in its literal
+	index int
+	// Number of elements, for literal openers
+	elements int
+	// Whether the literal is laid out with one element per line, for literal openers
+	multiline bool
+	// Separators of literals are left out, the formatter writes its own
+	skip bool
+}
+
+// fmtLine is a line of formatted code
+type fmtLine struct {
+	text string
+	// Where the `//` comment that ends the line starts, or -1 without one
+	trailing int
+}
+
+// formatter lays out a program canonically
+type formatter struct {
+	tokens []*fmtToken
+	pos    int
+
+	lines   []fmtLine
+	current strings.Builder
+	level   int
+	// Where the trailing comment of the current line starts, or -1
+	trailing int
+
+	depth          int
+	prev           *fmtToken
+	afterOpener    bool
+	pendingNewline bool
+}
+
+// FormatSource formats the Xel program in src canonically: statements go on
+// their own lines, blocks and multi-line literals are indented by two spaces,
+// operators and separators are spaced consistently, and comments are kept
+// where they were. Object and array literals stay on one line unless they were
+// written across several lines, or contain comments. Formatting formatted
+// source leaves it unchanged.
+func FormatSource(filename, src string) (string, error) {
+	program, err := parser.New(filename).ProduceAST(src)
+	if err != nil {
+		return "", err
+	}
+
+	tokens, lexErr := lexer.Tokenize(src)
+	if lexErr != nil {
+		return "", lexErr
+	}
+
+	f := &formatter{tokens: scanTokens([]rune(src), tokens), trailing: -1}
+	f.program()
+	f.layoutLiterals()
+	formatted := f.print()
+
+	// Never hand back code that means something else than what was written
+	reformatted, err := parser.New(filename).ProduceAST(formatted)
+	if err != nil || !equalAST(reflect.ValueOf(program), reflect.ValueOf(reformatted)) {
+		return "", fmt.Errorf("failed to format %s: the formatted code does not match the original", filename)
+	}
+
+	return formatted, nil
+}
+
+// scanTokens pairs each token with its source text, and with the comments found
+// between it and the previous token
+func scanTokens(src []rune, tokens []lexer.Token) []*fmtToken {
+	// Rune offset at which each line starts, with line breaks counted the way the lexer does
+	lineStarts := []int{0, 0}
+	for i := 0; i < len(src); i++ {
+		switch src[i] {
+		case '\n':
+			lineStarts = append(lineStarts, i+1)
+		case '\r':
+			if i+1 < len(src) && src[i+1] == '\n' {
+				i++
+			}
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	offset := func(line, col int) int {
+		if line >= len(lineStarts) {
+			return len(src)
+		}
+		return min(lineStarts[line]+col-1, len(src))
+	}
+
+	scanned := make([]*fmtToken, len(tokens))
+	end := 0
+	for i, tok := range tokens {
+		start := offset(tok.StartLine, tok.StartCol)
+		comments, newlines := scanGap(src[end:start])
+		scanned[i] = &fmtToken{Token: tok, comments: comments, newlines: newlines, idx: i, match: -1}
+
+		if tok.Type != lexer.EOF {
+			end = offset(tok.EndLine, tok.EndCol)
+			scanned[i].text = string(src[start:end])
+		}
+	}
+	return scanned
+}
+
+// scanGap extracts the comments from the whitespace between two tokens. It also
+// returns the number of line breaks after the last comment.
+func scanGap(gap []rune) ([]fmtComment, int) {
+	comments := []fmtComment{}
+	newlines := 0
+
+	for i := 0; i < len(gap); {
+		switch {
+		case gap[i] == '\n':
+			newlines++
+			i++
+		case gap[i] == '\r':
+			newlines++
+			i++
+			if i < len(gap) && gap[i] == '\n' {
+				i++
+			}
+		case gap[i] == '/' && i+1 < len(gap) && gap[i+1] == '/':
+			j := i
+			for j < len(gap) && gap[j] != '\n' && gap[j] != '\r' {
+				j++
+			}
+			comments = append(comments, fmtComment{text: strings.TrimRight(string(gap[i:j]), " \t"), newlines: newlines, line: true})
+			newlines = 0
+			i = j
+		case gap[i] == '/' && i+1 < len(gap) && gap[i+1] == '*':
+			j := i + 2
+			for j+1 < len(gap) && !(gap[j] == '*' && gap[j+1] == '/') {
+				j++
+			}
+			j = min(j+2, len(gap))
+			comments = append(comments, fmtComment{text: string(gap[i:j]), newlines: newlines})
+			newlines = 0
+			i = j
+		default:
+			i++
+		}
+	}
+
+	return comments, newlines
+}
+
+// The methods below follow the grammar of the VirtLang parser, to find out the
+// role of each token. The source is known to parse, so they do not report errors.
+
+func (f *formatter) at() *fmtToken {
+	return f.tokens[min(f.pos, len(f.tokens)-1)]
+}
+
+func (f *formatter) is(t lexer.TokenType) bool {
+	return f.at().Type == t
+}
+
+func (f *formatter) eof() bool {
+	return f.is(lexer.EOF)
+}
+
+func (f *formatter) advance() *fmtToken {
+	tok := f.at()
+	if f.pos < len(f.tokens)-1 {
+		f.pos++
+	}
+	return tok
+}
+
+// open marks the bracket at the current position with role, and returns its index
+func (f *formatter) open(role fmtRole) int {
+	open := f.pos
+	f.at().role = role
+	f.advance()
+	return open
+}
+
+// close pairs the bracket at the current position with the one at open
+func (f *formatter) close(open int) {
+	if f.eof() {
+		return
+	}
+	f.tokens[open].match = f.pos
+	f.at().match = open
+	f.at().role = f.tokens[open].role
+	f.advance()
+}
+
+func (f *formatter) program() {
+	for !f.eof() {
+		f.stmt()
+	}
+}
+
+func (f *formatter) stmt() {
+	start := f.pos
+	f.at().stmt = true
+
+	switch f.at().Type {
+	case lexer.Let, lexer.Const:
+		f.advance() // let or const
+		f.advance() // name
+		f.advance() // =
+		f.expr()
+	case lexer.Fn:
+		f.fnDecl()
+	case lexer.If:
+		f.ifStmt()
+	case lexer.Class:
+		f.class()
+	default:
+		f.expr()
+	}
+
+	if f.pos == start {
+		f.advance()
+	}
+}
+
+func (f *formatter) block() {
+	open := f.open(roleBlock)
+	for !f.eof() && !f.is(lexer.CBrace) {
+		f.stmt()
+	}
+	f.close(open)
+}
+
+func (f *formatter) fnDecl() {
+	f.advance() // fn
+	if f.is(lexer.Identifier) {
+		f.advance()
+	}
+	f.args()
+	f.block()
+}
+
+func (f *formatter) args() {
+	open := f.open(roleCall)
+	if !f.is(lexer.CParen) {
+		f.assignment()
+		for f.is(lexer.Comma) {
+			f.advance()
+			f.assignment()
+		}
+	}
+	f.close(open)
+}
+
+func (f *formatter) group() {
+	open := f.open(roleGroup)
+	f.expr()
+	f.close(open)
+}
+
+func (f *formatter) ifStmt() {
+	f.advance() // if
+	f.group()
+	f.block()
+
+	for f.is(lexer.Else) {
+		f.advance()
+		if f.is(lexer.If) {
+			f.ifStmt()
+		} else {
+			f.block()
+			break
+		}
+	}
+}
+
+func (f *formatter) class() {
+	f.advance() // class
+	f.advance() // name
+
+	open := f.open(roleBlock)
+	for !f.eof() && !f.is(lexer.CBrace) {
+		start := f.pos
+		f.at().stmt = true
+		f.advance() // public or private
+		f.advance() // name
+
+		if f.is(lexer.OParen) {
+			f.args()
+			f.block()
+		} else if f.is(lexer.Equals) {
+			f.advance()
+			f.expr()
+		}
+
+		if f.pos == start {
+			f.advance()
+		}
+	}
+	f.close(open)
+}
+
+func (f *formatter) expr() {
+	if f.is(lexer.Fn) {
+		f.fnDecl()
+		return
+	}
+	f.assignment()
+}
+
+func (f *formatter) assignment() {
+	f.logical()
+	if f.is(lexer.Equals) {
+		f.advance()
+		f.assignment()
+	}
+}
+
+func (f *formatter) logical() {
+	f.comparison()
+	if f.is(lexer.LogicalOperator) {
+		f.advance()
+		f.logical()
+	}
+}
+
+func (f *formatter) comparison() {
+	f.objectExpr()
+	if f.is(lexer.ComOperator) {
+		f.advance()
+		f.objectExpr()
+	}
+}
+
+func (f *formatter) objectExpr() {
+	if !f.is(lexer.OBrace) {
+		f.additive()
+		return
+	}
+
+	open := f.open(roleObject)
+	for !f.eof() && !f.is(lexer.CBrace) {
+		f.element(open)
+		f.advance() // key
+
+		if f.is(lexer.Comma) {
+			f.advance().skip = true
+			continue
+		} else if f.is(lexer.CBrace) {
+			break
+		}
+
+		f.advance() // :
+		f.expr()
+
+		if f.is(lexer.Comma) {
+			f.advance().skip = true
+		}
+	}
+	f.close(open)
+}
+
+// element marks the current token as the start of the next element of the literal at open
+func (f *formatter) element(open int) {
+	tok := f.at()
+	tok.element = true
+	tok.parent = open
+	tok.index = f.tokens[open].elements
+	f.tokens[open].elements++
+}
+
+func (f *formatter) additive() {
+	f.multiplicative()
+	for f.at().Literal == "+" || f.at().Literal == "-" {
+		f.advance()
+		f.multiplicative()
+	}
+}
+
+func (f *formatter) multiplicative() {
+	f.unary()
+	for f.at().Literal == "*" || f.at().Literal == "/" || f.at().Literal == "%" {
+		f.advance()
+		f.unary()
+	}
+}
+
+func (f *formatter) unary() {
+	if f.is(lexer.LogicalOperator) && f.at().Literal == "!" {
+		f.advance().role = roleUnary
+		f.unary()
+		return
+	}
+
+	f.member()
+	for f.is(lexer.OParen) {
+		f.args()
+	}
+}
+
+func (f *formatter) member() {
+	f.primary()
+	for f.is(lexer.Dot) || f.is(lexer.OBracket) {
+		if f.is(lexer.Dot) {
+			f.advance() // .
+			f.advance() // key
+			continue
+		}
+
+		open := f.open(roleIndex)
+		f.expr()
+		f.close(open)
+	}
+}
+
+func (f *formatter) primary() {
+	switch f.at().Type {
+	case lexer.OParen:
+		f.group()
+
+	case lexer.OBracket:
+		open := f.open(roleArray)
+		for !f.eof() && !f.is(lexer.CBracket) {
+			start := f.pos
+			f.element(open)
+			f.expr()
+			if f.is(lexer.Comma) {
+				f.advance().skip = true
+			}
+			if f.pos == start {
+				f.advance()
+			}
+		}
+		f.close(open)
+
+	case lexer.WhileLoop:
+		f.advance() // while
+		f.group()
+		f.block()
+
+	case lexer.Try:
+		f.advance() // try
+		f.block()
+		f.advance() // catch
+		f.advance() // name
+		f.block()
+
+	case lexer.Return:
+		f.advance()
+		if !f.eof() {
+			f.expr()
+		}
+
+	default:
+		f.advance()
+	}
+}
+
+// layoutLiterals decides which literals are laid out with one element per line:
+// those with a line break after the opening bracket, and those with comments
+func (f *formatter) layoutLiterals() {
+	for i, tok := range f.tokens {
+		if (tok.role != roleObject && tok.role != roleArray) || tok.match < i {
+			continue
+		}
+
+		first := f.tokens[i+1]
+		tok.multiline = first.newlines > 0 || (len(first.comments) > 0 && first.comments[0].newlines > 0)
+		for _, inner := range f.tokens[i+1 : tok.match+1] {
+			if len(inner.comments) > 0 {
+				tok.multiline = true
+			}
+		}
+	}
+}
+
+// print writes out the tokens and comments with the canonical layout
+func (f *formatter) print() string {
+	for i, tok := range f.tokens {
+		if tok.skip {
+			// The comments around a separator move after the one the formatter writes
+			if i+1 < len(f.tokens) {
+				f.tokens[i+1].comments = append(tok.comments, f.tokens[i+1].comments...)
+			}
+			continue
+		}
+		f.printToken(tok)
+	}
+
+	f.endLine()
+	for len(f.lines) > 0 && f.lines[len(f.lines)-1].text == "" {
+		f.lines = f.lines[:len(f.lines)-1]
+	}
+	if len(f.lines) == 0 {
+		return ""
+	}
+
+	// Trailing comments on consecutive lines are aligned
+	var out strings.Builder
+	for start := 0; start < len(f.lines); {
+		end := start + 1
+		width := 0
+		if f.lines[start].trailing >= 0 {
+			for end < len(f.lines) && f.lines[end].trailing >= 0 {
+				end++
+			}
+			for _, line := range f.lines[start:end] {
+				width = max(width, utf8.RuneCountInString(line.text[:line.trailing]))
+			}
+		}
+
+		for _, line := range f.lines[start:end] {
+			if line.trailing >= 0 {
+				code := line.text[:line.trailing]
+				out.WriteString(code + strings.Repeat(" ", width-utf8.RuneCountInString(code)+1) + line.text[line.trailing+1:])
+			} else {
+				out.WriteString(line.text)
+			}
+			out.WriteString("\n")
+		}
+		start = end
+	}
+	return out.String()
+}
+
+func (f *formatter) printToken(tok *fmtToken) {
+	isOpener := tok.match > tok.idx
+	isCloser := tok.match >= 0 && tok.match < tok.idx
+
+	// Separators owed to the previous element of a literal
+	if tok.element && tok.index > 0 {
+		f.write(",")
+	}
+	if isCloser && f.tokens[tok.match].multiline && f.tokens[tok.match].elements > 0 {
+		f.write(",")
+	}
+
+	// Where the token goes: at the start of a line at level, or after the previous token
+	breakLine := false
+	level := f.depth
+	switch {
+	case tok.Type == lexer.EOF:
+		breakLine = true
+		level = 0
+	case isCloser && (tok.role == roleBlock || f.tokens[tok.match].multiline):
+		f.depth--
+		level = f.depth
+		breakLine = f.prev != f.tokens[tok.match] || len(tok.comments) > 0
+	case tok.stmt:
+		breakLine = true
+	case tok.element:
+		breakLine = f.tokens[tok.parent].multiline
+	}
+
+	// Comments are indented like the statements around them
+	commentLevel := f.depth + 1
+	if breakLine && !isCloser {
+		commentLevel = level
+	}
+
+	ownLine := false
+	for _, comment := range tok.comments {
+		if comment.newlines == 0 && f.current.Len() > 0 {
+			if comment.line {
+				f.trailing = f.current.Len()
+			}
+			f.write(" " + comment.text)
+		} else {
+			f.newline(commentLevel, comment.newlines > 1 && !f.afterOpener)
+			f.write(comment.text)
+			ownLine = true
+		}
+		f.pendingNewline = comment.line
+		f.afterOpener = false
+	}
+
+	if tok.Type == lexer.EOF {
+		return
+	}
+
+	switch {
+	case breakLine:
+		f.newline(level, tok.newlines > 1 && (tok.stmt || tok.element) && !f.afterOpener)
+	case f.pendingNewline || (ownLine && tok.newlines > 0):
+		f.newline(f.depth+1, false)
+	case ownLine || f.spaceBefore(tok):
+		f.write(" ")
+	}
+
+	f.write(tok.text)
+	f.prev = tok
+	f.pendingNewline = false
+	f.afterOpener = isOpener
+
+	if isOpener && (tok.role == roleBlock || tok.multiline) {
+		f.depth++
+	}
+}
+
+// spaceBefore tells whether a space separates tok from the previous token on the same line
+func (f *formatter) spaceBefore(tok *fmtToken) bool {
+	prev := f.prev
+	switch {
+	case prev == nil || f.current.Len() == 0:
+		return false
+	case tok.Type == lexer.CParen || tok.Type == lexer.CBracket || tok.Type == lexer.Comma || tok.Type == lexer.Dot || tok.Type == lexer.Colon:
+		return false
+	case (tok.Type == lexer.OParen && tok.role == roleCall) || tok.role == roleIndex:
+		return false
+	case prev.Type == lexer.OParen || prev.Type == lexer.OBracket || prev.Type == lexer.Dot || prev.role == roleUnary:
+		return false
+	case tok.Type == lexer.CBrace && f.tokens[tok.match] == prev:
+		return false
+	}
+	return true
+}
+
+// newline starts a new line at level, after a blank line if blank is set
+func (f *formatter) newline(level int, blank bool) {
+	if f.current.Len() > 0 || len(f.lines) > 0 {
+		f.endLine()
+		if blank {
+			f.lines = append(f.lines, fmtLine{trailing: -1})
+		}
+	}
+	f.level = level
+}
+
+// endLine moves the current line to the finished ones
+func (f *formatter) endLine() {
+	f.lines = append(f.lines, fmtLine{text: strings.TrimRight(f.current.String(), " \t"), trailing: f.trailing})
+	f.current.Reset()
+	f.trailing = -1
+}
+
+func (f *formatter) write(s string) {
+	if f.current.Len() == 0 {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return
+		}
+		f.current.WriteString(strings.Repeat(formatIndent, max(f.level, 0)))
+	}
+	f.current.WriteString(s)
+}
+
+// equalAST compares two syntax trees, ignoring where their nodes are in the source
+func equalAST(a, b reflect.Value) bool {
+	if a.Kind() != b.Kind() {
+		return false
+	}
+
+	switch a.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		if a.Elem().Type() != b.Elem().Type() {
+			return false
+		}
+		return equalAST(a.Elem(), b.Elem())
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if a.Type().Field(i).Type == reflect.TypeOf(ast.SourceMetadata{}) {
+				continue
+			}
+			if !equalAST(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equalAST(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a.Interface() == b.Interface()
+	}
+}
@@ -0,0 +1,50 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Every testdata/format/<name>.xel is formatted and compared to <name>.golden,
+// which must itself be left unchanged by the formatter
+func TestFormatSource(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "format", "*.xel"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no fixtures in testdata/format")
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".xel")
+		t.Run(name, func(t *testing.T) {
+			src, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden, err := os.ReadFile(strings.TrimSuffix(input, ".xel") + ".golden")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			formatted, err := FormatSource(input, string(src))
+			if err != nil {
+				t.Fatalf("FormatSource: %v", err)
+			}
+			if formatted != string(golden) {
+				t.Errorf("formatted code differs from the golden file\n--- got\n%s\n--- want\n%s", formatted, golden)
+			}
+
+			again, err := FormatSource(input, formatted)
+			if err != nil {
+				t.Fatalf("FormatSource on formatted code: %v", err)
+			}
+			if again != formatted {
+				t.Errorf("formatting is not idempotent\n--- first\n%s\n--- second\n%s", formatted, again)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package helpers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dev-kas/xel/shared"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// CheckLockfile reports where the dependencies of a project, as listed in its
+// manifest, disagree with its lockfile, and the packages missing from the lockfile.
+// Optional dependencies may be missing, since their install was allowed to fail.
+func CheckLockfile(manifest *shared.ProjectManifest, lockfile *shared.Lockfile) error {
+	problems := []string{}
+
+	deps := manifest.InstalledDeps(true)
+	for _, name := range sortedKeys(deps) {
+		version, listed := lockfile.Deps[name]
+		locked := lockfile.Locked("", name)
+		switch {
+		case !listed && manifest.IsOptional(name):
+		case !listed:
+			problems = append(problems, fmt.Sprintf("`%s` is listed in xel.json, but not in xel.lock", name))
+		case locked == nil:
+			problems = append(problems, fmt.Sprintf("`%s` is missing from xel.lock", shared.LockKey(name, version)))
+		case !LockedSatisfies(locked, deps[name]):
+			problems = append(problems, fmt.Sprintf("xel.lock has `%s`, which does not satisfy `%s` from xel.json", shared.LockKey(name, version), deps[name]))
+		}
+	}
+
+	for _, name := range sortedKeys(lockfile.Deps) {
+		if _, listed := deps[name]; !listed {
+			problems = append(problems, fmt.Sprintf("`%s` is in xel.lock, but no longer listed in xel.json", name))
+		}
+	}
+
+	for _, key := range sortedKeys(lockfile.Packages) {
+		pkg := lockfile.Packages[key]
+		if key != shared.LockKey(pkg.Name, pkg.Version) {
+			problems = append(problems, fmt.Sprintf("xel.lock records `%s` under `%s`", shared.LockKey(pkg.Name, pkg.Version), key))
+			continue
+		}
+		for _, name := range sortedKeys(pkg.Deps) {
+			if lockfile.Locked(key, name) == nil {
+				problems = append(problems, fmt.Sprintf("`%s`, required by %s, is missing from xel.lock", shared.LockKey(name, pkg.Deps[name]), key))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("xel.json and xel.lock disagree:\n  %s\nrun `xel pkg add` to update xel.lock", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// InstallLocked installs every package of a lockfile from the source it was
+// locked with, without resolving anything. Tarballs are checked against their
+// recorded integrity hash, and git tags against their recorded commit. The
+// dependencies of each package must be the ones recorded in the lockfile, except
+// for the optional ones, and its peer dependencies the ones of the project.
+func InstallLocked(lockfile *shared.Lockfile) error {
+	for _, key := range sortedKeys(lockfile.Packages) {
+		pkg := lockfile.Packages[key]
+
+		manifest, err := installLockedPackage(pkg)
+		if err != nil {
+			return fmt.Errorf("failed to install `%s`: %v", key, err)
+		}
+		if manifest.Name != pkg.Name || manifest.Version != pkg.Version {
+			return fmt.Errorf("failed to install `%s`: its manifest is for `%s`", key, shared.LockKey(manifest.Name, manifest.Version))
+		}
+
+		deps := manifest.InstalledDeps(false)
+		for _, name := range sortedKeys(deps) {
+			spec := deps[name]
+			locked := lockfile.Locked(key, name)
+			if locked == nil && manifest.IsOptional(name) {
+				continue
+			}
+			if locked == nil || !LockedSatisfies(locked, spec) {
+				return fmt.Errorf("`%s` depends on `%s` %s, which xel.lock does not record\nrun `xel pkg add` to update xel.lock", key, name, spec)
+			}
+		}
+
+		if manifest.PeerDeps != nil {
+			if problems := peerProblems(lockfile, key, *manifest.PeerDeps); len(problems) > 0 {
+				return fmt.Errorf("peer dependencies are not satisfied:\n  %s", strings.Join(problems, "\n  "))
+			}
+		}
+	}
+
+	return nil
+}
+
+// installLockedPackage makes sure a locked package is installed, and returns its manifest
+func installLockedPackage(pkg *shared.LockedPackage) (*shared.ProjectManifest, error) {
+	version, err := semver.NewVersion(pkg.Version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version: %v", err)
+	}
+
+	switch pkg.Source {
+	case shared.GitSource:
+		if shared.XelConfig.Offline {
+			// The tag cannot be checked out, but a copy of it may be installed or mirrored
+			return installOffline(pkg.Name, version)
+		}
+
+		_, manifest, commit, err := InstallGitVersion(pkg.URL, version)
+		if err != nil {
+			return nil, err
+		}
+		// Packages locked offline may have no commit
+		if pkg.Hash != "" && commit != pkg.Hash {
+			return nil, fmt.Errorf("tag v%s of %s points to commit %s, but commit %s was locked", pkg.Version, pkg.URL, commit, pkg.Hash)
+		}
+		return manifest, nil
+
+	case shared.RegistrySource:
+		// An installed copy is only used if it is the locked tarball, untouched
+		if data, installed := findInstalled(pkg.Name, version); installed {
+			dir := filepath.Dir(data.manifestPath)
+			err := VerifyPackage(pkg)
+			if err == nil {
+				TouchPackage(dir)
+				return data.manifest, nil
+			}
+			shared.ColorPalette.Warning.Printf("Reinstalling `%s@%s`: %v\n", pkg.Name, pkg.Version, err)
+			if err := os.RemoveAll(dir); err != nil {
+				return nil, err
+			}
+			InvalidateVersionsCache(pkg.Name)
+		}
+		if pkg.URL == "" || pkg.Algorithm == "" || pkg.Hash == "" {
+			return nil, fmt.Errorf("xel.lock has no tarball URL and integrity hash for it")
+		}
+		_, manifest, err := DownloadFromTarball(pkg.URL, pkg.Algorithm, pkg.Hash, pkg.Name, pkg.Version)
+		if err != nil {
+			return nil, err
+		}
+		shared.ColorPalette.Info.Printf("Installed `%s@%s`\n", pkg.Name, pkg.Version)
+		return manifest, nil
+
+	case shared.LocalSource:
+		if data, installed := findInstalled(pkg.Name, version); installed {
+			TouchPackage(filepath.Dir(data.manifestPath))
+			return data.manifest, nil
+		}
+		return nil, fmt.Errorf("it was only found among the installed packages when it was locked, so it cannot be downloaded")
+
+	default:
+		return nil, fmt.Errorf("unknown source `%s`", pkg.Source)
+	}
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,101 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dev-kas/xel/shared"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// lockTestPackage locks pkg as served by registry
+func lockTestPackage(registry *testRegistry, pkg *PackedPackage) *shared.Lockfile {
+	lockfile := shared.NewLockfile()
+	lockfile.Deps[pkg.Manifest.Name] = pkg.Manifest.Version
+	lockfile.Packages[shared.LockKey(pkg.Manifest.Name, pkg.Manifest.Version)] = &shared.LockedPackage{
+		Name:      pkg.Manifest.Name,
+		Version:   pkg.Manifest.Version,
+		Source:    shared.RegistrySource,
+		URL:       registry.serve(pkg.TarballName(), pkg.Tarball),
+		Algorithm: pkg.Algorithm,
+		Hash:      pkg.Hash,
+	}
+	return lockfile
+}
+
+func TestCheckLockfile(t *testing.T) {
+	registry := newTestRegistry(t)
+	lockfile := lockTestPackage(registry, packTestPackage(t, "mypkg", "1.1.0", map[string]string{"main.xel": "return 1\n"}))
+
+	manifest := &shared.ProjectManifest{Name: "app", Deps: &map[string]string{"mypkg": "^1.0.0"}}
+	if err := CheckLockfile(manifest, lockfile); err != nil {
+		t.Errorf("CheckLockfile failed on a lockfile that agrees: %v", err)
+	}
+
+	manifest.Deps = &map[string]string{"mypkg": "^2.0.0"}
+	if err := CheckLockfile(manifest, lockfile); err == nil || !strings.Contains(err.Error(), "does not satisfy") {
+		t.Errorf("CheckLockfile = %v, want an unsatisfied constraint", err)
+	}
+
+	manifest.Deps = &map[string]string{"mypkg": "^1.0.0", "other": "^1.0.0"}
+	if err := CheckLockfile(manifest, lockfile); err == nil || !strings.Contains(err.Error(), "not in xel.lock") {
+		t.Errorf("CheckLockfile = %v, want a dependency missing from the lockfile", err)
+	}
+}
+
+func TestInstallLocked(t *testing.T) {
+	registry := newTestRegistry(t)
+	pkg := packTestPackage(t, "mypkg", "1.1.0", map[string]string{"main.xel": "return 1\n"})
+	lockfile := lockTestPackage(registry, pkg)
+	locked := lockfile.Packages["mypkg@1.1.0"]
+
+	// Only the locked tarball is downloaded, without resolving anything
+	if err := InstallLocked(lockfile); err != nil {
+		t.Fatalf("InstallLocked failed: %v", err)
+	}
+	if requests := registry.requested(); len(requests) != 1 || requests[0] != "/files/"+pkg.TarballName() {
+		t.Errorf("requested %v, want only the tarball", requests)
+	}
+	if err := VerifyPackage(locked); err != nil {
+		t.Errorf("VerifyPackage failed after installing: %v", err)
+	}
+
+	// An installed copy that verifies is used as is
+	if err := InstallLocked(lockfile); err != nil {
+		t.Fatalf("InstallLocked failed with the package installed: %v", err)
+	}
+	if requests := registry.requested(); len(requests) != 0 {
+		t.Errorf("requested %v with the package installed, want nothing", requests)
+	}
+
+	// A modified copy is reinstalled
+	data, installed := findInstalled("mypkg", semver.MustParse("1.1.0"))
+	if !installed {
+		t.Fatal("mypkg@1.1.0 is not installed")
+	}
+	mainPath := filepath.Join(filepath.Dir(data.manifestPath), "main.xel")
+	if err := os.WriteFile(mainPath, []byte("return 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyPackage(locked); err == nil {
+		t.Fatal("VerifyPackage passed on a modified package")
+	}
+	if err := InstallLocked(lockfile); err != nil {
+		t.Fatalf("InstallLocked failed with a modified package: %v", err)
+	}
+	if content, _ := os.ReadFile(mainPath); string(content) != "return 1\n" {
+		t.Errorf("main.xel is %q after reinstalling, want the locked content", content)
+	}
+	if err := VerifyPackage(locked); err != nil {
+		t.Errorf("VerifyPackage failed after reinstalling: %v", err)
+	}
+
+	// So is a copy of another tarball
+	locked.Hash = strings.Repeat("0", len(locked.Hash))
+	if err := InstallLocked(lockfile); err == nil {
+		t.Error("InstallLocked accepted a tarball that does not match the locked hash")
+	}
+}
@@ -0,0 +1,54 @@
+package helpers
+
+import (
+	"sync/atomic"
+
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/dev-kas/virtlang-go/v4/errors"
+)
+
+// InterruptedMessage is the message of the error an interrupted evaluation stops with
+const InterruptedMessage = "execution interrupted"
+
+var interruptible atomic.Bool
+var interrupted atomic.Bool
+
+// EnableInterrupts makes the programs parsed from now on interruptible: InstrumentSteps
+// prepares them even without a step hook, so that InterruptEvaluation can stop them.
+func EnableInterrupts() {
+	interruptible.Store(true)
+}
+
+// InterruptEvaluation stops the evaluation that is running now, and calls wait,
+// which must return once that evaluation has returned.
+//
+// The evaluator has no notion of cancellation, so interruptible programs check
+// before every statement whether they were interrupted, and unwind with an error
+// when they were. A `catch` block only holds on to that error until its next
+// statement. Native functions that are running at the time of the call are told
+// through xShared.Interrupt, which waits for the ones that support it (e.g.
+// `time.sleep` and `http.serve`) to return; the others are not interrupted, and
+// the evaluation stops once they return.
+//
+// The evaluations that start after InterruptEvaluation returned run unaffected.
+func InterruptEvaluation(wait func()) {
+	interrupted.Store(true)
+	xShared.Interrupt()
+	wait()
+	interrupted.Store(false)
+}
+
+// checkInterrupted returns the error an interrupted evaluation stops with, if it was interrupted
+func checkInterrupted() *errors.RuntimeError {
+	if interrupted.Load() {
+		return &errors.RuntimeError{Message: InterruptedMessage}
+	}
+	return nil
+}
+
+// IsInterrupted reports whether err is the error an interrupted evaluation stopped with
+func IsInterrupted(err error) bool {
+	runtimeErr, ok := err.(*errors.RuntimeError)
+	return ok && runtimeErr.Message == InterruptedMessage
+}
@@ -0,0 +1,68 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/evaluator"
+	"github.com/dev-kas/virtlang-go/v4/parser"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+func TestInterruptEvaluation(t *testing.T) {
+	EnableInterrupts()
+	t.Cleanup(func() { interruptible.Store(false) })
+
+	scripts := map[string]string{
+		"empty loop":       "while (true) {}",
+		"loop":             "let n = 0\nwhile (true) {\n  n = n + 1\n}",
+		"loop in function": "fn spin() {\n  while (true) {\n    let x = 1\n  }\n}\nspin()",
+	}
+	for name, src := range scripts {
+		t.Run(name, func(t *testing.T) {
+			program, err := parser.New("main.xel").ProduceAST(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			InstrumentSteps(program)
+
+			env := environment.NewEnvironment(nil)
+			env.DeclareVar("true", values.MK_BOOL(true), true)
+			env.DeclareVar(StepFunctionName, values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+				if err := RunStepHook(env, args[0].Value.(string), int(args[1].Value.(float64))); err != nil {
+					return nil, err
+				}
+				result := values.MK_NIL()
+				return &result, nil
+			}), true)
+
+			done := make(chan *errors.RuntimeError, 1)
+			go func() {
+				_, err := evaluator.Evaluate(program, env, nil)
+				done <- err
+			}()
+
+			time.Sleep(20 * time.Millisecond)
+			var result *errors.RuntimeError
+			returned := make(chan struct{})
+			go func() {
+				InterruptEvaluation(func() { result = <-done })
+				close(returned)
+			}()
+			select {
+			case <-returned:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the evaluation did not stop")
+			}
+			if result == nil || result.Message != InterruptedMessage {
+				t.Errorf("the evaluation returned %v, want %q", result, InterruptedMessage)
+			}
+			if err := checkInterrupted(); err != nil {
+				t.Error("evaluations are still interrupted after InterruptEvaluation returned")
+			}
+		})
+	}
+}
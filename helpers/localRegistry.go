@@ -0,0 +1,299 @@
+package helpers
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dev-kas/xel/shared"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// A local registry is a directory laid out like the registry API, which
+// PackageRegistryURI points to with a file:// URI:
+//
+//	packages/name/<name>.json  the details of a package
+//	versions/pkg/<id>.json     the versions of the package with that id
+//	tarballs/ver/<id>.json     the tarball of the version with that id
+//	files/<name>-<version>.tar.gz
+//
+// The URLs of its tarballs are relative to the directory, so that it can be moved.
+
+// LocalRegistryDir returns the directory of the registry, if PackageRegistryURI is a file:// URI
+func LocalRegistryDir() (string, bool) {
+	u, err := url.Parse(shared.XelConfig.PackageRegistryURI)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	return fileURLPath(u), true
+}
+
+// fileURLPath returns the path a file:// URL points to
+func fileURLPath(u *url.URL) string {
+	return filepath.FromSlash(u.Host + u.Path)
+}
+
+// readLocalRegistry reads the response of a local registry to path into out
+func readLocalRegistry(dir, path string, out any) error {
+	// Every version is in the same file, so pagination is ignored
+	path, _, _ = strings.Cut(path, "?")
+
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(path)+".json"))
+	if os.IsNotExist(err) {
+		return ErrNotInRegistry
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// tarballURL resolves the URL of a tarball, which may be relative to the registry
+func tarballURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tarball URL %s: %v", rawURL, err)
+	}
+	if !u.IsAbs() {
+		base, err := url.Parse(shared.XelConfig.PackageRegistryURI)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PackageRegistryURI: %v", err)
+		}
+		u = base.ResolveReference(u)
+	}
+	return u, nil
+}
+
+// IsRemoteTarball reports whether the tarball at rawURL is downloaded from the network
+func IsRemoteTarball(rawURL string) bool {
+	u, err := tarballURL(rawURL)
+	return err == nil && u.Scheme != "file"
+}
+
+// OpenTarball opens the tarball at rawURL, from the network or from the disk
+func OpenTarball(rawURL string) (io.ReadCloser, error) {
+	u, err := tarballURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "file":
+		return os.Open(fileURLPath(u))
+
+	case "http", "https":
+		if shared.XelConfig.Offline {
+			return nil, ErrOffline
+		}
+		resp, err := http.Get(u.String())
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to download tarball: %s", resp.Status)
+		}
+		return resp.Body, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported tarball URL %s", rawURL)
+	}
+}
+
+// readTarball reads the tarball at rawURL, and checks its integrity hash
+func readTarball(rawURL, algorithm, hash string) ([]byte, error) {
+	hasherFn, ok := integrityHashers[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported integrity algorithm: %s", algorithm)
+	}
+
+	body, err := OpenTarball(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher := hasherFn()
+	hasher.Write(data)
+	if actualHash := hex.EncodeToString(hasher.Sum(nil)); actualHash != hash {
+		return nil, fmt.Errorf("integrity check failed for %s:\nexpected: %s\ngot:      %s", algorithm, hash, actualHash)
+	}
+	return data, nil
+}
+
+// MirrorLockfile adds every package of a lockfile, which must be installed, to
+// the local registry in dir. Registry packages keep their tarball, so that it
+// still matches the integrity hash in the lockfile; the others are packed from
+// their installed copy.
+func MirrorLockfile(dir string, lockfile *shared.Lockfile) error {
+	packages := []MirroredPackage{}
+	for _, key := range sortedKeys(lockfile.Packages) {
+		pkg := lockfile.Packages[key]
+
+		version, err := semver.NewVersion(pkg.Version)
+		if err != nil {
+			return fmt.Errorf("`%s` has an invalid version: %v", key, err)
+		}
+		data, installed := findInstalled(pkg.Name, version)
+		if !installed {
+			return fmt.Errorf("`%s` is not installed", key)
+		}
+
+		mirrored := MirroredPackage{Manifest: data.manifest}
+		if pkg.Source == shared.RegistrySource && pkg.URL != "" {
+			mirrored.Tarball, err = readTarball(pkg.URL, pkg.Algorithm, pkg.Hash)
+			if err != nil {
+				return fmt.Errorf("failed to mirror `%s`: %v", key, err)
+			}
+			mirrored.Algorithm, mirrored.Hash = pkg.Algorithm, pkg.Hash
+		} else {
+			packed, err := PackFiles(data.manifest, data.manifestPath)
+			if err != nil {
+				return fmt.Errorf("failed to mirror `%s`: %v", key, err)
+			}
+			mirrored.Tarball, mirrored.Algorithm, mirrored.Hash = packed.Tarball, packed.Algorithm, packed.Hash
+		}
+		packages = append(packages, mirrored)
+	}
+
+	return WriteLocalRegistry(dir, packages)
+}
+
+// MirroredPackage is a package to add to a local registry
+type MirroredPackage struct {
+	Manifest  *shared.ProjectManifest
+	Tarball   []byte
+	Algorithm string
+	Hash      string
+}
+
+// WriteLocalRegistry adds packages to the local registry in dir, which is
+// created if needed. Versions the registry has already are left as they are,
+// unless their tarball differs, which is an error.
+func WriteLocalRegistry(dir string, packages []MirroredPackage) error {
+	for _, sub := range []string{"packages/name", "versions/pkg", "tarballs/ver", "files"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(sub)), 0755); err != nil {
+			return err
+		}
+	}
+
+	// Ids continue after the ones in use
+	lastPackageID, err := lastLocalRegistryID(filepath.Join(dir, "versions", "pkg"))
+	if err != nil {
+		return err
+	}
+	lastVersionID, err := lastLocalRegistryID(filepath.Join(dir, "tarballs", "ver"))
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range packages {
+		name, version := pkg.Manifest.Name, pkg.Manifest.Version
+
+		var details RegistryPackageResp
+		err := readLocalRegistry(dir, "packages/name/"+name, &details)
+		if errors.Is(err, ErrNotInRegistry) {
+			lastPackageID++
+			details = RegistryPackageResp{ID: lastPackageID, Name: name}
+			err = writeLocalRegistryFile(dir, "packages/name/"+name, details)
+		}
+		if err != nil {
+			return err
+		}
+
+		var versions RegistryPackageVersionResp
+		if err := readLocalRegistry(dir, fmt.Sprintf("versions/pkg/%d", details.ID), &versions); err != nil && !errors.Is(err, ErrNotInRegistry) {
+			return err
+		}
+
+		known := false
+		for _, v := range versions.Versions {
+			if v.Version != version {
+				continue
+			}
+			known = true
+			var tarballs RegistryTarballMetadataResp
+			if err := readLocalRegistry(dir, fmt.Sprintf("tarballs/ver/%d", v.ID), &tarballs); err != nil {
+				return err
+			}
+			if len(tarballs.Tarballs) == 0 || tarballs.Tarballs[0].Integrity.Hash != pkg.Hash {
+				return fmt.Errorf("%s already has a different tarball for `%s`", dir, shared.LockKey(name, version))
+			}
+		}
+		if known {
+			continue
+		}
+
+		semVersion, err := semver.StrictNewVersion(version)
+		if err != nil {
+			return fmt.Errorf("`%s` has an invalid version: %v", shared.LockKey(name, version), err)
+		}
+		lastVersionID++
+
+		fileName := fmt.Sprintf("%s-%s.tar.gz", name, version)
+		if err := os.WriteFile(filepath.Join(dir, "files", fileName), pkg.Tarball, 0644); err != nil {
+			return err
+		}
+
+		tarball := RegistryTarball{Package: details.ID, Version: lastVersionID, URL: "files/" + fileName, SizeBytes: len(pkg.Tarball), ID: lastVersionID}
+		tarball.Integrity.Algorithm, tarball.Integrity.Hash = pkg.Algorithm, pkg.Hash
+		metadata := RegistryTarballMetadataResp{Tarballs: []RegistryTarball{tarball}, Total: 1, Limit: 1}
+		if err := writeLocalRegistryFile(dir, fmt.Sprintf("tarballs/ver/%d", lastVersionID), metadata); err != nil {
+			return err
+		}
+
+		entry := RegistryPackageVersionRespMetadata{Version: version, Package: details.ID, Xel: "*", Engine: "*", ID: lastVersionID}
+		entry.Semver.Major, entry.Semver.Minor, entry.Semver.Patch = int(semVersion.Major()), int(semVersion.Minor()), int(semVersion.Patch())
+		if pkg.Manifest.Xel != nil {
+			entry.Xel = *pkg.Manifest.Xel
+		}
+		if pkg.Manifest.Engine != nil {
+			entry.Engine = *pkg.Manifest.Engine
+		}
+		versions.Versions = append(versions.Versions, entry)
+		versions.Total, versions.Limit, versions.Offset = len(versions.Versions), len(versions.Versions), 0
+		if err := writeLocalRegistryFile(dir, fmt.Sprintf("versions/pkg/%d", details.ID), versions); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeLocalRegistryFile writes the response of a local registry to path
+func writeLocalRegistryFile(dir, path string, value any) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, filepath.FromSlash(path)+".json"), append(data, '\n'), 0644)
+}
+
+// lastLocalRegistryID returns the highest id among the `<id>.json` files of dir
+func lastLocalRegistryID(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	last := 0
+	for _, entry := range entries {
+		var id int
+		if _, err := fmt.Sscanf(entry.Name(), "%d.json", &id); err == nil && id > last {
+			last = id
+		}
+	}
+	return last, nil
+}
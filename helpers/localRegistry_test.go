@@ -0,0 +1,62 @@
+package helpers
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dev-kas/xel/shared"
+)
+
+func TestOfflineLocalRegistry(t *testing.T) {
+	registry := newTestRegistry(t)
+	pkg := packTestPackage(t, "mypkg", "1.1.0", map[string]string{"main.xel": "return 1\n"})
+	lockfile := lockTestPackage(registry, pkg)
+	if err := InstallLocked(lockfile); err != nil {
+		t.Fatalf("InstallLocked failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	if err := MirrorLockfile(dir, lockfile); err != nil {
+		t.Fatalf("MirrorLockfile failed: %v", err)
+	}
+	var details RegistryPackageResp
+	if err := readLocalRegistry(dir, "packages/name/mypkg", &details); err != nil || details.Name != "mypkg" {
+		t.Fatalf("the mirror has the details %+v (%v), want those of mypkg", details, err)
+	}
+	// Mirroring the same lockfile again changes nothing
+	if err := MirrorLockfile(dir, lockfile); err != nil {
+		t.Fatalf("MirrorLockfile failed on its own mirror: %v", err)
+	}
+	registry.requested()
+
+	// From here on, packages only come from the mirror, into module paths that do not have them
+	shared.XelConfig.PackageRegistryURI = "file://" + filepath.ToSlash(dir) + "/"
+	shared.XelConfig.Offline = true
+	InvalidateVersionsCache("")
+
+	shared.XelConfig.ModulePaths = []string{t.TempDir()}
+	if err := InstallLocked(lockfile); err != nil {
+		t.Fatalf("InstallLocked failed offline: %v", err)
+	}
+	if err := VerifyPackage(lockfile.Packages["mypkg@1.1.0"]); err != nil {
+		t.Errorf("VerifyPackage failed after installing offline: %v", err)
+	}
+
+	shared.XelConfig.ModulePaths = []string{t.TempDir()}
+	manifest := &shared.ProjectManifest{Name: "app", Deps: &map[string]string{"mypkg": "^1.0.0"}}
+	resolved, err := (&Resolver{Name: "app"}).Resolve(manifest)
+	if err != nil {
+		t.Fatalf("Resolve failed offline: %v", err)
+	}
+	locked := resolved.Packages["mypkg@1.1.0"]
+	if locked == nil || locked.Hash != pkg.Hash {
+		t.Fatalf("resolved %+v, want mypkg@1.1.0 with the hash of its tarball", resolved.Packages)
+	}
+	if err := VerifyPackage(locked); err != nil {
+		t.Errorf("VerifyPackage failed after resolving offline: %v", err)
+	}
+
+	if requests := registry.requested(); len(requests) != 0 {
+		t.Errorf("requested %v offline, want nothing", requests)
+	}
+}
@@ -0,0 +1,66 @@
+package helpers
+
+import (
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// ManifestToObject converts a manifest into the VirtLang object exposed as
+// `proc.manifest`, to the project and to each package it imports
+func ManifestToObject(manifest *xShared.ProjectManifest) shared.RuntimeValue {
+	optional := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+
+	manifestConverted := map[string]*shared.RuntimeValue{}
+	addString := func(key, value string) {
+		val := values.MK_STRING(value)
+		manifestConverted[key] = &val
+	}
+	addString("name", manifest.Name)
+	addString("description", manifest.Description)
+	addString("version", manifest.Version)
+	addString("xel", optional(manifest.Xel))
+	addString("engine", optional(manifest.Engine))
+	addString("main", manifest.Main)
+	addString("author", manifest.Author)
+	addString("license", manifest.License)
+
+	// Every kind of dependencies is an object, empty if the manifest has none
+	kinds := map[string]*map[string]string{
+		"deps":         manifest.Deps,
+		"devDeps":      manifest.DevDeps,
+		"optionalDeps": manifest.OptionalDeps,
+		"peerDeps":     manifest.PeerDeps,
+	}
+	for key, deps := range kinds {
+		depsMap := make(map[string]*shared.RuntimeValue)
+		if deps != nil {
+			for k, v := range *deps {
+				depVal := values.MK_STRING(v)
+				depsMap[k] = &depVal
+			}
+		}
+		depsObj := values.MK_OBJECT(depsMap)
+		manifestConverted[key] = &depsObj
+	}
+
+	// Scripts are given by their command line
+	scriptsMap := make(map[string]*shared.RuntimeValue)
+	for name, script := range manifest.Scripts {
+		if script == nil {
+			continue
+		}
+		runVal := values.MK_STRING(script.Run)
+		scriptsMap[name] = &runVal
+	}
+	scriptsObj := values.MK_OBJECT(scriptsMap)
+	manifestConverted["scripts"] = &scriptsObj
+
+	return values.MK_OBJECT(manifestConverted)
+}
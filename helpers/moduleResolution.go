@@ -3,6 +3,7 @@ package helpers
 import (
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -26,6 +27,9 @@ type VersionData struct {
 // ResolveModuleLocal takes a module name and attempts to find it in the configured module paths
 // It returns the path to the module's manifest, the manifest itself and an error if the module is not found
 func ResolveModuleLocal(moduleName string, constraint string) (string, *shared.ProjectManifest, error) {
+	// Packages installed from git are found by name too
+	_, constraint = ParseDependency(constraint)
+
 	// Convert constraint to semver constraint
 	versionConstraint, err := semver.NewConstraint(constraint)
 	if err != nil {
@@ -150,12 +154,56 @@ func GetVersions(moduleName string) map[*semver.Version]VersionData {
 	return collectedVersions
 }
 
+// InvalidateVersionsCache forgets the installed versions of a module collected by
+// GetVersions, or of every module if moduleName is empty
+func InvalidateVersionsCache(moduleName string) {
+	if moduleName == "" {
+		versionsCache = map[string]map[*semver.Version]VersionData{}
+		return
+	}
+	delete(versionsCache, moduleName)
+}
+
 // DownloadModuleGit takes a module git url and attempts to fetch and download a version satisfying the constraint
 func DownloadModuleGit(url string, constraint string) (string, *shared.ProjectManifest, error) {
+	versions, err := ListGitVersions(url)
+	if err != nil {
+		return "", nil, err
+	}
+
+	versionConstraint, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// the versions are sorted newest first, so the first one that installs is the best
+	for _, version := range versions {
+		if !versionConstraint.Check(version) {
+			continue
+		}
+
+		manifestPath, manifest, _, err := InstallGitVersion(url, version)
+		if err != nil {
+			shared.ColorPalette.Warning.Printf("Skipping %s: %v\n", version, err)
+			continue
+		}
+		return manifestPath, manifest, nil
+	}
+
+	return "", nil, fmt.Errorf("no valid version found that satisfies the constraint")
+}
+
+// ListGitVersions returns the versions of the module in the git repository at url,
+// newest first. Versions are the tags that look like `vX.Y.Z`.
+func ListGitVersions(url string) ([]*semver.Version, error) {
+	if shared.XelConfig.Offline {
+		return nil, ErrOffline
+	}
+
 	// First we create a temp dir to clone the repo
 	tmpDir, err := os.MkdirTemp("", "xel-module-*")
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 
 	defer os.RemoveAll(tmpDir)
@@ -170,171 +218,163 @@ func DownloadModuleGit(url string, constraint string) (string, *shared.ProjectMa
 		Progress:   nil,
 	})
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 
 	// list the all tags
 	tags, err := repo.Tags()
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 
 	// collect valid tags
 	// a tag is valid if it follows this format:
 	// vX.Y.Z
 	validTags := make([]*semver.Version, 0)
-	tagMap := make(map[string]*plumbing.Reference)
-
 	err = tags.ForEach(func(ref *plumbing.Reference) error {
-		name := ref.Name().String()
-
-		name = strings.TrimPrefix(name, "refs/tags/")
+		name := strings.TrimPrefix(ref.Name().String(), "refs/tags/")
 
 		if strings.HasPrefix(name, "v") {
 			version, err := semver.NewVersion(name[1:])
 			if err != nil {
-				return err
+				return nil // not a version tag
 			}
 			validTags = append(validTags, version)
-			tagMap[version.String()] = ref
 		}
 		return nil
 	})
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 
 	if len(validTags) == 0 {
 		// Oops, no valid tags found
-		return "", nil, fmt.Errorf("no valid semver tags found")
+		return nil, fmt.Errorf("no valid semver tags found")
 	}
 
 	// sort tags descending (newer first)
 	sort.Sort(sort.Reverse(semver.Collection(validTags)))
 
-	// now we check each version and see if that thingy satisfy the given constraint.
-	// actually, lets first parse the constraint
-	versionConstraint, err := semver.NewConstraint(constraint)
-	if err != nil {
-		return "", nil, err
-	}
+	return validTags, nil
+}
 
-	// finally lets check it...
-	for _, version := range validTags {
-		if versionConstraint.Check(version) {
-			// we found a tag name that satisfies the constraint
-			tagRef := tagMap[version.String()]
+// InstallGitVersion installs the given version of the module in the git repository at url,
+// unless it is installed already. It returns the path of its manifest, the manifest and
+// the commit the version's tag points to.
+func InstallGitVersion(url string, version *semver.Version) (string, *shared.ProjectManifest, string, error) {
+	// prepare destination for cloning the tag
+	dest := filepath.Join(shared.XelConfig.ModulePaths[0],
+		// the format of this is mod-[hash of url]/[version]
+		// this kinda keeps uniqueness but still, its not the best option i could opt for...
+		fmt.Sprintf("mod-%x", sha256.Sum256([]byte(url))), version.String())
+	manifestPath := filepath.Join(dest, "xel.json")
 
-			// prepare destination for cloning the tag
-			dest := filepath.Join(shared.XelConfig.ModulePaths[0],
-				// the format of this is mod-[hash of url]/[version]
-				// this kinda keeps uniqueness but still, its not the best option i could opt for...
-				fmt.Sprintf("mod-%x", sha256.Sum256([]byte(url))), version.String())
+	repo, err := git.PlainOpen(dest)
+	if err != nil && shared.XelConfig.Offline {
+		return "", nil, "", ErrOffline
+	}
+	if err != nil {
+		// not installed yet, clone ONLY the this specific tag
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return "", nil, "", err
+		}
 
-			// create the dirs
-			if err := os.MkdirAll(dest, 0755); err != nil {
-				return "", nil, err
-			}
+		repo, err = git.PlainClone(dest, false, &git.CloneOptions{
+			URL:           url,
+			Depth:         1,
+			SingleBranch:  true,
+			ReferenceName: plumbing.NewTagReferenceName("v" + version.Original()),
+			Tags:          git.NoTags,
+		})
+		if err != nil {
+			os.RemoveAll(dest)
+			return "", nil, "", err
+		}
+	}
 
-			// clone ONLY the this specific tag
-			_, err := git.PlainClone(dest, false, &git.CloneOptions{
-				URL:           url,
-				Depth:         1,
-				SingleBranch:  true,
-				ReferenceName: tagRef.Name(),
-				Tags:          git.NoTags,
-			})
+	head, err := repo.Head()
+	if err != nil {
+		os.RemoveAll(dest)
+		return "", nil, "", err
+	}
 
-			if err != nil {
-				// we skip if we can't clone
-				continue
-			}
+	// lets actually validate it has a real manifest
+	manifestContent, err := os.ReadFile(manifestPath)
+	if err != nil {
+		// manifest might not exist, so we remove this
+		os.RemoveAll(dest)
+		return "", nil, "", fmt.Errorf("the repository has no xel.json")
+	}
 
-			// lets actually validate it has a real manifest
-			manifestPath := filepath.Join(dest, "xel.json")
-			manifestContent, err := os.ReadFile(manifestPath)
-			if err != nil {
-				// manifest might not exist, so we remove this
-				os.RemoveAll(dest)
-				continue
-			}
+	manifest := shared.ProjectManifest{}
+	if err := json.Unmarshal(manifestContent, &manifest); err != nil {
+		// manifest might be corrupted, so we remove this
+		os.RemoveAll(dest)
+		return "", nil, "", fmt.Errorf("failed to parse xel.json: %v", err)
+	}
 
-			manifest := shared.ProjectManifest{}
-			if err := json.Unmarshal(manifestContent, &manifest); err != nil {
-				// manifest might be corrupted, so we remove this
-				os.RemoveAll(dest)
-				continue
-			}
+	// this also means that the tag should have exactly the same version as listed in the package
+	if manifest.Version != version.String() {
+		os.RemoveAll(dest)
+		return "", nil, "", fmt.Errorf("version spoof detected, tag name (`%s`) is not matching the version in the manifest (`%s`)", version.String(), manifest.Version)
+	}
 
-			// while we're here, lets also double verify the version
-			// we dont waste memory by using the semver package here because we already verified the version
-			// string earlier, so we can simply check if the manifest has same version as the tag specifies
-			// this also means that the tag should have exactly the same version as listed in the package
-			if manifest.Version != version.String() {
-				// we skip if the version doesn't match
-				shared.ColorPalette.Warning.Printf("Version spoof detected, tag name (`%s`) is not matching the version in the manifest (`%s`). Skipping.\n", version.String(), manifest.Version)
-				os.RemoveAll(dest)
-				continue
-			}
+	// we also need to verify that this package version is compatible with the current version of xel
+	xelConstraint, engineConstraint := "", ""
+	if manifest.Xel != nil {
+		xelConstraint = *manifest.Xel
+	}
+	if manifest.Engine != nil {
+		engineConstraint = *manifest.Engine
+	}
+	if err := CheckCompatibility(xelConstraint, engineConstraint); err != nil {
+		os.RemoveAll(dest)
+		return "", nil, "", err
+	}
 
-			// we also need to verify that this package version is compatible with the current version of xel
-			if shared.RuntimeVersion != "" { // Xel is not in development mode
-				constraint, err := semver.NewConstraint(*manifest.Xel)
-				if err != nil {
-					shared.ColorPalette.Warning.Printf("Invalid Xel version constraint in manifest: %v\n", err)
-					os.RemoveAll(dest)
-					continue
-				}
+	InvalidateVersionsCache(manifest.Name)
 
-				runtimeVersion, err := semver.NewVersion(shared.RuntimeVersion)
-				if err != nil {
-					shared.ColorPalette.Warning.Printf("Invalid runtime version format: %v\n", err)
-					os.RemoveAll(dest)
-					continue
-				}
+	// finally, we return the manifest
+	return manifestPath, &manifest, head.Hash().String(), nil
+}
 
-				if !constraint.Check(runtimeVersion) {
-					shared.ColorPalette.Warning.Printf("Xel version %s does not satisfy required version %s from xel.json, please upgrade your runtime\n", shared.RuntimeVersion, *manifest.Xel)
-					os.RemoveAll(dest)
-					continue
-				}
-			} else { // Xel is in development mode
-				// we skip the version check
-				shared.ColorPalette.Warning.Println("Xel is in development mode, skipping version check")
-			}
+// CheckCompatibility returns an error if a package that requires the given versions
+// of Xel and of the engine cannot run on this runtime. Empty constraints accept any
+// version, and development builds skip the check.
+func CheckCompatibility(xelConstraint, engineConstraint string) error {
+	if shared.RuntimeVersion != "" && xelConstraint != "" { // Xel is not in development mode
+		constraint, err := semver.NewConstraint(xelConstraint)
+		if err != nil {
+			return fmt.Errorf("invalid Xel version constraint in manifest: %v", err)
+		}
 
-			// we also need to verify that this package version is compatible with the current version of engine
-			if shared.EngineVersion != "" { // Engine is not in development mode
-				constraint, err := semver.NewConstraint(*manifest.Engine)
-				if err != nil {
-					shared.ColorPalette.Warning.Printf("Invalid engine version constraint in manifest: %v\n", err)
-					os.RemoveAll(dest)
-					continue
-				}
+		runtimeVersion, err := semver.NewVersion(shared.RuntimeVersion)
+		if err != nil {
+			return fmt.Errorf("invalid runtime version format: %v", err)
+		}
 
-				engineVersion, err := semver.NewVersion(shared.EngineVersion)
-				if err != nil {
-					shared.ColorPalette.Warning.Printf("Invalid engine version format: %v\n", err)
-					os.RemoveAll(dest)
-					continue
-				}
+		if !constraint.Check(runtimeVersion) {
+			return fmt.Errorf("it requires Xel %s, but this is Xel %s", xelConstraint, shared.RuntimeVersion)
+		}
+	}
 
-				if !constraint.Check(engineVersion) {
-					shared.ColorPalette.Warning.Printf("Engine version %s does not satisfy required version %s from xel.json, please upgrade your engine\n", shared.EngineVersion, *manifest.Engine)
-					os.RemoveAll(dest)
-					continue
-				}
-			} else { // Engine is in development mode
-				// we skip the version check
-				shared.ColorPalette.Warning.Println("Engine is in development mode, skipping version check")
-			}
+	if shared.EngineVersion != "" && engineConstraint != "" { // Engine is not in development mode
+		constraint, err := semver.NewConstraint(engineConstraint)
+		if err != nil {
+			return fmt.Errorf("invalid engine version constraint in manifest: %v", err)
+		}
+
+		engineVersion, err := semver.NewVersion(shared.EngineVersion)
+		if err != nil {
+			return fmt.Errorf("invalid engine version format: %v", err)
+		}
 
-			// finally, we return the manifest
-			return manifestPath, &manifest, nil
+		if !constraint.Check(engineVersion) {
+			return fmt.Errorf("it requires engine %s, but this is engine %s", engineConstraint, shared.EngineVersion)
 		}
 	}
 
-	return "", nil, fmt.Errorf("no valid version found that satisfies the constraint")
+	return nil
 }
 
 type RegistryPackageResp struct {
@@ -370,62 +410,91 @@ type RegistryPackageVersionRespMetadata struct {
 }
 
 type RegistryPackageVersionResp struct {
-	Versions []RegistryPackageVersionRespMetadata
+	Versions []RegistryPackageVersionRespMetadata `json:"versions"`
 	Total    int `json:"total"`
 	Limit    int `json:"limit"`
 	Offset   int `json:"offset"`
 }
 
+type RegistryTarball struct {
+	Integrity struct {
+		Algorithm string `json:"algorithm"`
+		Hash      string `json:"hash"`
+	} `json:"integrity"`
+	Package   int    `json:"package"`
+	Version   int    `json:"version"`
+	URL       string `json:"url"`
+	SizeBytes int    `json:"size_bytes"`
+	ID        int    `json:"id"`
+	GID       int    `json:"gid"`
+	Downloads int    `json:"downloads"`
+}
+
 type RegistryTarballMetadataResp struct {
-	Tarballs []struct {
-		Integrity struct {
-			Algorithm string `json:"algorithm"`
-			Hash      string `json:"hash"`
-		} `json:"integrity"`
-		Package   int    `json:"package"`
-		Version   int    `json:"version"`
-		URL       string `json:"url"`
-		SizeBytes int    `json:"size_bytes"`
-		ID        int    `json:"id"`
-		GID       int    `json:"gid"`
-		Downloads int    `json:"downloads"`
-	} `json:"tarballs"`
-	Total  int `json:"total"`
-	Limit  int `json:"limit"`
-	Offset int `json:"offset"`
+	Tarballs []RegistryTarball `json:"tarballs"`
+	Total    int               `json:"total"`
+	Limit    int               `json:"limit"`
+	Offset   int               `json:"offset"`
 }
 
-func DownloadModuleOnline(moduleName string, constraint string) (string, *shared.ProjectManifest, string, string, string, error) {
-	// Fetch the package details from the registry
-	resp, err := http.Get(fmt.Sprintf("%s%s%s", shared.XelConfig.PackageRegistryURI, "packages/name/", moduleName))
+// ErrNotInRegistry is returned when the registry has no such package or version
+var ErrNotInRegistry = errors.New("not found in the registry")
+
+// ErrOffline is returned instead of reaching the network in offline mode
+var ErrOffline = errors.New("offline mode only uses installed packages and file:// registries")
+
+// registryGet fetches path from the package registry and decodes the JSON response into out
+func registryGet(path string, out any) error {
+	if dir, isLocal := LocalRegistryDir(); isLocal {
+		return readLocalRegistry(dir, path, out)
+	}
+	if shared.XelConfig.Offline {
+		return ErrOffline
+	}
+
+	resp, err := http.Get(shared.XelConfig.PackageRegistryURI + path)
 	if err != nil {
-		return "", nil, "", "", "", err
+		return err
 	}
 	defer resp.Body.Close()
 
-	// Parse the response body
-	var packageDetails RegistryPackageResp
-	if err := json.NewDecoder(resp.Body).Decode(&packageDetails); err != nil {
-		return "", nil, "", "", "", err
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotInRegistry
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the registry responded with %s", resp.Status)
 	}
 
-	// fetch the package versions from the registry
-	resp, err = http.Get(fmt.Sprintf("%s%s%d?limit=100&offset=0", shared.XelConfig.PackageRegistryURI, "versions/pkg/", packageDetails.ID))
-	if err != nil {
-		return "", nil, "", "", "", err
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// FetchRegistryPackage fetches the details of a package from the registry
+func FetchRegistryPackage(name string) (*RegistryPackageResp, error) {
+	var packageDetails RegistryPackageResp
+	if err := registryGet("packages/name/"+name, &packageDetails); err != nil {
+		return nil, fmt.Errorf("failed to fetch package `%s`: %w", name, err)
 	}
-	defer resp.Body.Close()
+	return &packageDetails, nil
+}
 
-	// Parse the response body
-	var versions RegistryPackageVersionResp
-	if err := json.NewDecoder(resp.Body).Decode(&versions); err != nil {
-		return "", nil, "", "", "", err
+// FetchRegistryVersions fetches every version of a package from the registry, newest first
+func FetchRegistryVersions(packageID int) ([]RegistryPackageVersionRespMetadata, error) {
+	versions := []RegistryPackageVersionRespMetadata{}
+	for {
+		var page RegistryPackageVersionResp
+		if err := registryGet(fmt.Sprintf("versions/pkg/%d?limit=100&offset=%d", packageID, len(versions)), &page); err != nil {
+			return nil, fmt.Errorf("failed to fetch versions: %w", err)
+		}
+		versions = append(versions, page.Versions...)
+		if len(page.Versions) == 0 || len(versions) >= page.Total {
+			break
+		}
 	}
 
 	// Sort it in descending order (new -> old)
-	sort.Slice(versions.Versions, func(i, j int) bool {
-		a := versions.Versions[i].Semver
-		b := versions.Versions[j].Semver
+	sort.Slice(versions, func(i, j int) bool {
+		a := versions[i].Semver
+		b := versions[j].Semver
 
 		if a.Major != b.Major {
 			return a.Major > b.Major
@@ -436,101 +505,44 @@ func DownloadModuleOnline(moduleName string, constraint string) (string, *shared
 		return a.Patch > b.Patch
 	})
 
-	// find the version that satisfies the constraint
-	// targetVersion := versions.Versions[0]
-	targetVersion := RegistryPackageVersionRespMetadata{
-		ID: -1,
-	}
-	for _, v := range versions.Versions {
-		constraint, err := semver.NewConstraint(constraint)
-		if err != nil {
-			return "", nil, "", "", "", err
-		}
-
-		version, err := semver.NewVersion(v.Version)
-		if err != nil {
-			return "", nil, "", "", "", err
-		}
-
-		// we also need to verify that this package version is compatible with the current version of xel
-		if shared.RuntimeVersion != "" { // Xel is not in development mode
-			constraint, err := semver.NewConstraint(v.Xel)
-			if err != nil {
-				shared.ColorPalette.Warning.Printf("Invalid Xel version constraint in manifest: %v\n", err)
-				continue
-			}
-
-			runtimeVersion, err := semver.NewVersion(shared.RuntimeVersion)
-			if err != nil {
-				shared.ColorPalette.Warning.Printf("Invalid runtime version format: %v\n", err)
-				continue
-			}
-
-			if !constraint.Check(runtimeVersion) {
-				shared.ColorPalette.Warning.Printf("Xel version %s does not satisfy required version %s from xel.json, please upgrade your runtime\n", shared.RuntimeVersion, v.Xel)
-				continue
-			}
-		} else { // Xel is in development mode
-			// we skip the version check
-			shared.ColorPalette.Warning.Println("Xel is in development mode, skipping version check")
-		}
-
-		// we also need to verify that this package version is compatible with the current version of engine
-		if shared.EngineVersion != "" { // Engine is not in development mode
-			constraint, err := semver.NewConstraint(v.Engine)
-			if err != nil {
-				shared.ColorPalette.Warning.Printf("Invalid engine version constraint in manifest: %v\n", err)
-				continue
-			}
-
-			engineVersion, err := semver.NewVersion(shared.EngineVersion)
-			if err != nil {
-				shared.ColorPalette.Warning.Printf("Invalid engine version format: %v\n", err)
-				continue
-			}
-
-			if !constraint.Check(engineVersion) {
-				shared.ColorPalette.Warning.Printf("Engine version %s does not satisfy required version %s from xel.json, please upgrade your engine\n", shared.EngineVersion, v.Engine)
-				continue
-			}
-		} else { // Engine is in development mode
-			// we skip the version check
-			shared.ColorPalette.Warning.Println("Engine is in development mode, skipping version check")
-		}
-
-		if constraint.Check(version) {
-			targetVersion = v
-			break
-		}
-	}
+	return versions, nil
+}
 
-	if targetVersion.ID == -1 {
-		return "", nil, "", "", "", fmt.Errorf("no version found that satisfies the constraint %s for package %s", constraint, moduleName)
+// FindRegistryTarball fetches the tarball of a version of a package from the registry
+func FindRegistryTarball(name, version string) (*RegistryTarball, error) {
+	packageDetails, err := FetchRegistryPackage(name)
+	if err != nil {
+		return nil, err
 	}
-
-	// download the tarball metadata specific to that version constraint
-	resp, err = http.Get(fmt.Sprintf("%s%s%d?limit=1&offset=0", shared.XelConfig.PackageRegistryURI, "tarballs/ver/", targetVersion.ID))
+	versions, err := FetchRegistryVersions(packageDetails.ID)
 	if err != nil {
-		return "", nil, "", "", "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
+	for _, v := range versions {
+		if v.Version == version {
+			return FetchRegistryTarball(v.ID)
+		}
+	}
+	return nil, fmt.Errorf("`%s@%s` %w", name, version, ErrNotInRegistry)
+}
 
-	// Parse the response body
+// FetchRegistryTarball fetches the tarball of a version from the registry
+func FetchRegistryTarball(versionID int) (*RegistryTarball, error) {
 	var tarballMetadata RegistryTarballMetadataResp
-	if err := json.NewDecoder(resp.Body).Decode(&tarballMetadata); err != nil {
-		return "", nil, "", "", "", err
+	if err := registryGet(fmt.Sprintf("tarballs/ver/%d?limit=1&offset=0", versionID), &tarballMetadata); err != nil {
+		return nil, fmt.Errorf("failed to fetch tarball: %w", err)
 	}
 
 	if len(tarballMetadata.Tarballs) == 0 {
-		return "", nil, "", "", "", fmt.Errorf("no tarballs found for version %s", constraint)
+		return nil, fmt.Errorf("no tarballs found for this version")
 	}
 
-	manifestPath, manifest, err := DownloadFromTarball(tarballMetadata.Tarballs[0].URL, tarballMetadata.Tarballs[0].Integrity.Algorithm, tarballMetadata.Tarballs[0].Integrity.Hash, moduleName, targetVersion.Version)
-	if err != nil {
-		return "", nil, "", "", "", err
+	// Lockfiles record where the tarball is, whatever the registry is later
+	tarball := &tarballMetadata.Tarballs[0]
+	if u, err := tarballURL(tarball.URL); err == nil {
+		tarball.URL = u.String()
 	}
-
-	return manifestPath, manifest, tarballMetadata.Tarballs[0].Integrity.Algorithm, tarballMetadata.Tarballs[0].Integrity.Hash, tarballMetadata.Tarballs[0].URL, nil
+	return tarball, nil
 }
 
 func DownloadFromTarball(url, algorithm, hash, name, version string) (string, *shared.ProjectManifest, error) {
@@ -540,16 +552,21 @@ func DownloadFromTarball(url, algorithm, hash, name, version string) (string, *s
 	}
 	defer os.RemoveAll(tempDir)
 
+	// Offline, tarballs that would be downloaded come from the registry's copy instead
+	if shared.XelConfig.Offline && IsRemoteTarball(url) {
+		mirrored, err := FindRegistryTarball(name, version)
+		if err != nil {
+			return "", nil, fmt.Errorf("cannot download %s while offline: %v", url, err)
+		}
+		url = mirrored.URL
+	}
+
 	// download the tarball
-	resp, err := http.Get(url)
+	body, err := OpenTarball(url)
 	if err != nil {
 		return "", nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", nil, fmt.Errorf("failed to download tarball: %s", resp.Status)
-	}
+	defer body.Close()
 
 	out, err := os.Create(filepath.Join(tempDir, "tarball.tar.gz"))
 	if err != nil {
@@ -557,7 +574,7 @@ func DownloadFromTarball(url, algorithm, hash, name, version string) (string, *s
 	}
 	defer out.Close()
 
-	if _, err := io.Copy(out, resp.Body); err != nil {
+	if _, err := io.Copy(out, body); err != nil {
 		return "", nil, err
 	}
 
@@ -595,6 +612,8 @@ func DownloadFromTarball(url, algorithm, hash, name, version string) (string, *s
 		return "", nil, err
 	}
 
+	InvalidateVersionsCache(name)
+
 	// check for setup script
 	if shared.XelConfig.AllowInstallScripts {
 		setupScriptPath := filepath.Join(dest, "setup.xel")
@@ -607,76 +626,36 @@ func DownloadFromTarball(url, algorithm, hash, name, version string) (string, *s
 			if err != nil {
 				return "", nil, err
 			}
-			cmd := exec.Command(xelPath, "run", setupScriptPath)
+			cmd := installScriptCommand(xelPath, dest)
 			cmd.Stderr = os.Stderr
 			cmd.Stdout = os.Stdout
 			cmd.Stdin = os.Stdin
-			cmd.Dir = dest
 			if err := cmd.Run(); err != nil {
+				// a half set up package must not be found as installed
+				os.RemoveAll(dest)
+				InvalidateVersionsCache(name)
 				return "", nil, fmt.Errorf("failed to run setup script: %s\n\nthis is likely not a problem with Xel itself, but with the module you are trying to install", err)
 			}
 		}
 	}
 
+	// remember what was installed, for `xel pkg cache verify`
+	if err := writeInstallRecord(dest, algorithm, hash); err != nil {
+		return "", nil, err
+	}
+
 	return manifestPath, manifest, nil
 }
 
-func DownloadModule(moduleName string, version string, lockfile *shared.Lockfile) (string, *shared.ProjectManifest, error) {
-	ver := version
-	ver = strings.TrimSpace(ver)
-	ver = strings.ToLower(ver)
-
-	versionAliasTable := map[string]string{
-		"latest": ">= 0.0.0",
-		"stable": ">= 1.0.0",
-		"any":    "*",
-	}
-
-	if _, ok := versionAliasTable[ver]; ok {
-		ver = versionAliasTable[ver]
-	}
-
-	var lockedModule struct {
-		Algorithm string "json:\"algorithm\""
-		Hash      string "json:\"hash\""
-		URL       string "json:\"url\""
-		Version   string "json:\"version\""
-	}
-	var ok bool
-	if lockfile != nil {
-		lockedModule, ok = (*lockfile)[moduleName]
-	}
-	if ok {
-		url := lockedModule.URL
-		return DownloadFromTarball(url, lockedModule.Algorithm, lockedModule.Hash, moduleName, lockedModule.Version)
-	}
-
-	var manifestPath string
-	var manifest *shared.ProjectManifest
-	var iAlgo string
-	var iHash string
-	var url string
-	var err error
-	if strings.HasPrefix(moduleName, "git+") {
-		manifestPath, manifest, err = DownloadModuleGit(moduleName[4:], ver)
-	} else {
-		manifestPath, manifest, iAlgo, iHash, url, err = DownloadModuleOnline(moduleName, ver)
-		if err == nil {
-			if lockfile != nil {
-				(*lockfile)[moduleName] = struct {
-					Algorithm string "json:\"algorithm\""
-					Hash      string "json:\"hash\""
-					URL       string "json:\"url\""
-					Version   string "json:\"version\""
-				}{
-					Algorithm: iAlgo,
-					Hash:      iHash,
-					URL:       url,
-					Version:   manifest.Version,
-				}
-			}
-		}
-	}
-
-	return manifestPath, manifest, err
+// installScriptCommand returns the command that runs the setup script of the package installed in dest.
+// Setup scripts run sandboxed, and may only touch their own package: the `permissions` the package
+// declares in its own xel.json are ignored, as --sandbox ignores them.
+func installScriptCommand(xelPath, dest string) *exec.Cmd {
+	cmd := exec.Command(xelPath, "run",
+		"--sandbox",
+		"--allow-read="+dest,
+		"--allow-write="+dest,
+		filepath.Join(dest, "setup.xel"))
+	cmd.Dir = dest
+	return cmd
 }
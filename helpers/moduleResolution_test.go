@@ -0,0 +1,63 @@
+package helpers
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// buildXel builds the xel executable, for tests that need to run it
+func buildXel(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is needed to build xel")
+	}
+	xelPath := filepath.Join(t.TempDir(), "xel")
+	if output, err := exec.Command("go", "build", "-o", xelPath, "github.com/dev-kas/xel").CombinedOutput(); err != nil {
+		t.Fatalf("failed to build xel: %v\n%s", err, output)
+	}
+	return xelPath
+}
+
+func TestInstallScriptSandbox(t *testing.T) {
+	xelPath := buildXel(t)
+	dest, outside := t.TempDir(), t.TempDir()
+
+	// The package grants itself everything, which install scripts ignore
+	manifest := `{"name": "mypkg", "version": "1.0.0", "main": "main.xel", "permissions": {"read": true, "write": true}}`
+	if err := os.WriteFile(filepath.Join(dest, "xel.json"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setup := func(target string) error {
+		t.Helper()
+		src := "const os = import(\"xel:os\")\nos.write(" + strconv.Quote(target) + ", \"set up\")\n"
+		if err := os.WriteFile(filepath.Join(dest, "setup.xel"), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cmd := installScriptCommand(xelPath, dest)
+		output, err := cmd.CombinedOutput()
+		if err != nil && !strings.Contains(string(output), "PermissionError") {
+			t.Errorf("the setup script failed without a PermissionError:\n%s", output)
+		}
+		return err
+	}
+
+	// Inside of its own package, the setup script may write
+	if err := setup(filepath.Join(dest, "generated.txt")); err != nil {
+		t.Errorf("writing inside the package failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "generated.txt")); err != nil {
+		t.Errorf("the setup script did not write inside the package: %v", err)
+	}
+
+	// Anywhere else, it may not
+	if err := setup(filepath.Join(outside, "escaped.txt")); err == nil {
+		t.Error("writing outside of the package succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "escaped.txt")); err == nil {
+		t.Error("the setup script wrote outside of the package")
+	}
+}
@@ -0,0 +1,353 @@
+package helpers
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dev-kas/xel/shared"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// IgnoreFileName is the file listing what a package leaves out of its tarball
+const IgnoreFileName = ".xelignore"
+
+// Paths that are never packed, on top of the ones in the ignore file
+var defaultIgnores = []string{".git/", ".DS_Store", "/" + InstallRecordName}
+
+// Names packages can be published under
+var packageNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// PackedPackage is the tarball of a package, ready to be published
+type PackedPackage struct {
+	Manifest  *shared.ProjectManifest
+	Files     []string // Paths of the packed files, relative to the package, with forward slashes
+	Tarball   []byte   // The .tar.gz itself
+	Algorithm string   // Algorithm of Hash
+	Hash      string   // Integrity hash of Tarball, in hex
+}
+
+// ValidateManifest reports every problem that prevents the package whose
+// manifest is at manifestPath from being published
+func ValidateManifest(manifest *shared.ProjectManifest, manifestPath string) error {
+	problems := []string{}
+
+	if manifest.Name == "" {
+		problems = append(problems, "`name` is missing")
+	} else if !packageNamePattern.MatchString(manifest.Name) {
+		problems = append(problems, fmt.Sprintf("`name` '%s' may only contain lowercase letters, digits, '.', '_' and '-', and must start with a letter or a digit", manifest.Name))
+	}
+
+	if manifest.Version == "" {
+		problems = append(problems, "`version` is missing")
+	} else if _, err := semver.StrictNewVersion(manifest.Version); err != nil {
+		problems = append(problems, fmt.Sprintf("`version` '%s' is not a semantic version such as 1.0.0", manifest.Version))
+	}
+
+	constraints := []struct {
+		field string
+		value *string
+	}{{"xel", manifest.Xel}, {"engine", manifest.Engine}}
+	for _, c := range constraints {
+		if c.value == nil || *c.value == "" {
+			problems = append(problems, fmt.Sprintf("`%s` is missing; it should be the versions the package supports, such as '^%s'", c.field, exampleVersion(c.field)))
+		} else if _, err := semver.NewConstraint(*c.value); err != nil {
+			problems = append(problems, fmt.Sprintf("`%s` '%s' is not a version constraint: %v", c.field, *c.value, err))
+		}
+	}
+
+	if manifest.Main == "" {
+		problems = append(problems, "`main` is missing")
+	} else {
+		mainPath := filepath.Join(filepath.Dir(manifestPath), manifest.Main)
+		if rel, err := filepath.Rel(filepath.Dir(manifestPath), mainPath); err != nil || strings.HasPrefix(rel, "..") {
+			problems = append(problems, fmt.Sprintf("`main` '%s' is outside of the package", manifest.Main))
+		} else if info, err := os.Stat(mainPath); err != nil || !info.Mode().IsRegular() {
+			problems = append(problems, fmt.Sprintf("`main` '%s' does not exist", manifest.Main))
+		}
+	}
+
+	kinds := []struct {
+		field string
+		deps  *map[string]string
+	}{{"deps", manifest.Deps}, {"devDeps", manifest.DevDeps}, {"optionalDeps", manifest.OptionalDeps}, {"peerDeps", manifest.PeerDeps}}
+	listedIn := map[string]string{}
+	for _, kind := range kinds {
+		if kind.deps == nil {
+			continue
+		}
+		for _, name := range sortedKeys(*kind.deps) {
+			_, constraint := ParseDependency((*kind.deps)[name])
+			if _, err := semver.NewConstraint(constraint); err != nil {
+				problems = append(problems, fmt.Sprintf("dependency `%s` in `%s` has an invalid version constraint: %v", name, kind.field, err))
+			}
+			if other, listed := listedIn[name]; listed {
+				problems = append(problems, fmt.Sprintf("dependency `%s` is listed in both `%s` and `%s`", name, other, kind.field))
+			} else {
+				listedIn[name] = kind.field
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s is not ready to be published:\n  %s", manifestPath, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// exampleVersion returns the running version of Xel or of the engine, for messages
+func exampleVersion(field string) string {
+	version := shared.RuntimeVersion
+	if field == "engine" {
+		version = shared.EngineVersion
+	}
+	if version == "" {
+		return "1.0.0"
+	}
+	return version
+}
+
+// PackPackage validates the manifest of the package at manifestPath and builds
+// its tarball with PackFiles
+func PackPackage(manifest *shared.ProjectManifest, manifestPath string) (*PackedPackage, error) {
+	if err := ValidateManifest(manifest, manifestPath); err != nil {
+		return nil, err
+	}
+	return PackFiles(manifest, manifestPath)
+}
+
+// PackFiles builds the tarball of the package at manifestPath. Every file of the
+// package directory is packed, except the ones matched by its ignore file. The
+// tarball only depends on the packed files and their contents, so packing the
+// same files twice gives the same bytes.
+func PackFiles(manifest *shared.ProjectManifest, manifestPath string) (*PackedPackage, error) {
+	root := filepath.Dir(manifestPath)
+	// Tarballs packed earlier are left out too
+	defaults := append([]string{"/" + manifest.Name + "-*.tar.gz"}, defaultIgnores...)
+	ignore, err := readIgnoreFile(filepath.Join(root, IgnoreFileName), defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	err = filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if ignore.matches(rel, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			files = append(files, rel)
+		} else if !entry.IsDir() {
+			shared.ColorPalette.Warning.Printf("Skipping %s, which is not a regular file\n", rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	// These are needed to install the package at all
+	for _, required := range []string{"xel.json", path.Clean(filepath.ToSlash(manifest.Main))} {
+		if i := sort.SearchStrings(files, required); i == len(files) || files[i] != required {
+			return nil, fmt.Errorf("%s is ignored by %s, but packages need it", required, IgnoreFileName)
+		}
+	}
+
+	var buf bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		content, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(file)))
+		if err != nil {
+			return nil, err
+		}
+
+		// Only regular files are written, without their times and owners; ExtractTarGz creates their directories
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     file,
+			Size:     int64(len(content)),
+			Mode:     0644,
+			ModTime:  time.Unix(0, 0),
+			Format:   tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	return &PackedPackage{
+		Manifest:  manifest,
+		Files:     files,
+		Tarball:   buf.Bytes(),
+		Algorithm: "sha256",
+		Hash:      hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// TarballName returns the file name of the tarball of a package
+func (p *PackedPackage) TarballName() string {
+	return fmt.Sprintf("%s-%s.tar.gz", p.Manifest.Name, p.Manifest.Version)
+}
+
+// ignorePattern is a line of an ignore file
+type ignorePattern struct {
+	segments []string // The pattern, split on slashes
+	anchored bool     // Whether it only matches from the package root
+	dirOnly  bool     // Whether it only matches directories
+	negated  bool     // Whether it brings back what earlier patterns ignored
+}
+
+// ignoreRules are the patterns of an ignore file, in order
+type ignoreRules []ignorePattern
+
+// readIgnoreFile parses the ignore file at filePath, which may not exist, after
+// the default patterns. It follows the syntax of .gitignore: one pattern per line,
+// `#` for comments, `!` to negate, a leading `/` to anchor to the root, a trailing
+// `/` to match directories only, and `*`, `?`, `[...]` and `**` as wildcards.
+func readIgnoreFile(filePath string, defaults []string) (ignoreRules, error) {
+	lines := append([]string{}, defaults...)
+
+	f, err := os.Open(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	rules := ignoreRules{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pattern := ignorePattern{}
+		if strings.HasPrefix(line, "!") {
+			pattern.negated = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			pattern.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		// A pattern with a slash before its end is relative to the root, like in .gitignore
+		if strings.Contains(line, "/") {
+			pattern.anchored = true
+			line = strings.TrimLeft(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		pattern.segments = strings.Split(line, "/")
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s' in %s: %v", line, IgnoreFileName, err)
+		}
+		rules = append(rules, pattern)
+	}
+
+	return rules, nil
+}
+
+// matches reports whether the file or directory at rel is ignored
+func (rules ignoreRules) matches(rel string, isDir bool) bool {
+	segments := strings.Split(rel, "/")
+	ignored := false
+	for _, pattern := range rules {
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+
+		matched := false
+		if pattern.anchored {
+			matched = matchSegments(pattern.segments, segments)
+		} else {
+			// Unanchored patterns match at any depth
+			for start := range segments {
+				if matchSegments(pattern.segments, segments[start:]) {
+					matched = true
+					break
+				}
+			}
+		}
+
+		if matched {
+			ignored = !pattern.negated
+		}
+	}
+	return ignored
+}
+
+// matchSegments reports whether the path segments match the pattern segments,
+// where a `**` segment matches any number of path segments
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for skip := 0; skip <= len(segments); skip++ {
+			if matchSegments(pattern[1:], segments[skip:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
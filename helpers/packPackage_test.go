@@ -0,0 +1,120 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dev-kas/xel/shared"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	ignoreFile := filepath.Join(t.TempDir(), IgnoreFileName)
+	lines := []string{
+		"# Comments and blank lines are skipped",
+		"",
+		"*.log",
+		"!keep.log",
+		"/build",
+		"docs/*.md",
+		"**/fixtures/**/*.json",
+		"cache/",
+	}
+	if err := os.WriteFile(ignoreFile, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := readIgnoreFile(ignoreFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		// Unanchored patterns match at any depth, and later negations win
+		{"debug.log", false, true},
+		{"src/debug.log", false, true},
+		{"keep.log", false, false},
+		{"src/keep.log", false, false},
+		{"main.xel", false, false},
+
+		// A leading slash, or a slash inside, anchors to the root
+		{"build", true, true},
+		{"src/build", true, false},
+		{"docs/intro.md", false, true},
+		{"src/docs/intro.md", false, false},
+		{"docs/guide/intro.md", false, false},
+
+		// `**` matches any number of directories, none included
+		{"fixtures/a.json", false, true},
+		{"test/fixtures/deep/er/a.json", false, true},
+		{"test/fixtures/a.xel", false, false},
+
+		// A trailing slash only matches directories
+		{"cache", true, true},
+		{"src/cache", true, true},
+		{"cache", false, false},
+	}
+	for _, c := range cases {
+		if got := rules.matches(c.rel, c.isDir); got != c.want {
+			t.Errorf("matches(%q, dir: %v) = %v, want %v", c.rel, c.isDir, got, c.want)
+		}
+	}
+}
+
+// writeTestPackage writes a package named mypkg into a new directory, with files
+// next to its manifest, and returns the path of the manifest
+func writeTestPackage(t *testing.T, files map[string]string) (*shared.ProjectManifest, string) {
+	t.Helper()
+	dir := t.TempDir()
+	manifest := &shared.ProjectManifest{Name: "mypkg", Version: "1.0.0", Main: "main.xel"}
+	files["xel.json"] = `{"name": "mypkg", "version": "1.0.0", "main": "main.xel"}`
+	for file, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return manifest, filepath.Join(dir, "xel.json")
+}
+
+func TestPackFilesRequiredFiles(t *testing.T) {
+	for _, ignored := range []string{"xel.json", "*.xel", "/main.xel"} {
+		manifest, manifestPath := writeTestPackage(t, map[string]string{"main.xel": "return 1\n", IgnoreFileName: ignored + "\n"})
+		if _, err := PackFiles(manifest, manifestPath); err == nil || !strings.Contains(err.Error(), "packages need it") {
+			t.Errorf("PackFiles ignoring %s = %v, want an error", ignored, err)
+		}
+	}
+}
+
+func TestPackFilesDeterministic(t *testing.T) {
+	manifest, manifestPath := writeTestPackage(t, map[string]string{"main.xel": "return 1\n", "lib/util.xel": "return 2\n"})
+	first, err := PackFiles(manifest, manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the times of the files change
+	later := time.Now().Add(time.Hour)
+	root := filepath.Dir(manifestPath)
+	for _, file := range first.Files {
+		if err := os.Chtimes(filepath.Join(root, filepath.FromSlash(file)), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	second, err := PackFiles(manifest, manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.Hash != first.Hash {
+		t.Errorf("packing again gave the hash %s, want %s", second.Hash, first.Hash)
+	}
+}
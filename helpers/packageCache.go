@@ -0,0 +1,328 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dev-kas/xel/shared"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-git/go-git/v5"
+)
+
+// InstallRecordName is the file written into packages installed from a tarball,
+// recording what they were installed from
+const InstallRecordName = ".xel-install.json"
+
+// ErrCannotVerify is returned for installed packages that have nothing to be checked against
+var ErrCannotVerify = errors.New("cannot be verified")
+
+// installRecord is the content of an install record
+type installRecord struct {
+	Algorithm string `json:"algorithm"` // Algorithm of Hash
+	Hash      string `json:"hash"`      // Integrity hash of the tarball
+	Files     string `json:"files"`     // Hash of the installed files, from hashInstalledFiles
+}
+
+// writeInstallRecord records the tarball a package was installed from, and the
+// files it has once installed
+func writeInstallRecord(dir, algorithm, hash string) error {
+	files, err := hashInstalledFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(installRecord{Algorithm: algorithm, Hash: hash, Files: files}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, InstallRecordName), append(data, '\n'), 0644)
+}
+
+// readInstallRecord reads the install record of the package in dir
+func readInstallRecord(dir string) (*installRecord, error) {
+	data, err := os.ReadFile(filepath.Join(dir, InstallRecordName))
+	if err != nil {
+		return nil, err
+	}
+	record := &installRecord{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", InstallRecordName, err)
+	}
+	return record, nil
+}
+
+// hashInstalledFiles hashes the paths and contents of the files of the package
+// in dir, except its install record and git metadata
+func hashInstalledFiles(dir string) (string, error) {
+	files := []string{}
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if entry.Type().IsRegular() && p != filepath.Join(dir, InstallRecordName) {
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	hasher := sha256.New()
+	for _, file := range files {
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			return "", err
+		}
+		contentHasher := sha256.New()
+		_, err = io.Copy(contentHasher, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hasher, "%s\x00%x\n", file, contentHasher.Sum(nil))
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// TouchPackage records that the package in dir was just used, by an installation
+// or by a script importing it
+func TouchPackage(dir string) {
+	now := time.Now()
+	os.Chtimes(dir, now, now)
+}
+
+// CachedPackage is an installed version of a package, in one of the module paths
+type CachedPackage struct {
+	Name     string
+	Version  string
+	Dir      string    // The directory of this version
+	Size     int64     // Total size of its files, in bytes
+	LastUsed time.Time // When it was last installed or imported
+	Git      bool      // Whether it is a clone of a git repository
+}
+
+// ListCache returns the installed packages of every module path, by name and version
+func ListCache() ([]CachedPackage, error) {
+	packages := []CachedPackage{}
+
+	for _, modulePath := range shared.XelConfig.ModulePaths {
+		dirs, err := os.ReadDir(modulePath)
+		if err != nil {
+			continue // Skip if we can't read this path
+		}
+
+		for _, dir := range dirs {
+			if !dir.IsDir() {
+				continue
+			}
+			subdirs, err := os.ReadDir(filepath.Join(modulePath, dir.Name()))
+			if err != nil {
+				continue
+			}
+
+			for _, subdir := range subdirs {
+				if !subdir.IsDir() {
+					continue
+				}
+				versionDir := filepath.Join(modulePath, dir.Name(), subdir.Name())
+				pkg, ok := readCachedPackage(versionDir)
+				if !ok {
+					continue
+				}
+
+				size, err := directorySize(versionDir)
+				if err != nil {
+					return nil, err
+				}
+				pkg.Size = size
+				packages = append(packages, pkg)
+			}
+		}
+	}
+
+	sort.SliceStable(packages, func(i, j int) bool {
+		if packages[i].Name != packages[j].Name {
+			return packages[i].Name < packages[j].Name
+		}
+		vi, _ := semver.NewVersion(packages[i].Version)
+		vj, _ := semver.NewVersion(packages[j].Version)
+		return vi.LessThan(vj)
+	})
+	return packages, nil
+}
+
+// readCachedPackage reads the package installed in versionDir, which is only one
+// if its manifest has the version the directory is named after, like in GetVersions
+func readCachedPackage(versionDir string) (CachedPackage, bool) {
+	version, err := semver.NewVersion(filepath.Base(versionDir))
+	if err != nil {
+		return CachedPackage{}, false
+	}
+	manifestContent, err := os.ReadFile(filepath.Join(versionDir, "xel.json"))
+	if err != nil {
+		return CachedPackage{}, false
+	}
+	manifest := shared.ProjectManifest{}
+	if err := json.Unmarshal(manifestContent, &manifest); err != nil || manifest.Version != version.String() {
+		return CachedPackage{}, false
+	}
+	info, err := os.Stat(versionDir)
+	if err != nil {
+		return CachedPackage{}, false
+	}
+	_, gitErr := os.Stat(filepath.Join(versionDir, ".git"))
+
+	return CachedPackage{
+		Name:     manifest.Name,
+		Version:  manifest.Version,
+		Dir:      versionDir,
+		LastUsed: info.ModTime(),
+		Git:      gitErr == nil,
+	}, true
+}
+
+// directorySize adds up the sizes of the files in dir
+func directorySize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// RemoveCached deletes an installed package, along with the directory holding
+// its versions once it has none left
+func RemoveCached(pkg CachedPackage) error {
+	if err := os.RemoveAll(pkg.Dir); err != nil {
+		return err
+	}
+	// Fails while other versions are left
+	os.Remove(filepath.Dir(pkg.Dir))
+
+	InvalidateVersionsCache(pkg.Name)
+	return nil
+}
+
+// FindLockfiles returns the paths of the xel.lock files under root. Hidden
+// directories and the module paths are not searched.
+func FindLockfiles(root string) ([]string, error) {
+	skipped := map[string]bool{}
+	for _, modulePath := range shared.XelConfig.ModulePaths {
+		if abs, err := filepath.Abs(modulePath); err == nil {
+			skipped[abs] = true
+		}
+	}
+
+	lockfiles := []string{}
+	err := filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if entry != nil && entry.IsDir() && p != root {
+				shared.ColorPalette.Warning.Printf("Skipping %s: %v\n", p, err)
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() {
+			abs, _ := filepath.Abs(p)
+			if p != root && (strings.HasPrefix(entry.Name(), ".") || skipped[abs]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Name() == "xel.lock" {
+			lockfiles = append(lockfiles, p)
+		}
+		return nil
+	})
+	return lockfiles, err
+}
+
+// VerifyPackage checks that the installed copy of a locked package was installed
+// from what the lockfile records, and has not been modified since. Tarballs are
+// checked against the install record written when they were extracted, and git
+// clones against the locked commit and their working tree. Packages that have
+// neither, or that are not installed, give ErrCannotVerify.
+func VerifyPackage(pkg *shared.LockedPackage) error {
+	version, err := semver.NewVersion(pkg.Version)
+	if err != nil {
+		return fmt.Errorf("invalid version: %v", err)
+	}
+	data, installed := findInstalled(pkg.Name, version)
+	if !installed {
+		return fmt.Errorf("%w: it is not installed", ErrCannotVerify)
+	}
+	dir := filepath.Dir(data.manifestPath)
+
+	if repo, err := git.PlainOpen(dir); err == nil {
+		head, err := repo.Head()
+		if err != nil {
+			return err
+		}
+		if pkg.Source == shared.GitSource && pkg.Hash != "" && head.Hash().String() != pkg.Hash {
+			return fmt.Errorf("it is checked out at commit %s, but commit %s was locked", head.Hash(), pkg.Hash)
+		}
+		worktree, err := repo.Worktree()
+		if err != nil {
+			return err
+		}
+		status, err := worktree.Status()
+		if err != nil {
+			return err
+		}
+		if !status.IsClean() {
+			return fmt.Errorf("its files were modified since it was cloned")
+		}
+		return nil
+	}
+
+	record, err := readInstallRecord(dir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: it has no %s; reinstall it to verify it", ErrCannotVerify, InstallRecordName)
+	}
+	if err != nil {
+		return err
+	}
+	// Git packages installed offline come from a tarball that xel.lock knows nothing about
+	if pkg.Source == shared.RegistrySource && (record.Algorithm != pkg.Algorithm || record.Hash != pkg.Hash) {
+		return fmt.Errorf("it was installed from a tarball with %s hash %s, but xel.lock has %s hash %s", record.Algorithm, record.Hash, pkg.Algorithm, pkg.Hash)
+	}
+
+	files, err := hashInstalledFiles(dir)
+	if err != nil {
+		return err
+	}
+	if files != record.Files {
+		return fmt.Errorf("its files were modified since it was installed")
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dev-kas/xel/shared"
+)
+
+// publishClient uploads packages. The timeout leaves room for large tarballs on
+// slow connections, but keeps a registry that stops answering from hanging forever.
+var publishClient = &http.Client{Timeout: 5 * time.Minute}
+
+// PublishPackage uploads a packed package to the registry, authenticated with
+// token. The registry receives a multipart form at `publish`, holding the
+// tarball and its integrity hash along with the manifest. The registry must be
+// an http or https one (see CheckPublishRegistry).
+func PublishPackage(pkg *PackedPackage, token string) error {
+	if err := CheckPublishRegistry(); err != nil {
+		return err
+	}
+
+	manifestData, err := json.Marshal(pkg.Manifest)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	fields := [][2]string{
+		{"name", pkg.Manifest.Name},
+		{"version", pkg.Manifest.Version},
+		{"xel", *pkg.Manifest.Xel},
+		{"engine", *pkg.Manifest.Engine},
+		{"algorithm", pkg.Algorithm},
+		{"hash", pkg.Hash},
+		{"manifest", string(manifestData)},
+	}
+	for _, field := range fields {
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+	tarball, err := form.CreateFormFile("tarball", pkg.TarballName())
+	if err != nil {
+		return err
+	}
+	if _, err := tarball.Write(pkg.Tarball); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, shared.XelConfig.PackageRegistryURI+"publish", &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := publishClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	message := registryErrorMessage(resp.Body)
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("the registry rejected the token: %s", message)
+	case http.StatusConflict:
+		return fmt.Errorf("`%s@%s` cannot be published again: %s", pkg.Manifest.Name, pkg.Manifest.Version, message)
+	default:
+		return fmt.Errorf("the registry responded with %s: %s", resp.Status, message)
+	}
+}
+
+// CheckPublishRegistry checks that the configured registry can be published to.
+// Registries read from the file system, such as `file://` ones, are only
+// installed from.
+func CheckPublishRegistry() error {
+	registry, err := url.Parse(shared.XelConfig.PackageRegistryURI)
+	if err != nil || (registry.Scheme != "http" && registry.Scheme != "https") || registry.Host == "" {
+		return fmt.Errorf("packages can only be published to an http or https registry, but the registry is `%s`\nset PackageRegistryURI in %s to publish", shared.XelConfig.PackageRegistryURI, filepath.Join(shared.XelDir(), "config.json"))
+	}
+	return nil
+}
+
+// registryErrorMessage reads the reason the registry gives for an error, which
+// is the `error` or `message` of a JSON body, or else the body itself
+func registryErrorMessage(body io.Reader) string {
+	data, _ := io.ReadAll(io.LimitReader(body, 4096))
+
+	var payload struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(data, &payload) == nil {
+		if payload.Error != "" {
+			return payload.Error
+		}
+		if payload.Message != "" {
+			return payload.Message
+		}
+	}
+
+	if message := strings.TrimSpace(string(data)); message != "" {
+		return message
+	}
+	return "no reason given"
+}
@@ -0,0 +1,129 @@
+package helpers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dev-kas/xel/shared"
+)
+
+// publishHandler stands in for the publish endpoint of a registry that accepts
+// token, and already has the versions in published
+func publishHandler(t *testing.T, token string, published map[string]bool, received map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid token"})
+			return
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("the registry received an invalid form: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for key, values := range r.MultipartForm.Value {
+			received[key] = values[0]
+		}
+		if file, _, err := r.FormFile("tarball"); err == nil {
+			tarball, _ := io.ReadAll(file)
+			received["tarball"] = string(tarball)
+		}
+
+		key := r.FormValue("name") + "@" + r.FormValue("version")
+		if published[key] {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"message": "version already exists"})
+			return
+		}
+		published[key] = true
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func TestPublishPackage(t *testing.T) {
+	registry := newTestRegistry(t)
+	published := map[string]bool{}
+	received := map[string]string{}
+	registry.handle("publish", publishHandler(t, "secret", published, received))
+
+	pkg := packTestPackage(t, "mypkg", "1.0.0", map[string]string{"main.xel": "return 1\n"})
+	if err := PublishPackage(pkg, "secret"); err != nil {
+		t.Fatalf("PublishPackage failed: %v", err)
+	}
+
+	want := map[string]string{
+		"name":      "mypkg",
+		"version":   "1.0.0",
+		"xel":       *pkg.Manifest.Xel,
+		"engine":    *pkg.Manifest.Engine,
+		"algorithm": pkg.Algorithm,
+		"hash":      pkg.Hash,
+		"tarball":   string(pkg.Tarball),
+	}
+	for key, value := range want {
+		if received[key] != value {
+			t.Errorf("the registry received %q as `%s`, want %q", received[key], key, value)
+		}
+	}
+	var manifest shared.ProjectManifest
+	if err := json.Unmarshal([]byte(received["manifest"]), &manifest); err != nil || manifest.Name != "mypkg" || manifest.Main != "main.xel" {
+		t.Errorf("the registry received %q as `manifest`, want the manifest of the package", received["manifest"])
+	}
+
+	// The same version cannot be published twice
+	err := PublishPackage(pkg, "secret")
+	if err == nil || !strings.Contains(err.Error(), "cannot be published again: version already exists") {
+		t.Errorf("publishing again gave %v, want a conflict", err)
+	}
+
+	// Nor anything with a token the registry refuses
+	other := packTestPackage(t, "mypkg", "1.1.0", map[string]string{"main.xel": "return 2\n"})
+	err = PublishPackage(other, "wrong")
+	if err == nil || !strings.Contains(err.Error(), "rejected the token: invalid token") {
+		t.Errorf("publishing with a wrong token gave %v, want a rejected token", err)
+	}
+	if published["mypkg@1.1.0"] {
+		t.Error("the registry accepted a wrong token")
+	}
+}
+
+func TestPublishPackageFileRegistry(t *testing.T) {
+	registry := newTestRegistry(t)
+	pkg := packTestPackage(t, "mypkg", "1.0.0", map[string]string{"main.xel": "return 1\n"})
+
+	shared.XelConfig.PackageRegistryURI = "file://" + t.TempDir() + "/"
+	err := PublishPackage(pkg, "secret")
+	if err == nil || !strings.Contains(err.Error(), "only be published to an http or https registry") {
+		t.Errorf("publishing to a file:// registry gave %v", err)
+	}
+	if requests := registry.requested(); len(requests) != 0 {
+		t.Errorf("requested %v, want nothing", requests)
+	}
+}
+
+func TestPublishPackageTimeout(t *testing.T) {
+	registry := newTestRegistry(t)
+	release := make(chan struct{})
+	registry.handle("publish", func(w http.ResponseWriter, r *http.Request) {
+		// The registry does not answer before the test ends
+		<-release
+	})
+	t.Cleanup(func() { close(release) })
+
+	timeout := publishClient.Timeout
+	publishClient.Timeout = 100 * time.Millisecond
+	t.Cleanup(func() { publishClient.Timeout = timeout })
+
+	pkg := packTestPackage(t, "mypkg", "1.0.0", map[string]string{"main.xel": "return 1\n"})
+	if err := PublishPackage(pkg, "secret"); err == nil || !strings.Contains(err.Error(), "Timeout") {
+		t.Errorf("publishing to a registry that does not answer gave %v, want a timeout", err)
+	}
+}
@@ -0,0 +1,119 @@
+package helpers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dev-kas/xel/shared"
+)
+
+// testRegistry stands in for the package registry. It serves the tarballs it
+// was given at `/files/<name>`, and records the paths of every request.
+type testRegistry struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	files    map[string][]byte
+	requests []string
+	handlers map[string]http.HandlerFunc // Extra handlers, by path under the API
+}
+
+// newTestRegistry starts a stand-in registry and points the configuration at it,
+// with a module path of its own, until the test ends
+func newTestRegistry(t *testing.T) *testRegistry {
+	t.Helper()
+
+	r := &testRegistry{files: map[string][]byte{}, handlers: map[string]http.HandlerFunc{}}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		r.requests = append(r.requests, req.URL.Path)
+		content, isFile := r.files[strings.TrimPrefix(req.URL.Path, "/files/")]
+		handler := r.handlers[strings.TrimPrefix(req.URL.Path, "/api/v1/")]
+		r.mu.Unlock()
+
+		switch {
+		case strings.HasPrefix(req.URL.Path, "/files/") && isFile:
+			w.Write(content)
+		case handler != nil:
+			handler(w, req)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(r.Close)
+
+	config := shared.XelConfig
+	shared.XelConfig.PackageRegistryURI = r.URL + "/api/v1/"
+	shared.XelConfig.ModulePaths = []string{t.TempDir()}
+	shared.XelConfig.AllowInstallScripts = false
+	shared.XelConfig.Offline = false
+	InvalidateVersionsCache("")
+	t.Cleanup(func() {
+		shared.XelConfig = config
+		InvalidateVersionsCache("")
+	})
+	return r
+}
+
+// serve makes the registry serve a tarball, and returns its URL
+func (r *testRegistry) serve(name string, content []byte) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files[name] = content
+	return r.URL + "/files/" + name
+}
+
+// handle makes the registry answer requests to path, relative to its API, with handler
+func (r *testRegistry) handle(path string, handler http.HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[path] = handler
+}
+
+// requested returns the paths requested so far, and forgets them
+func (r *testRegistry) requested() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	requests := r.requests
+	r.requests = nil
+	return requests
+}
+
+// packTestPackage packs a package named name at version, made of files
+func packTestPackage(t *testing.T, name, version string, files map[string]string) *PackedPackage {
+	t.Helper()
+
+	dir := t.TempDir()
+	xel, engine := "^0.0.0", "^4.0.0"
+	manifest := &shared.ProjectManifest{
+		Name:    name,
+		Version: version,
+		Xel:     &xel,
+		Engine:  &engine,
+		Main:    "main.xel",
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "xel.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for file, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pkg, err := PackFiles(manifest, filepath.Join(dir, "xel.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
@@ -0,0 +1,50 @@
+package helpers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dev-kas/xel/shared"
+)
+
+// ResolveImport resolves the specifier of an `import` made from the file at
+// fromFile to the path of the script it loads. Local specifiers, starting with
+// a dot, are relative to fromFile. Any other specifier names a package, which
+// has to be listed in deps and is resolved from the module paths; its manifest
+// is returned along with the path of its entry point.
+//
+// Native modules are not handled here.
+func ResolveImport(specifier, fromFile string, deps map[string]string) (string, *shared.ProjectManifest, error) {
+	if specifier == "" {
+		return "", nil, fmt.Errorf("empty import specifier")
+	}
+
+	// Local imports start with './' or '../'
+	if specifier[0] == '.' {
+		return filepath.Join(filepath.Dir(fromFile), specifier+".xel"), nil, nil
+	}
+
+	constraint, exists := deps[specifier]
+	if !exists {
+		return "", nil, fmt.Errorf("Package '%s' is not listed in the project's dependencies", specifier)
+	}
+
+	pkgManifestPath, pkgManifest, err := ResolveModuleLocal(specifier, constraint)
+	if err != nil {
+		return "", nil, fmt.Errorf("Failed to resolve package '%s' (constraint: %s): %v", specifier, constraint, err)
+	}
+
+	return filepath.Join(filepath.Dir(pkgManifestPath), pkgManifest.Main), pkgManifest, nil
+}
+
+// PackageDir returns the directory of the package whose entry point, as ResolveImport
+// resolves it, is entry. It reports false when the entry point lies outside of it.
+func PackageDir(entry string, manifest *shared.ProjectManifest) (string, bool) {
+	main := string(os.PathSeparator) + filepath.Clean(filepath.FromSlash(manifest.Main))
+	if !strings.HasSuffix(entry, main) {
+		return "", false
+	}
+	return strings.TrimSuffix(entry, main), true
+}
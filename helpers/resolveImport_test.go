@@ -0,0 +1,42 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolveImportDoesNotTouch(t *testing.T) {
+	registry := newTestRegistry(t)
+	pkg := packTestPackage(t, "mypkg", "1.1.0", map[string]string{"main.xel": "return 1\n"})
+	if err := InstallLocked(lockTestPackage(registry, pkg)); err != nil {
+		t.Fatalf("InstallLocked failed: %v", err)
+	}
+
+	entry, manifest, err := ResolveImport("mypkg", filepath.Join(t.TempDir(), "main.xel"), map[string]string{"mypkg": "^1.0.0"})
+	if err != nil {
+		t.Fatalf("ResolveImport failed: %v", err)
+	}
+	dir, ok := PackageDir(entry, manifest)
+	if !ok || filepath.Join(dir, "main.xel") != entry {
+		t.Fatalf("PackageDir(%s) = %s, %v", entry, dir, ok)
+	}
+
+	// Editors and `xel check` resolve imports all the time, which is no use of the package
+	lastUsed := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(dir, lastUsed, lastUsed); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ResolveImport("mypkg", filepath.Join(t.TempDir(), "main.xel"), map[string]string{"mypkg": "^1.0.0"}); err != nil {
+		t.Fatalf("ResolveImport failed: %v", err)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.ModTime().Equal(lastUsed) {
+		t.Errorf("resolving the import changed the last use of the package")
+	}
+
+	TouchPackage(dir)
+	if info, err := os.Stat(dir); err != nil || !info.ModTime().After(lastUsed) {
+		t.Errorf("TouchPackage did not record a use of the package")
+	}
+}
@@ -0,0 +1,543 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dev-kas/xel/shared"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// Aliases that can be used instead of a version constraint
+var versionAliasTable = map[string]string{
+	"latest": ">= 0.0.0",
+	"stable": ">= 1.0.0",
+	"any":    "*",
+}
+
+// ParseDependency splits the constraint of a dependency, as written in a manifest.
+// Dependencies installed from git are written `git+<url>#<constraint>`, and
+// their url is returned too; it is empty for the others.
+func ParseDependency(spec string) (string, string) {
+	url := ""
+	constraint := strings.TrimSpace(spec)
+	if strings.HasPrefix(constraint, "git+") {
+		url, constraint = constraint[4:], ""
+		if i := strings.LastIndex(url, "#"); i != -1 {
+			url, constraint = url[:i], url[i+1:]
+		}
+	}
+
+	constraint = strings.ToLower(strings.TrimSpace(constraint))
+	if alias, ok := versionAliasTable[constraint]; ok {
+		constraint = alias
+	}
+	if constraint == "" {
+		constraint = "*"
+	}
+
+	return url, constraint
+}
+
+// LockedSatisfies reports whether a locked package can be used for a dependency
+// written spec, from the same kind of source
+func LockedSatisfies(locked *shared.LockedPackage, spec string) bool {
+	url, constraint := ParseDependency(spec)
+	if (locked.Source == shared.GitSource) != (url != "") || (url != "" && locked.URL != url) {
+		return false
+	}
+
+	versionConstraint, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return false
+	}
+	version, err := semver.NewVersion(locked.Version)
+	return err == nil && versionConstraint.Check(version)
+}
+
+// findInstalled returns the installed copy of a version of a module, if any
+func findInstalled(name string, version *semver.Version) (VersionData, bool) {
+	for installed, data := range GetVersions(name) {
+		if installed.Equal(version) {
+			return data, true
+		}
+	}
+	return VersionData{}, false
+}
+
+// installOffline makes sure a version of a package is installed without using the
+// network, from the registry's copy if it is not installed already
+func installOffline(name string, version *semver.Version) (*shared.ProjectManifest, error) {
+	if data, installed := findInstalled(name, version); installed {
+		return data.manifest, nil
+	}
+
+	tarball, err := FindRegistryTarball(name, version.String())
+	if err != nil {
+		return nil, err
+	}
+	_, manifest, err := DownloadFromTarball(tarball.URL, tarball.Integrity.Algorithm, tarball.Integrity.Hash, name, version.String())
+	return manifest, err
+}
+
+// Resolver builds the dependency graph of a project, and installs the packages in it
+type Resolver struct {
+	Name     string           // Name of the project, used in messages
+	Lockfile *shared.Lockfile // Previous resolution; its versions are kept while they satisfy the constraints
+
+	registry      map[string]*registryListing
+	git           map[string][]*semver.Version
+	warnedOffline bool
+}
+
+// registryListing holds the versions of a package that are available to the resolver
+type registryListing struct {
+	versions []resolverCandidate // Newest first
+	skipped  int                 // Versions that cannot run on this version of Xel
+}
+
+// resolverCandidate is a version a dependency can resolve to
+type resolverCandidate struct {
+	version   *semver.Version
+	source    string
+	versionID int                   // Version in the registry, if any
+	locked    *shared.LockedPackage // Previous resolution, if any
+}
+
+// resolverEdge is a dependency of the project, or of a package in the graph
+type resolverEdge struct {
+	parent   string // Key of the package that depends on it, empty for the project
+	name     string
+	spec     string
+	optional bool // Whether the graph can do without it
+}
+
+// Resolve selects a version for every dependency the project of manifest
+// installs, and for theirs in turn, then installs them. It returns the lockfile
+// of the resulting graph.
+//
+// A version already selected for a package is reused whenever it satisfies a
+// constraint, so that most packages are installed once; when it does not, the
+// package is installed again at another version. Otherwise, the version locked
+// in Lockfile is kept while it satisfies the constraint.
+//
+// Dev dependencies are only installed for the project. Optional dependencies
+// that cannot be installed are skipped with a warning, and left out of the
+// lockfile. The peer dependencies of every package must be satisfied by the
+// dependencies of the project.
+func (r *Resolver) Resolve(manifest *shared.ProjectManifest) (*shared.Lockfile, error) {
+	r.init()
+
+	result := shared.NewLockfile()
+	selected := map[string][]*semver.Version{} // Versions of each package in the graph
+	requirements := map[string][]string{}      // Constraints put on each package, for conflict reports
+	chains := map[string]string{"": r.Name}    // How the project leads to each package
+	peers := map[string]map[string]string{}    // Peer dependencies of each package
+
+	queue := manifestEdges("", manifest, true)
+	for len(queue) > 0 {
+		edge := queue[0]
+		queue = queue[1:]
+
+		url, constraint := ParseDependency(edge.spec)
+		versionConstraint, err := semver.NewConstraint(constraint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint `%s` for `%s`, required by %s: %v", edge.spec, edge.name, r.describe(edge.parent), err)
+		}
+		requirements[edge.name] = append(requirements[edge.name], fmt.Sprintf("`%s` from %s", constraint, r.describe(edge.parent)))
+
+		candidates, err := r.candidates(edge, url, versionConstraint, selected[edge.name])
+		if err != nil && edge.optional {
+			r.skipOptional(edge, err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var pkg *shared.LockedPackage
+		var manifest *shared.ProjectManifest
+		failures := []string{}
+		for _, candidate := range candidates {
+			key := shared.LockKey(edge.name, candidate.version.String())
+			if existing, exists := result.Packages[key]; exists {
+				pkg = existing
+				break
+			}
+
+			pkg, manifest, err = r.install(edge.name, url, candidate)
+			if err == nil {
+				break
+			}
+			failures = append(failures, fmt.Sprintf("%s: %v", candidate.version, err))
+		}
+
+		if pkg == nil {
+			if len(failures) > 0 {
+				err = fmt.Errorf("failed to install `%s`, required by %s:\n  %s", edge.name, r.requiredBy(edge.parent, chains), strings.Join(failures, "\n  "))
+			} else {
+				err = r.conflict(edge, constraint, r.requiredBy(edge.parent, chains), requirements[edge.name])
+			}
+			if edge.optional {
+				r.skipOptional(edge, err)
+				continue
+			}
+			return nil, err
+		}
+
+		key := shared.LockKey(pkg.Name, pkg.Version)
+		if edge.parent == "" {
+			result.Deps[edge.name] = pkg.Version
+		} else {
+			result.Packages[edge.parent].Deps[edge.name] = pkg.Version
+		}
+
+		if manifest == nil {
+			continue // Already in the graph
+		}
+
+		result.Packages[key] = pkg
+		selected[edge.name] = append(selected[edge.name], semver.MustParse(pkg.Version))
+		chains[key] = chains[edge.parent] + " → " + key
+
+		pkg.Deps = map[string]string{}
+		queue = append(queue, manifestEdges(key, manifest, false)...)
+		if manifest.PeerDeps != nil {
+			peers[key] = *manifest.PeerDeps
+		}
+	}
+
+	for _, pkg := range result.Packages {
+		if len(pkg.Deps) == 0 {
+			pkg.Deps = nil
+		}
+	}
+
+	problems := []string{}
+	for _, key := range sortedKeys(peers) {
+		problems = append(problems, peerProblems(result, key, peers[key])...)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("peer dependencies are not satisfied:\n  %s\nadd them to the dependencies of %s", strings.Join(problems, "\n  "), r.Name)
+	}
+
+	return result, nil
+}
+
+// skipOptional warns that an optional dependency is left out of the graph
+func (r *Resolver) skipOptional(edge resolverEdge, err error) {
+	shared.ColorPalette.Warning.Printf("Skipping optional dependency `%s` of %s: %v\n", edge.name, r.describe(edge.parent), err)
+}
+
+// peerProblems reports the peer dependencies of the package at key that the
+// dependencies of the project, as locked, do not satisfy
+func peerProblems(lockfile *shared.Lockfile, key string, peers map[string]string) []string {
+	problems := []string{}
+	for _, name := range sortedKeys(peers) {
+		spec := peers[name]
+		version, listed := lockfile.Deps[name]
+		if !listed {
+			problems = append(problems, fmt.Sprintf("`%s` needs `%s` %s alongside it, but the project does not depend on it", key, name, spec))
+		} else if locked := lockfile.Locked("", name); locked == nil || !LockedSatisfies(locked, spec) {
+			problems = append(problems, fmt.Sprintf("`%s` needs `%s` %s alongside it, but the project has `%s`", key, name, spec, shared.LockKey(name, version)))
+		}
+	}
+	return problems
+}
+
+// Versions returns the versions that the dependency name, written spec, can be
+// installed at, newest first, whether they satisfy its constraint or not
+func (r *Resolver) Versions(name, spec string) ([]*semver.Version, error) {
+	r.init()
+
+	// Offline, the versions of git packages are the installed or mirrored ones, like in candidates
+	if url, _ := ParseDependency(spec); url != "" && !shared.XelConfig.Offline {
+		return r.gitVersions(url)
+	}
+
+	listing, err := r.registryVersions(name)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]*semver.Version, 0, len(listing.versions))
+	for _, candidate := range listing.versions {
+		versions = append(versions, candidate.version)
+	}
+	return versions, nil
+}
+
+// init prepares the caches of the resolver
+func (r *Resolver) init() {
+	if r.registry == nil {
+		r.registry = map[string]*registryListing{}
+		r.git = map[string][]*semver.Version{}
+	}
+}
+
+// manifestEdges returns the dependencies the package at parent installs, by
+// name, given its manifest and whether it is the project
+func manifestEdges(parent string, manifest *shared.ProjectManifest, root bool) []resolverEdge {
+	deps := manifest.InstalledDeps(root)
+	edges := make([]resolverEdge, 0, len(deps))
+	for _, name := range sortedKeys(deps) {
+		edges = append(edges, resolverEdge{parent: parent, name: name, spec: deps[name], optional: manifest.IsOptional(name)})
+	}
+	return edges
+}
+
+// describe names the package at key, or the project when key is empty
+func (r *Resolver) describe(key string) string {
+	if key == "" {
+		return r.Name
+	}
+	return key
+}
+
+// requiredBy describes the package at key, and how the project leads to it
+func (r *Resolver) requiredBy(key string, chains map[string]string) string {
+	if key == "" {
+		return r.Name
+	}
+	return fmt.Sprintf("%s (%s)", key, chains[key])
+}
+
+// candidates returns the versions that edge may resolve to, in order of preference:
+// the newest version already in the graph, else the version it was locked to, else
+// the newest versions available
+func (r *Resolver) candidates(edge resolverEdge, url string, constraint *semver.Constraints, selected []*semver.Version) ([]resolverCandidate, error) {
+	var newest *semver.Version
+	for _, version := range selected {
+		if constraint.Check(version) && (newest == nil || version.GreaterThan(newest)) {
+			newest = version
+		}
+	}
+	if newest != nil {
+		return []resolverCandidate{{version: newest}}, nil
+	}
+
+	if r.Lockfile != nil {
+		if locked := r.Lockfile.Locked(edge.parent, edge.name); locked != nil && LockedSatisfies(locked, edge.spec) {
+			return []resolverCandidate{{version: semver.MustParse(locked.Version), source: locked.Source, locked: locked}}, nil
+		}
+	}
+
+	var available []resolverCandidate
+	if url != "" && shared.XelConfig.Offline {
+		// The repository cannot be reached, but copies of its versions may be installed or mirrored
+		listing, err := r.registryVersions(edge.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, candidate := range listing.versions {
+			available = append(available, resolverCandidate{version: candidate.version, source: shared.GitSource})
+		}
+	} else if url != "" {
+		versions, err := r.gitVersions(url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the versions of `%s` at %s: %v", edge.name, url, err)
+		}
+		for _, version := range versions {
+			available = append(available, resolverCandidate{version: version, source: shared.GitSource})
+		}
+	} else {
+		listing, err := r.registryVersions(edge.name)
+		if err != nil {
+			return nil, err
+		}
+		available = listing.versions
+	}
+
+	candidates := []resolverCandidate{}
+	for _, candidate := range available {
+		if constraint.Check(candidate.version) {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	return candidates, nil
+}
+
+// gitVersions returns the versions tagged in the git repository at url
+func (r *Resolver) gitVersions(url string) ([]*semver.Version, error) {
+	if versions, ok := r.git[url]; ok {
+		return versions, nil
+	}
+	versions, err := ListGitVersions(url)
+	if err != nil {
+		return nil, err
+	}
+	r.git[url] = versions
+	return versions, nil
+}
+
+// registryVersions returns the versions of a package that can be installed from
+// the registry, or that are installed already
+func (r *Resolver) registryVersions(name string) (*registryListing, error) {
+	if listing, ok := r.registry[name]; ok {
+		return listing, nil
+	}
+
+	listing := &registryListing{}
+	known := map[string]bool{}
+
+	var versions []RegistryPackageVersionRespMetadata
+	packageDetails, err := FetchRegistryPackage(name)
+	if err == nil {
+		versions, err = FetchRegistryVersions(packageDetails.ID)
+	}
+	if err != nil {
+		// Installed versions can still be used when the registry is unreachable, or has no such package
+		if len(GetVersions(name)) == 0 {
+			return nil, err
+		}
+		if !errors.Is(err, ErrNotInRegistry) && !errors.Is(err, ErrOffline) && !r.warnedOffline {
+			shared.ColorPalette.Warning.Printf("Cannot reach the registry (%v), using installed packages only\n", err)
+			r.warnedOffline = true
+		}
+	}
+
+	for _, v := range versions {
+		version, err := semver.NewVersion(v.Version)
+		if err != nil {
+			continue
+		}
+		if CheckCompatibility(v.Xel, v.Engine) != nil {
+			listing.skipped++
+			continue
+		}
+		known[version.String()] = true
+		listing.versions = append(listing.versions, resolverCandidate{version: version, source: shared.RegistrySource, versionID: v.ID})
+	}
+
+	// Installed versions the registry does not have can be used as they are
+	for version, data := range GetVersions(name) {
+		if known[version.String()] {
+			continue
+		}
+		xelConstraint, engineConstraint := "", ""
+		if data.manifest.Xel != nil {
+			xelConstraint = *data.manifest.Xel
+		}
+		if data.manifest.Engine != nil {
+			engineConstraint = *data.manifest.Engine
+		}
+		if CheckCompatibility(xelConstraint, engineConstraint) != nil {
+			listing.skipped++
+			continue
+		}
+		listing.versions = append(listing.versions, resolverCandidate{version: version, source: shared.LocalSource})
+	}
+
+	sort.SliceStable(listing.versions, func(i, j int) bool {
+		return listing.versions[i].version.GreaterThan(listing.versions[j].version)
+	})
+
+	r.registry[name] = listing
+	return listing, nil
+}
+
+// install makes sure the candidate version of a package is installed, and returns
+// its lockfile entry and manifest
+func (r *Resolver) install(name, url string, candidate resolverCandidate) (*shared.LockedPackage, *shared.ProjectManifest, error) {
+	version := candidate.version.String()
+	pkg := &shared.LockedPackage{Name: name, Version: version, Source: candidate.source}
+
+	if candidate.source == shared.GitSource {
+		if url == "" && candidate.locked != nil {
+			url = candidate.locked.URL
+		}
+		if shared.XelConfig.Offline {
+			// The commit cannot be known without the repository, unless it was locked
+			manifest, err := installOffline(name, candidate.version)
+			if err != nil {
+				return nil, nil, err
+			}
+			pkg.URL = url
+			if candidate.locked != nil {
+				pkg.Hash = candidate.locked.Hash
+			}
+			return pkg, manifest, nil
+		}
+
+		_, manifest, commit, err := InstallGitVersion(url, candidate.version)
+		if err != nil {
+			return nil, nil, err
+		}
+		if manifest.Name != name {
+			return nil, nil, fmt.Errorf("the repository holds package `%s`", manifest.Name)
+		}
+		pkg.URL, pkg.Hash = url, commit
+		return pkg, manifest, nil
+	}
+
+	// Where the package can be downloaded from is recorded even when it is installed already
+	locked := candidate.locked
+	if locked == nil && r.Lockfile != nil {
+		locked = r.Lockfile.Packages[shared.LockKey(name, version)]
+	}
+	if locked != nil && locked.Source == shared.RegistrySource {
+		pkg.Source, pkg.URL, pkg.Algorithm, pkg.Hash = locked.Source, locked.URL, locked.Algorithm, locked.Hash
+	} else if candidate.versionID != 0 {
+		tarball, err := FetchRegistryTarball(candidate.versionID)
+		if err != nil {
+			return nil, nil, err
+		}
+		pkg.Source, pkg.URL, pkg.Algorithm, pkg.Hash = shared.RegistrySource, tarball.URL, tarball.Integrity.Algorithm, tarball.Integrity.Hash
+	}
+
+	if data, installed := findInstalled(name, candidate.version); installed {
+		if pkg.URL == "" {
+			pkg.Source = shared.LocalSource
+		}
+		TouchPackage(filepath.Dir(data.manifestPath))
+		return pkg, data.manifest, nil
+	}
+
+	if pkg.URL == "" {
+		return nil, nil, fmt.Errorf("it is not installed, and the registry has no tarball for it")
+	}
+
+	_, manifest, err := DownloadFromTarball(pkg.URL, pkg.Algorithm, pkg.Hash, name, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	shared.ColorPalette.Info.Printf("Installed `%s@%s`\n", name, version)
+	return pkg, manifest, nil
+}
+
+// conflict explains why no version satisfies the constraint of edge
+func (r *Resolver) conflict(edge resolverEdge, constraint, requiredBy string, requirements []string) error {
+	lines := []string{fmt.Sprintf("no version of `%s` satisfies `%s`, required by %s", edge.name, constraint, requiredBy)}
+
+	if len(requirements) > 1 {
+		lines = append(lines, "  all requirements: "+strings.Join(requirements, ", "))
+	}
+
+	available := []string{}
+	skipped := 0
+	if url, _ := ParseDependency(edge.spec); url != "" {
+		for _, version := range r.git[url] {
+			available = append(available, version.String())
+		}
+	} else if listing, ok := r.registry[edge.name]; ok {
+		for _, candidate := range listing.versions {
+			available = append(available, candidate.version.String())
+		}
+		skipped = listing.skipped
+	}
+
+	if len(available) == 0 {
+		lines = append(lines, "  available versions: none")
+	} else {
+		lines = append(lines, "  available versions: "+strings.Join(available, ", "))
+	}
+	if skipped > 0 {
+		lines = append(lines, fmt.Sprintf("  %d more version(s) cannot run on this version of Xel", skipped))
+	}
+
+	return errors.New(strings.Join(lines, "\n"))
+}
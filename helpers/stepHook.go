@@ -0,0 +1,117 @@
+package helpers
+
+import (
+	"sync"
+
+	"github.com/dev-kas/virtlang-go/v4/ast"
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+)
+
+// StepFunctionName is the global that InstrumentSteps calls before every statement
+const StepFunctionName = "__step__"
+
+// StepHook is run before every statement of the programs InstrumentSteps
+// prepared, on the goroutine evaluating them, with the environment and the
+// location of the statement. An error stops the evaluation there.
+type StepHook func(env *environment.Environment, file string, line int) *errors.RuntimeError
+
+var stepHook StepHook
+var stepHookMu sync.RWMutex
+
+// SetStepHook makes hook run before every statement of the programs parsed from
+// now on, or stops instrumenting them when hook is nil
+func SetStepHook(hook StepHook) {
+	stepHookMu.Lock()
+	defer stepHookMu.Unlock()
+	stepHook = hook
+}
+
+// RunStepHook runs the hook set with SetStepHook, if any, for a statement, once
+// it checked that the evaluation was not interrupted
+func RunStepHook(env *environment.Environment, file string, line int) *errors.RuntimeError {
+	if err := checkInterrupted(); err != nil {
+		return err
+	}
+
+	stepHookMu.RLock()
+	hook := stepHook
+	stepHookMu.RUnlock()
+
+	if hook == nil {
+		return nil
+	}
+	return hook(env, file, line)
+}
+
+// InstrumentSteps makes every statement of program call `__step__` with its
+// location before it runs, when a step hook is set or interrupts are enabled.
+// The evaluator's debugger cannot be observed from another goroutine while it
+// runs, so the debug adapter stops scripts from this call instead, and
+// InterruptEvaluation stops them there. Loops with an empty body get a call too,
+// so that they can be interrupted.
+func InstrumentSteps(program *ast.Program) {
+	stepHookMu.RLock()
+	enabled := stepHook != nil
+	stepHookMu.RUnlock()
+	if !enabled && !interruptible.Load() {
+		return
+	}
+
+	instrument := func(stmts []ast.Stmt) []ast.Stmt {
+		instrumented := make([]ast.Stmt, 0, len(stmts)*2)
+		for _, stmt := range stmts {
+			if isStepCall(stmt) {
+				return stmts
+			}
+			instrumented = append(instrumented, stepCall(stmt.GetSourceMetadata()), stmt)
+		}
+		return instrumented
+	}
+
+	WalkAST(program, func(node ast.Stmt) bool {
+		switch n := node.(type) {
+		case *ast.Program:
+			n.Stmts = instrument(n.Stmts)
+		case *ast.FnDeclaration:
+			n.Body = instrument(n.Body)
+		case *ast.ClassMethod:
+			n.Body = instrument(n.Body)
+		case *ast.IfStatement:
+			n.Body = instrument(n.Body)
+			n.Else = instrument(n.Else)
+		case *ast.WhileLoop:
+			if len(n.Body) == 0 {
+				n.Body = []ast.Stmt{stepCall(n.GetSourceMetadata())}
+			} else {
+				n.Body = instrument(n.Body)
+			}
+		case *ast.TryCatchStmt:
+			n.Try = instrument(n.Try)
+			n.Catch = instrument(n.Catch)
+		}
+		return true
+	})
+}
+
+// stepCall returns a call to `__step__` with the location of metadata
+func stepCall(metadata ast.SourceMetadata) *ast.CallExpr {
+	return &ast.CallExpr{
+		Callee: &ast.Identifier{Symbol: StepFunctionName, SourceMetadata: metadata},
+		Args: []ast.Expr{
+			&ast.StringLiteral{Value: metadata.Filename, SourceMetadata: metadata},
+			&ast.NumericLiteral{Value: float64(metadata.StartLine), SourceMetadata: metadata},
+		},
+		SourceMetadata: metadata,
+	}
+}
+
+// isStepCall reports whether stmt is a call InstrumentSteps added
+func isStepCall(stmt ast.Stmt) bool {
+	call, ok := stmt.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	callee, ok := call.Callee.(*ast.Identifier)
+	return ok && callee.Symbol == StepFunctionName
+}
@@ -0,0 +1,82 @@
+package helpers
+
+import "github.com/dev-kas/virtlang-go/v4/ast"
+
+// WalkAST calls visit for node and then, in source order, for every node nested
+// inside it. When visit returns false, the children of that node are skipped.
+func WalkAST(node ast.Stmt, visit func(node ast.Stmt) bool) {
+	if node == nil || !visit(node) {
+		return
+	}
+
+	walkList := func(nodes []ast.Stmt) {
+		for _, child := range nodes {
+			WalkAST(child, visit)
+		}
+	}
+
+	switch n := node.(type) {
+	case *ast.Program:
+		walkList(n.Stmts)
+	case *ast.VarDeclaration:
+		WalkAST(n.Value, visit)
+	case *ast.TryCatchStmt:
+		walkList(n.Try)
+		walkList(n.Catch)
+	case *ast.FnDeclaration:
+		walkList(n.Body)
+	case *ast.IfStatement:
+		WalkAST(n.Condition, visit)
+		walkList(n.Body)
+		for _, elseIf := range n.ElseIf {
+			WalkAST(elseIf, visit)
+		}
+		walkList(n.Else)
+	case *ast.Class:
+		if n.Constructor != nil {
+			WalkAST(n.Constructor, visit)
+		}
+		walkList(n.Body)
+	case *ast.ClassMethod:
+		walkList(n.Body)
+	case *ast.ClassProperty:
+		WalkAST(n.Value, visit)
+	case *ast.WhileLoop:
+		WalkAST(n.Condition, visit)
+		walkList(n.Body)
+	case *ast.ReturnStmt:
+		WalkAST(n.Value, visit)
+	case *ast.VarAssignmentExpr:
+		WalkAST(n.Assignee, visit)
+		WalkAST(n.Value, visit)
+	case *ast.BinaryExpr:
+		WalkAST(n.LHS, visit)
+		WalkAST(n.RHS, visit)
+	case *ast.CompareExpr:
+		WalkAST(n.LHS, visit)
+		WalkAST(n.RHS, visit)
+	case *ast.LogicalExpr:
+		if n.LHS != nil {
+			WalkAST(*n.LHS, visit)
+		}
+		WalkAST(n.RHS, visit)
+	case *ast.CallExpr:
+		WalkAST(n.Callee, visit)
+		for _, arg := range n.Args {
+			WalkAST(arg, visit)
+		}
+	case *ast.MemberExpr:
+		WalkAST(n.Object, visit)
+		WalkAST(n.Value, visit)
+	case *ast.ObjectLiteral:
+		for i := range n.Properties {
+			WalkAST(&n.Properties[i], visit)
+		}
+	case *ast.Property:
+		WalkAST(n.Value, visit)
+	case *ast.ArrayLiteral:
+		for _, element := range n.Elements {
+			WalkAST(element, visit)
+		}
+	}
+}
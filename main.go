@@ -5,10 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
-	"os/signal"
 	"path/filepath"
-	"strings"
-	"syscall"
 	"time"
 
 	"github.com/dev-kas/xel/cmds"
@@ -18,24 +15,43 @@ import (
 
 	_ "github.com/dev-kas/xel/modules/array"
 	_ "github.com/dev-kas/xel/modules/classes"
+	_ "github.com/dev-kas/xel/modules/crypto"
+	_ "github.com/dev-kas/xel/modules/encoding"
+	_ "github.com/dev-kas/xel/modules/http"
+	_ "github.com/dev-kas/xel/modules/json"
 	_ "github.com/dev-kas/xel/modules/math"
 	_ "github.com/dev-kas/xel/modules/native"
 	_ "github.com/dev-kas/xel/modules/object"
 	_ "github.com/dev-kas/xel/modules/os"
+	_ "github.com/dev-kas/xel/modules/regex"
 	_ "github.com/dev-kas/xel/modules/strings"
+	_ "github.com/dev-kas/xel/modules/test"
 	_ "github.com/dev-kas/xel/modules/threads"
 	_ "github.com/dev-kas/xel/modules/time"
 
-	"github.com/chzyer/readline"
-	"github.com/dev-kas/virtlang-go/v4/environment"
-	"github.com/dev-kas/virtlang-go/v4/evaluator"
-	"github.com/dev-kas/virtlang-go/v4/parser"
 	"github.com/fatih/color"
 	"github.com/urfave/cli/v2"
 )
 
 func main() {
 	globals.Globalize(shared.XelRootEnv)
+
+	// Executables produced by `xel build` run their bundled project instead of the CLI
+	bundleDir, err := helpers.OpenBundle()
+	if err != nil {
+		shared.ColorPalette.Error.Println(err.Error())
+		os.Exit(1)
+	}
+	if bundleDir != "" {
+		err := cmds.RunBundle(bundleDir, os.Args[1:])
+		os.RemoveAll(bundleDir)
+		if err != nil {
+			shared.ColorPalette.Error.Println(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	cli.VersionPrinter = func(c *cli.Context) {
 		fmt.Printf("VirtLang Engine version: %s - Xel version: %s \n", shared.ColorPalette.Version(shared.EngineVersion), shared.ColorPalette.Version(c.App.Version))
 	}
@@ -45,98 +61,7 @@ func main() {
 		Usage:    "A runtime for VirtLang",
 		Version:  shared.RuntimeVersion,
 		Commands: cmds.GetCommands(),
-		Action: func(c *cli.Context) error {
-			shared.ColorPalette.Welcome("Welcome to Xel v%s REPL (VirtLang v%s)!", shared.RuntimeVersion, shared.EngineVersion)
-			shared.ColorPalette.GrayMessage.Println("Type '!exit' to exit the REPL.")
-
-			rl, err := readline.NewEx(&readline.Config{
-				Prompt:            shared.ColorPalette.PromptStr("> "),
-				HistoryFile:       filepath.Join(os.TempDir(), "xel_history.tmp"),
-				InterruptPrompt:   "^C",
-				EOFPrompt:         "!exit",
-				HistorySearchFold: true,
-			})
-			if err != nil {
-				shared.ColorPalette.Error.Printf("Error initializing readline: %s", err.Error())
-				return err
-			}
-			sigChan := make(chan os.Signal, 1)
-			signal.Notify(sigChan, syscall.SIGINT)
-			defer rl.Close()
-			env := environment.NewEnvironment(shared.XelRootEnv)
-			for {
-				inputChan := make(chan string, 1)
-				errChan := make(chan error, 1)
-
-				go func() {
-					input, err := rl.Readline()
-					if err != nil {
-						errChan <- err
-					} else {
-						inputChan <- input
-					}
-				}()
-
-				select {
-				case sig := <-sigChan:
-					if sig == syscall.SIGINT {
-						shared.ColorPalette.GrayMessage.Print("TODO: Stop current execution")
-						continue
-					}
-				case err := <-errChan:
-					if err.Error() == "EOF" {
-						shared.ColorPalette.ExitMessage.Println("Exiting REPL.")
-						return nil
-					}
-					if err.Error() == "Interrupt" {
-						shared.ColorPalette.GrayMessage.Print("TODO: Stop current execution")
-						continue
-					}
-					shared.ColorPalette.Error.Printf("Error reading line: %s", err.Error())
-				case line := <-inputChan:
-					if line == "!exit" {
-						shared.ColorPalette.ExitMessage.Println("Exiting REPL.")
-						return nil
-					}
-					if line == "" {
-						continue
-					}
-
-					p := parser.New("<REPL>")
-					program, err := p.ProduceAST(line)
-					if err != nil {
-						shared.ColorPalette.Error.Printf("Error: %s\n", err.Error())
-						continue
-					}
-
-					output, oerr := evaluator.Evaluate(program, env, shared.XelRootDebugger)
-					if oerr != nil && len(shared.XelRootDebugger.Snapshots) > 0 {
-						stackTrace := shared.XelRootDebugger.Snapshots[0]
-						stackTraceStr := helpers.GenerateStackTrace(stackTrace.Stack, "")
-						shared.ColorPalette.Error.Println(stackTraceStr)
-						shared.ColorPalette.Error.Printf("Error: %s\n", oerr.Error())
-						shared.XelRootDebugger.Snapshots = nil
-
-						continue
-					}
-					if output != nil {
-						outputStr := helpers.Stringify(*output, true)
-						lines := strings.Split(outputStr, "\n")
-						for i, line := range lines {
-							if i == 0 {
-								shared.ColorPalette.GrayMessage.Printf("< %s", line)
-							} else {
-								shared.ColorPalette.GrayMessage.Printf("  %s", line)
-							}
-							if i < len(lines)-1 {
-								fmt.Println()
-							}
-						}
-						fmt.Println()
-					}
-				}
-			}
-		},
+		Action:   cmds.StartREPL,
 	}
 
 	homedir, err := os.UserHomeDir()
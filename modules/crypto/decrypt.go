@@ -0,0 +1,42 @@
+package crypto
+
+import (
+	"fmt"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Decrypts the output of encrypt(), and fails if it was tampered with or the key is wrong
+var decrypt = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, &errors.RuntimeError{Message: "decrypt() takes 2 or 3 arguments"}
+	}
+	encoding, err := encodingArg("decrypt", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM("decrypt", args[0], encoding)
+	if err != nil {
+		return nil, err
+	}
+	if args[1].Type != shared.String {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("decrypt() expects string as data, got %s", shared.Stringify(args[1].Type))}
+	}
+
+	sealed, decodeErr := decode(args[1].Value.(string), encoding)
+	if decodeErr != nil || len(sealed) < gcm.NonceSize() {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("decrypt() the data is not valid %s output of encrypt()", encoding)}
+	}
+
+	nonce, data := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plain, openErr := gcm.Open(nil, nonce, data, nil)
+	if openErr != nil {
+		return nil, &errors.RuntimeError{Message: "decrypt() failed: the key is wrong or the data was tampered with"}
+	}
+
+	retVal := values.MK_STRING(string(plain))
+	return &retVal, nil
+})
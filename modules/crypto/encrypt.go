@@ -0,0 +1,59 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// newGCM returns the AES-GCM cipher for the key argument of fnName, which holds 16, 24 or 32 bytes in encoding
+func newGCM(fnName string, key shared.RuntimeValue, encoding string) (cipher.AEAD, *errors.RuntimeError) {
+	if key.Type != shared.String {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() expects string as key, got %s", fnName, shared.Stringify(key.Type))}
+	}
+	keyBytes, err := decode(key.Value.(string), encoding)
+	if err != nil {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() the key is not valid %s", fnName, encoding)}
+	}
+
+	block, err := aes.NewCipher(keyBytes)
+	if err != nil {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() the key must be 16, 24 or 32 bytes long, got %d", fnName, len(keyBytes))}
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() %v", fnName, err)}
+	}
+	return gcm, nil
+}
+
+// Encrypts a string with AES-GCM. The result holds the random nonce followed by the sealed data.
+var encrypt = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, &errors.RuntimeError{Message: "encrypt() takes 2 or 3 arguments"}
+	}
+	encoding, err := encodingArg("encrypt", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM("encrypt", args[0], encoding)
+	if err != nil {
+		return nil, err
+	}
+	if args[1].Type != shared.String {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("encrypt() expects string as data, got %s", shared.Stringify(args[1].Type))}
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+	sealed := gcm.Seal(nonce, nonce, []byte(args[1].Value.(string)), nil)
+
+	retVal := encode(sealed, encoding)
+	return &retVal, nil
+})
@@ -0,0 +1,21 @@
+package crypto
+
+import (
+	"crypto/subtle"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Compares two strings in constant time, so that comparing secrets such as signatures does not leak them
+var equal = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) != 2 || args[0].Type != shared.String || args[1].Type != shared.String {
+		return nil, &errors.RuntimeError{Message: "equal() expects 2 strings"}
+	}
+
+	same := subtle.ConstantTimeCompare([]byte(args[0].Value.(string)), []byte(args[1].Value.(string))) == 1
+	retVal := values.MK_BOOL(same)
+	return &retVal, nil
+})
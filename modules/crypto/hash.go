@@ -0,0 +1,34 @@
+package crypto
+
+import (
+	"fmt"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Hashes a string with md5, sha1, sha256 or sha512, and returns the digest in hex or base64
+var hash_ = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, &errors.RuntimeError{Message: "hash() takes 2 or 3 arguments"}
+	}
+	hasher, err := hasherArg("hash", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if args[1].Type != shared.String {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("hash() expects string as data, got %s", shared.Stringify(args[1].Type))}
+	}
+	encoding, err := encodingArg("hash", args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	h := hasher()
+	h.Write([]byte(args[1].Value.(string)))
+
+	retVal := encode(h.Sum(nil), encoding)
+	return &retVal, nil
+})
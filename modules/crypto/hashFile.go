@@ -0,0 +1,58 @@
+package crypto
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/dev-kas/xel/helpers"
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Hashes the content of a file, without loading all of it in memory
+var hashFile = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, &errors.RuntimeError{Message: "hashFile() takes 2 or 3 arguments"}
+	}
+	hasher, err := hasherArg("hashFile", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if args[1].Type != shared.String {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("hashFile() expects string as path, got %s", shared.Stringify(args[1].Type))}
+	}
+	encoding, err := encodingArg("hashFile", args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	// Relative paths are resolved against the directory of the running script, like in xel:os
+	path := args[1].Value.(string)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(xShared.XelRootDebugger.CurrentFile), path)
+	}
+	path = filepath.Clean(path)
+	if err := xShared.XelPermissions.Check(xShared.ReadPermission, path); err != nil {
+		return nil, helpers.SystemError(err)
+	}
+
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		return nil, helpers.SystemError(openErr)
+	}
+	defer file.Close()
+
+	h := hasher()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, helpers.SystemError(err)
+	}
+
+	retVal := encode(h.Sum(nil), encoding)
+	return &retVal, nil
+})
@@ -0,0 +1,35 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"fmt"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Computes the HMAC of a string with a key, using md5, sha1, sha256 or sha512
+var hmac_ = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) < 3 || len(args) > 4 {
+		return nil, &errors.RuntimeError{Message: "hmac() takes 3 or 4 arguments"}
+	}
+	hasher, err := hasherArg("hmac", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if args[1].Type != shared.String || args[2].Type != shared.String {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("hmac() expects strings as key and data, got %s and %s", shared.Stringify(args[1].Type), shared.Stringify(args[2].Type))}
+	}
+	encoding, err := encodingArg("hmac", args, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(hasher, []byte(args[1].Value.(string)))
+	mac.Write([]byte(args[2].Value.(string)))
+
+	retVal := encode(mac.Sum(nil), encoding)
+	return &retVal, nil
+})
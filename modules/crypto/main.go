@@ -0,0 +1,86 @@
+package crypto
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+
+	"github.com/dev-kas/xel/modules"
+
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+var hashers = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// hasherArg returns the hash function named by the algorithm argument of fnName
+func hasherArg(fnName string, arg shared.RuntimeValue) (func() hash.Hash, *errors.RuntimeError) {
+	if arg.Type != shared.String {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() expects string as algorithm, got %s", fnName, shared.Stringify(arg.Type))}
+	}
+	hasher, ok := hashers[arg.Value.(string)]
+	if !ok {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() unsupported algorithm '%s', expected md5, sha1, sha256 or sha512", fnName, arg.Value.(string))}
+	}
+	return hasher, nil
+}
+
+// encodingArg returns the encoding given as the argument at index of fnName, hex by default
+func encodingArg(fnName string, args []shared.RuntimeValue, index int) (string, *errors.RuntimeError) {
+	if len(args) <= index || args[index].Type == shared.Nil {
+		return "hex", nil
+	}
+	if args[index].Type == shared.String {
+		switch encoding := args[index].Value.(string); encoding {
+		case "hex", "base64":
+			return encoding, nil
+		}
+	}
+	return "", &errors.RuntimeError{Message: fmt.Sprintf("%s() expects \"hex\" or \"base64\" as encoding", fnName)}
+}
+
+// encode returns data in encoding
+func encode(data []byte, encoding string) shared.RuntimeValue {
+	if encoding == "base64" {
+		return values.MK_STRING(base64.StdEncoding.EncodeToString(data))
+	}
+	return values.MK_STRING(hex.EncodeToString(data))
+}
+
+// decode returns the bytes that str holds in encoding
+func decode(str, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(str)
+	}
+	return hex.DecodeString(str)
+}
+
+func module() (*shared.RuntimeValue, *errors.RuntimeError) {
+	mod := values.MK_OBJECT(map[string]*shared.RuntimeValue{
+		"hash":        &hash_,
+		"hashFile":    &hashFile,
+		"hmac":        &hmac_,
+		"randomBytes": &randomBytes,
+		"randomUUID":  &randomUUID,
+		"equal":       &equal,
+		"encrypt":     &encrypt,
+		"decrypt":     &decrypt,
+	})
+
+	return &mod, nil
+}
+
+func init() {
+	modules.RegisterNativeModule("xel:crypto", module)
+}
@@ -0,0 +1,30 @@
+package crypto
+
+import (
+	"crypto/rand"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Returns cryptographically secure random bytes, encoded in hex or base64
+var randomBytes = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, &errors.RuntimeError{Message: "randomBytes() takes 1 or 2 arguments"}
+	}
+	if args[0].Type != shared.Number || args[0].Value.(float64) < 0 || args[0].Value.(float64) > 65536 {
+		return nil, &errors.RuntimeError{Message: "randomBytes() expects a number of bytes between 0 and 65536"}
+	}
+	encoding, err := encodingArg("randomBytes", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, int(args[0].Value.(float64)))
+	rand.Read(data)
+
+	retVal := encode(data, encoding)
+	return &retVal, nil
+})
@@ -0,0 +1,30 @@
+package encoding
+
+import (
+	"fmt"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Decodes a base64 string, with the same options as base64Encode()
+var base64Decode = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	str, err := stringArg("base64Decode", args, true)
+	if err != nil {
+		return nil, err
+	}
+	variant, err := base64Variant("base64Decode", args)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, decodeErr := variant.DecodeString(str)
+	if decodeErr != nil {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("base64Decode() invalid input: %v", decodeErr)}
+	}
+
+	retVal := values.MK_STRING(string(decoded))
+	return &retVal, nil
+})
@@ -0,0 +1,23 @@
+package encoding
+
+import (
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Encodes a string in base64. The `url` option selects the URL-safe alphabet, and `padding: false` omits the trailing `=`
+var base64Encode = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	str, err := stringArg("base64Encode", args, true)
+	if err != nil {
+		return nil, err
+	}
+	variant, err := base64Variant("base64Encode", args)
+	if err != nil {
+		return nil, err
+	}
+
+	retVal := values.MK_STRING(variant.EncodeToString([]byte(str)))
+	return &retVal, nil
+})
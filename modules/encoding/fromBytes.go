@@ -0,0 +1,33 @@
+package encoding
+
+import (
+	"fmt"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Builds a string from an array of byte numbers, the reverse of toBytes()
+var fromBytes = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) != 1 || args[0].Type != shared.Array {
+		return nil, &errors.RuntimeError{Message: "fromBytes() expects an array of numbers"}
+	}
+
+	elements := args[0].Value.([]shared.RuntimeValue)
+	bytes := make([]byte, len(elements))
+	for i, element := range elements {
+		if element.Type != shared.Number {
+			return nil, &errors.RuntimeError{Message: fmt.Sprintf("fromBytes() expects numbers, got %s at index %d", shared.Stringify(element.Type), i)}
+		}
+		n := element.Value.(float64)
+		if n < 0 || n > 255 || n != float64(int(n)) {
+			return nil, &errors.RuntimeError{Message: fmt.Sprintf("fromBytes() expects bytes between 0 and 255, got %v at index %d", n, i)}
+		}
+		bytes[i] = byte(n)
+	}
+
+	retVal := values.MK_STRING(string(bytes))
+	return &retVal, nil
+})
@@ -0,0 +1,27 @@
+package encoding
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Decodes a string of hexadecimal digits
+var hexDecode = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	str, err := stringArg("hexDecode", args, false)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, decodeErr := hex.DecodeString(str)
+	if decodeErr != nil {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("hexDecode() invalid input: %v", decodeErr)}
+	}
+
+	retVal := values.MK_STRING(string(decoded))
+	return &retVal, nil
+})
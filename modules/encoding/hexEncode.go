@@ -0,0 +1,21 @@
+package encoding
+
+import (
+	"encoding/hex"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Encodes each byte of a string as two lowercase hexadecimal digits
+var hexEncode = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	str, err := stringArg("hexEncode", args, false)
+	if err != nil {
+		return nil, err
+	}
+
+	retVal := values.MK_STRING(hex.EncodeToString([]byte(str)))
+	return &retVal, nil
+})
@@ -0,0 +1,81 @@
+package encoding
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/dev-kas/xel/modules"
+
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// stringArg checks that fnName was called with a single string, or with a string and options
+func stringArg(fnName string, args []shared.RuntimeValue, withOptions bool) (string, *errors.RuntimeError) {
+	if len(args) < 1 || len(args) > 2 || (len(args) == 2 && !withOptions) {
+		if withOptions {
+			return "", &errors.RuntimeError{Message: fmt.Sprintf("%s() takes 1 or 2 arguments", fnName)}
+		}
+		return "", &errors.RuntimeError{Message: fmt.Sprintf("%s() takes exactly 1 argument", fnName)}
+	}
+	if args[0].Type != shared.String {
+		return "", &errors.RuntimeError{Message: fmt.Sprintf("%s() expects string as first argument, got %s", fnName, shared.Stringify(args[0].Type))}
+	}
+	return args[0].Value.(string), nil
+}
+
+// base64Variant returns the encoding selected by the `url` and `padding` options given to fnName
+func base64Variant(fnName string, args []shared.RuntimeValue) (*base64.Encoding, *errors.RuntimeError) {
+	url, padding := false, true
+	if len(args) == 2 && args[1].Type != shared.Nil {
+		if args[1].Type != shared.Object {
+			return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() expects object as options, got %s", fnName, shared.Stringify(args[1].Type))}
+		}
+		for key, option := range args[1].Value.(map[string]*shared.RuntimeValue) {
+			if key != "url" && key != "padding" {
+				return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() got unknown option `%s`", fnName, key)}
+			}
+			if option == nil || option.Type != shared.Boolean {
+				return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() expects boolean as `%s`", fnName, key)}
+			}
+			if key == "url" {
+				url = option.Value.(bool)
+			} else {
+				padding = option.Value.(bool)
+			}
+		}
+	}
+
+	switch {
+	case url && padding:
+		return base64.URLEncoding, nil
+	case url:
+		return base64.RawURLEncoding, nil
+	case padding:
+		return base64.StdEncoding, nil
+	default:
+		return base64.RawStdEncoding, nil
+	}
+}
+
+func module() (*shared.RuntimeValue, *errors.RuntimeError) {
+	mod := values.MK_OBJECT(map[string]*shared.RuntimeValue{
+		"base64Encode": &base64Encode,
+		"base64Decode": &base64Decode,
+		"hexEncode":    &hexEncode,
+		"hexDecode":    &hexDecode,
+		"urlEncode":    &urlEncode,
+		"urlDecode":    &urlDecode,
+		"queryEncode":  &queryEncode,
+		"queryDecode":  &queryDecode,
+		"toBytes":      &toBytes,
+		"fromBytes":    &fromBytes,
+	})
+
+	return &mod, nil
+}
+
+func init() {
+	modules.RegisterNativeModule("xel:encoding", module)
+}
@@ -0,0 +1,41 @@
+package encoding
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Decodes a URL query string into an object of strings. Repeated keys give arrays of strings
+var queryDecode = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	str, err := stringArg("queryDecode", args, false)
+	if err != nil {
+		return nil, err
+	}
+
+	query, parseErr := url.ParseQuery(strings.TrimPrefix(str, "?"))
+	if parseErr != nil {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("queryDecode() invalid query: %v", parseErr)}
+	}
+
+	properties := make(map[string]*shared.RuntimeValue, len(query))
+	for key, list := range query {
+		value := values.MK_STRING(list[0])
+		if len(list) > 1 {
+			items := make([]shared.RuntimeValue, len(list))
+			for i, item := range list {
+				items[i] = values.MK_STRING(item)
+			}
+			value = values.MK_ARRAY(items)
+		}
+		properties[key] = &value
+	}
+
+	retVal := values.MK_OBJECT(properties)
+	return &retVal, nil
+})
@@ -0,0 +1,41 @@
+package encoding
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Encodes an object as a URL query string, such as `a=1&b=x+y`. Arrays repeat their key
+var queryEncode = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) != 1 || args[0].Type != shared.Object {
+		return nil, &errors.RuntimeError{Message: "queryEncode() expects an object"}
+	}
+
+	query := url.Values{}
+	for key, value := range args[0].Value.(map[string]*shared.RuntimeValue) {
+		if value == nil || value.Type == shared.Nil {
+			continue
+		}
+		items := []shared.RuntimeValue{*value}
+		if value.Type == shared.Array {
+			items = value.Value.([]shared.RuntimeValue)
+		}
+		for _, item := range items {
+			switch item.Type {
+			case shared.String, shared.Number, shared.Boolean:
+				query.Add(key, fmt.Sprint(item.Value))
+			default:
+				return nil, &errors.RuntimeError{Message: fmt.Sprintf("queryEncode() cannot encode %s as the value of `%s`", shared.Stringify(item.Type), key)}
+			}
+		}
+	}
+
+	// Keys are sorted, so the same object always gives the same string
+	retVal := values.MK_STRING(query.Encode())
+	return &retVal, nil
+})
@@ -0,0 +1,24 @@
+package encoding
+
+import (
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Returns the UTF-8 bytes of a string, as an array of numbers
+var toBytes = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	str, err := stringArg("toBytes", args, false)
+	if err != nil {
+		return nil, err
+	}
+
+	bytes := make([]shared.RuntimeValue, len(str))
+	for i := 0; i < len(str); i++ {
+		bytes[i] = values.MK_NUMBER(float64(str[i]))
+	}
+
+	retVal := values.MK_ARRAY(bytes)
+	return &retVal, nil
+})
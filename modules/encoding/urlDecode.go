@@ -0,0 +1,27 @@
+package encoding
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Decodes a percent-encoded string, turning `+` into spaces
+var urlDecode = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	str, err := stringArg("urlDecode", args, false)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, decodeErr := url.QueryUnescape(str)
+	if decodeErr != nil {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("urlDecode() invalid input: %v", decodeErr)}
+	}
+
+	retVal := values.MK_STRING(decoded)
+	return &retVal, nil
+})
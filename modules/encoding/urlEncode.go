@@ -0,0 +1,21 @@
+package encoding
+
+import (
+	"net/url"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Percent-encodes a string so that it can be placed in a URL query
+var urlEncode = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	str, err := stringArg("urlEncode", args, false)
+	if err != nil {
+		return nil, err
+	}
+
+	retVal := values.MK_STRING(url.QueryEscape(str))
+	return &retVal, nil
+})
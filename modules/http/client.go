@@ -0,0 +1,274 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	errors_ "errors"
+	"fmt"
+	"io"
+	"net"
+	http_ "net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dev-kas/xel/helpers"
+	"github.com/dev-kas/xel/modules/json"
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+const (
+	defaultTimeout   = 30 * time.Second
+	defaultRedirects = 10
+)
+
+// requestOptions describes a request made by a script
+type requestOptions struct {
+	Method    string
+	URL       string
+	Headers   map[string]string
+	Body      *shared.RuntimeValue
+	Timeout   time.Duration
+	Redirects int
+}
+
+// newOptions returns the options of a request to url that sets nothing else
+func newOptions(method, url string) requestOptions {
+	return requestOptions{
+		Method:    method,
+		URL:       url,
+		Headers:   map[string]string{},
+		Timeout:   defaultTimeout,
+		Redirects: defaultRedirects,
+	}
+}
+
+// parseOptions reads the options object passed to fnName into opts.
+// Fields that are missing or nil keep the value they already have.
+func parseOptions(fnName string, value shared.RuntimeValue, opts *requestOptions) *errors.RuntimeError {
+	if value.Type == shared.Nil {
+		return nil
+	}
+	if value.Type != shared.Object {
+		return &errors.RuntimeError{Message: fmt.Sprintf("%s() expects object as options, got %s", fnName, shared.Stringify(value.Type))}
+	}
+
+	for key, field := range value.Value.(map[string]*shared.RuntimeValue) {
+		if field == nil || field.Type == shared.Nil {
+			continue
+		}
+
+		switch key {
+		case "method", "url":
+			if field.Type != shared.String {
+				return &errors.RuntimeError{Message: fmt.Sprintf("%s() expects string as `%s`, got %s", fnName, key, shared.Stringify(field.Type))}
+			}
+			if key == "method" {
+				opts.Method = strings.ToUpper(field.Value.(string))
+			} else {
+				opts.URL = field.Value.(string)
+			}
+
+		case "headers":
+			if field.Type != shared.Object {
+				return &errors.RuntimeError{Message: fmt.Sprintf("%s() expects object as `headers`, got %s", fnName, shared.Stringify(field.Type))}
+			}
+			for name, header := range field.Value.(map[string]*shared.RuntimeValue) {
+				if header == nil || header.Type != shared.String {
+					return &errors.RuntimeError{Message: fmt.Sprintf("%s() expects string as the value of header `%s`", fnName, name)}
+				}
+				opts.Headers[name] = header.Value.(string)
+			}
+
+		case "body":
+			opts.Body = field
+
+		case "timeout", "redirects":
+			if field.Type != shared.Number || field.Value.(float64) < 0 {
+				return &errors.RuntimeError{Message: fmt.Sprintf("%s() expects a non-negative number as `%s`", fnName, key)}
+			}
+			if key == "timeout" {
+				opts.Timeout = time.Duration(field.Value.(float64) * float64(time.Millisecond))
+			} else {
+				opts.Redirects = int(field.Value.(float64))
+			}
+
+		default:
+			return &errors.RuntimeError{Message: fmt.Sprintf("%s() got unknown option `%s`", fnName, key)}
+		}
+	}
+
+	return nil
+}
+
+// checkHost checks that the scripts may connect to the host of u
+func checkHost(u *url.URL) error {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return xShared.XelPermissions.Check(xShared.NetPermission, net.JoinHostPort(u.Hostname(), port))
+}
+
+// doRequest performs the request described by opts, on behalf of fnName, and
+// returns the response object
+func doRequest(fnName string, opts requestOptions) (*shared.RuntimeValue, *errors.RuntimeError) {
+	target, err := url.Parse(opts.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() expects an absolute http or https URL, got '%s'", fnName, opts.URL)}
+	}
+	if err := checkHost(target); err != nil {
+		return nil, helpers.SystemError(err)
+	}
+
+	var body io.Reader
+	contentType := ""
+	if opts.Body != nil {
+		switch opts.Body.Type {
+		case shared.String:
+			body = strings.NewReader(opts.Body.Value.(string))
+		default:
+			// Other values are sent as JSON
+			encoded, err := json.Encode(*opts.Body, "")
+			if err != nil {
+				return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() cannot encode the body: %s", fnName, err.Message)}
+			}
+			if encoded == nil {
+				return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() cannot send %s as the body", fnName, shared.Stringify(opts.Body.Type))}
+			}
+			body = strings.NewReader(*encoded)
+			contentType = "application/json"
+		}
+	}
+
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	req, err := http_.NewRequestWithContext(ctx, opts.Method, target.String(), body)
+	if err != nil {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() %v", fnName, err)}
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for name, value := range opts.Headers {
+		req.Header.Set(name, value)
+	}
+
+	client := &http_.Client{
+		Transport: Transport,
+		CheckRedirect: func(next *http_.Request, via []*http_.Request) error {
+			if len(via) > opts.Redirects {
+				return fmt.Errorf("stopped after %d redirects", opts.Redirects)
+			}
+			return checkHost(next.URL)
+		},
+	}
+	if opts.Redirects == 0 {
+		// The redirect itself is returned to the script
+		client.CheckRedirect = func(*http_.Request, []*http_.Request) error {
+			return http_.ErrUseLastResponse
+		}
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, requestError(fnName, opts, err)
+	}
+	defer res.Body.Close()
+
+	content, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, requestError(fnName, opts, err)
+	}
+
+	return makeResponse(res, content), nil
+}
+
+// requestError returns the runtime error for a request of fnName that failed
+// with err. A host that was not granted raises a `PermissionError`.
+func requestError(fnName string, opts requestOptions, err error) *errors.RuntimeError {
+	message := fmt.Sprintf("%s() %s %s failed: %s", fnName, opts.Method, opts.URL, describeError(err, opts.Timeout))
+	var permErr *xShared.PermissionError
+	if errors_.As(err, &permErr) {
+		return helpers.NewError("PermissionError", "EPERMISSION", message)
+	}
+	return &errors.RuntimeError{Message: message}
+}
+
+// describeError explains why a request failed
+func describeError(err error, timeout time.Duration) string {
+	if errors_.Is(err, context.DeadlineExceeded) {
+		return fmt.Sprintf("timed out after %v", timeout)
+	}
+
+	var urlErr *url.Error
+	if errors_.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var permErr *xShared.PermissionError
+	if errors_.As(err, &permErr) {
+		return permErr.Error()
+	}
+	return err.Error()
+}
+
+// makeResponse converts res, whose body is content, to the object returned to the scripts
+func makeResponse(res *http_.Response, content []byte) *shared.RuntimeValue {
+	status := values.MK_NUMBER(float64(res.StatusCode))
+	statusText := values.MK_STRING(http_.StatusText(res.StatusCode))
+	ok := values.MK_BOOL(res.StatusCode >= 200 && res.StatusCode < 300)
+	finalURL := values.MK_STRING(res.Request.URL.String())
+	body := values.MK_STRING(string(content))
+
+	headers := headerObject(res.Header)
+	json_impl := jsonFn(content)
+
+	retVal := values.MK_OBJECT(map[string]*shared.RuntimeValue{
+		"status":     &status,
+		"statusText": &statusText,
+		"ok":         &ok,
+		"url":        &finalURL,
+		"headers":    &headers,
+		"body":       &body,
+		"json":       &json_impl,
+	})
+	return &retVal
+}
+
+// headerObject converts headers to an object. Names are lowercase, and repeated
+// headers are joined with commas.
+func headerObject(headers http_.Header) shared.RuntimeValue {
+	properties := make(map[string]*shared.RuntimeValue, len(headers))
+	for name, list := range headers {
+		value := values.MK_STRING(strings.Join(list, ", "))
+		properties[strings.ToLower(name)] = &value
+	}
+	return values.MK_OBJECT(properties)
+}
+
+// jsonFn returns the `json()` method of a request or response whose body is content
+func jsonFn(content []byte) shared.RuntimeValue {
+	return values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+		if len(bytes.TrimSpace(content)) == 0 {
+			return nil, &errors.RuntimeError{Message: "json() the body is empty"}
+		}
+		decoded, err := json.Decode(string(content))
+		if err != nil {
+			return nil, &errors.RuntimeError{Message: strings.Replace(err.Message, "parse()", "json()", 1)}
+		}
+		return decoded, nil
+	})
+}
@@ -0,0 +1,247 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	http_ "net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// newTestServer starts a server that answers every request with what it received
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http_.NewServeMux()
+	mux.HandleFunc("/echo", func(w http_.ResponseWriter, r *http_.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Echo", "yes")
+		json.NewEncoder(w).Encode(map[string]string{
+			"method":      r.Method,
+			"body":        string(body),
+			"contentType": r.Header.Get("Content-Type"),
+			"token":       r.Header.Get("X-Token"),
+		})
+	})
+	mux.HandleFunc("/missing", func(w http_.ResponseWriter, r *http_.Request) {
+		http_.Error(w, "nothing here", http_.StatusNotFound)
+	})
+	mux.HandleFunc("/redirect", func(w http_.ResponseWriter, r *http_.Request) {
+		http_.Redirect(w, r, "/echo", http_.StatusFound)
+	})
+	mux.HandleFunc("/slow", func(w http_.ResponseWriter, r *http_.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// call calls a native function of the module with args
+func call(fn shared.RuntimeValue, args ...shared.RuntimeValue) (*shared.RuntimeValue, *errors.RuntimeError) {
+	return fn.Value.(values.NativeFunction)(args, nil)
+}
+
+// object makes an object of fields, which are strings, numbers or objects
+func object(fields map[string]any) shared.RuntimeValue {
+	properties := map[string]*shared.RuntimeValue{}
+	for key, field := range fields {
+		var value shared.RuntimeValue
+		switch field := field.(type) {
+		case string:
+			value = values.MK_STRING(field)
+		case int:
+			value = values.MK_NUMBER(float64(field))
+		case map[string]any:
+			value = object(field)
+		}
+		properties[key] = &value
+	}
+	return values.MK_OBJECT(properties)
+}
+
+// field returns a field of a response object
+func field(t *testing.T, response *shared.RuntimeValue, key string) shared.RuntimeValue {
+	t.Helper()
+	value, ok := response.Value.(map[string]*shared.RuntimeValue)[key]
+	if !ok {
+		t.Fatalf("the response has no `%s`", key)
+	}
+	return *value
+}
+
+// echoed decodes what the echo endpoint received, from the body of response
+func echoed(t *testing.T, response *shared.RuntimeValue) map[string]string {
+	t.Helper()
+	received := map[string]string{}
+	if err := json.Unmarshal([]byte(field(t, response, "body").Value.(string)), &received); err != nil {
+		t.Fatalf("the body is not what the server sent: %v", err)
+	}
+	return received
+}
+
+func TestGet(t *testing.T) {
+	server := newTestServer(t)
+
+	response, err := call(get, values.MK_STRING(server.URL+"/echo"), object(map[string]any{
+		"headers": map[string]any{"X-Token": "secret"},
+	}))
+	if err != nil {
+		t.Fatalf("get() failed: %v", err)
+	}
+	if status := field(t, response, "status").Value.(float64); status != 200 {
+		t.Errorf("status = %v, want 200", status)
+	}
+	if ok := field(t, response, "ok").Value.(bool); !ok {
+		t.Error("ok = false, want true")
+	}
+	headers := field(t, response, "headers").Value.(map[string]*shared.RuntimeValue)
+	if echo := headers["x-echo"]; echo == nil || echo.Value.(string) != "yes" {
+		t.Errorf("headers = %v, want `x-echo` with its lowercase name", headers)
+	}
+	if received := echoed(t, response); received["method"] != "GET" || received["token"] != "secret" {
+		t.Errorf("the server received %v", received)
+	}
+
+	// json() decodes the body
+	decoded, err := call(field(t, response, "json"))
+	if err != nil {
+		t.Fatalf("json() failed: %v", err)
+	}
+	if method := decoded.Value.(map[string]*shared.RuntimeValue)["method"]; method == nil || method.Value.(string) != "GET" {
+		t.Errorf("json() = %v", decoded.Value)
+	}
+}
+
+func TestPost(t *testing.T) {
+	server := newTestServer(t)
+
+	// Objects are sent as JSON
+	response, err := call(post, values.MK_STRING(server.URL+"/echo"), object(map[string]any{"name": "xel"}))
+	if err != nil {
+		t.Fatalf("post() failed: %v", err)
+	}
+	received := echoed(t, response)
+	if received["method"] != "POST" || received["contentType"] != "application/json" || received["body"] != `{"name":"xel"}` {
+		t.Errorf("the server received %v", received)
+	}
+
+	// Strings are sent as they are
+	response, err = call(post, values.MK_STRING(server.URL+"/echo"), values.MK_STRING("plain"))
+	if err != nil {
+		t.Fatalf("post() failed: %v", err)
+	}
+	if received := echoed(t, response); received["body"] != "plain" || received["contentType"] != "" {
+		t.Errorf("the server received %v", received)
+	}
+}
+
+func TestRequest(t *testing.T) {
+	server := newTestServer(t)
+
+	response, err := call(request, object(map[string]any{
+		"method": "put",
+		"url":    server.URL + "/echo",
+		"body":   "data",
+	}))
+	if err != nil {
+		t.Fatalf("request() failed: %v", err)
+	}
+	if received := echoed(t, response); received["method"] != "PUT" || received["body"] != "data" {
+		t.Errorf("the server received %v", received)
+	}
+
+	// Error statuses are responses too
+	response, err = call(request, object(map[string]any{"url": server.URL + "/missing"}))
+	if err != nil {
+		t.Fatalf("request() failed: %v", err)
+	}
+	if status, ok := field(t, response, "status").Value.(float64), field(t, response, "ok").Value.(bool); status != 404 || ok {
+		t.Errorf("status = %v and ok = %v, want 404 and false", status, ok)
+	}
+
+	// Redirects are followed, unless they are not allowed
+	response, err = call(request, object(map[string]any{"url": server.URL + "/redirect"}))
+	if err != nil {
+		t.Fatalf("request() failed: %v", err)
+	}
+	if finalURL := field(t, response, "url").Value.(string); finalURL != server.URL+"/echo" {
+		t.Errorf("url = %s, want the redirect target", finalURL)
+	}
+	response, err = call(request, object(map[string]any{"url": server.URL + "/redirect", "redirects": 0}))
+	if err != nil {
+		t.Fatalf("request() failed: %v", err)
+	}
+	if status := field(t, response, "status").Value.(float64); status != 302 {
+		t.Errorf("status = %v without redirects, want 302", status)
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	server := newTestServer(t)
+	closed := httptest.NewServer(http_.NotFoundHandler())
+	closed.Close()
+
+	cases := []struct {
+		name string
+		fn   shared.RuntimeValue
+		args []shared.RuntimeValue
+		want string
+	}{
+		{"relative URL", get, []shared.RuntimeValue{values.MK_STRING("/echo")}, "expects an absolute http or https URL"},
+		{"unknown option", get, []shared.RuntimeValue{values.MK_STRING(server.URL), object(map[string]any{"retries": 1})}, "unknown option `retries`"},
+		{"missing url", request, []shared.RuntimeValue{object(map[string]any{"method": "GET"})}, "expects a `url`"},
+		{"timeout", get, []shared.RuntimeValue{values.MK_STRING(server.URL + "/slow"), object(map[string]any{"timeout": 20})}, "timed out after 20ms"},
+		{"connection refused", get, []shared.RuntimeValue{values.MK_STRING(closed.URL)}, "failed"},
+		{"missing body", post, []shared.RuntimeValue{values.MK_STRING(server.URL)}, "takes 2 or 3 arguments"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := call(c.fn, c.args...)
+			if err == nil || !strings.Contains(err.Message, c.want) {
+				t.Errorf("got %v, want an error containing %q", err, c.want)
+			}
+		})
+	}
+}
+
+func TestRequestSandbox(t *testing.T) {
+	server := newTestServer(t)
+	target, _ := url.Parse(server.URL)
+
+	xShared.XelPermissions.Sandboxed = true
+	t.Cleanup(func() { xShared.XelPermissions.Sandboxed = false })
+
+	_, err := call(get, values.MK_STRING(server.URL+"/echo"))
+	if err == nil || !strings.HasPrefix(err.Message, "PermissionError: ") || !strings.Contains(err.Message, target.Host) {
+		t.Fatalf("got %v, want a PermissionError for %s", err, target.Host)
+	}
+
+	xShared.XelPermissions.Grant(xShared.NetPermission, target.Host)
+	if _, err := call(get, values.MK_STRING(server.URL+"/echo")); err != nil {
+		t.Fatalf("get() failed once %s was granted: %v", target.Host, err)
+	}
+
+	// Redirects are checked too, here to a port that was not granted
+	denied := httptest.NewServer(http_.NotFoundHandler())
+	defer denied.Close()
+	redirect := httptest.NewServer(http_.RedirectHandler(denied.URL, http_.StatusFound))
+	defer redirect.Close()
+	redirectURL, _ := url.Parse(redirect.URL)
+	xShared.XelPermissions.Grant(xShared.NetPermission, redirectURL.Host)
+	if _, err := call(get, values.MK_STRING(redirect.URL)); err == nil || !strings.HasPrefix(err.Message, "PermissionError: ") {
+		t.Errorf("got %v for a redirect to %s, want a PermissionError", err, denied.URL)
+	}
+}
@@ -0,0 +1,27 @@
+package http
+
+import (
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Sends a GET request to a URL, with the same options as request()
+var get = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, &errors.RuntimeError{Message: "get() takes 1 or 2 arguments"}
+	}
+	if args[0].Type != shared.String {
+		return nil, &errors.RuntimeError{Message: "get() expects string as first argument"}
+	}
+
+	opts := newOptions("GET", args[0].Value.(string))
+	if len(args) == 2 {
+		if err := parseOptions("get", args[1], &opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return doRequest("get", opts)
+})
@@ -0,0 +1,31 @@
+package http
+
+import (
+	http_ "net/http"
+
+	"github.com/dev-kas/xel/modules"
+
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Transport performs the requests of the scripts. It can be replaced, for
+// instance by the transport of an httptest.Server's client, to serve them locally.
+var Transport http_.RoundTripper = http_.DefaultTransport
+
+func module() (*shared.RuntimeValue, *errors.RuntimeError) {
+	mod := values.MK_OBJECT(map[string]*shared.RuntimeValue{
+		"request": &request,
+		"get":     &get,
+		"post":    &post,
+		"serve":   &serve,
+		"router":  &router,
+	})
+
+	return &mod, nil
+}
+
+func init() {
+	modules.RegisterNativeModule("xel:http", module)
+}
@@ -0,0 +1,30 @@
+package http
+
+import (
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Sends a POST request with a body to a URL, with the same options as request()
+var post = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, &errors.RuntimeError{Message: "post() takes 2 or 3 arguments"}
+	}
+	if args[0].Type != shared.String {
+		return nil, &errors.RuntimeError{Message: "post() expects string as first argument"}
+	}
+
+	opts := newOptions("POST", args[0].Value.(string))
+	if len(args) == 3 {
+		if err := parseOptions("post", args[2], &opts); err != nil {
+			return nil, err
+		}
+	}
+	if args[1].Type != shared.Nil {
+		opts.Body = &args[1]
+	}
+
+	return doRequest("post", opts)
+})
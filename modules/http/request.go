@@ -0,0 +1,28 @@
+package http
+
+import (
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Sends a request described by an object with `method`, `url`, `headers`, `body`, `timeout` and `redirects`
+var request = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) != 1 {
+		return nil, &errors.RuntimeError{Message: "request() takes exactly 1 argument"}
+	}
+	if args[0].Type != shared.Object {
+		return nil, &errors.RuntimeError{Message: "request() expects object as argument"}
+	}
+
+	opts := newOptions("GET", "")
+	if err := parseOptions("request", args[0], &opts); err != nil {
+		return nil, err
+	}
+	if opts.URL == "" {
+		return nil, &errors.RuntimeError{Message: "request() expects a `url`"}
+	}
+
+	return doRequest("request", opts)
+})
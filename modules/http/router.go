@@ -0,0 +1,73 @@
+package http
+
+import (
+	"fmt"
+	http_ "net/http"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Creates a router, which collects the routes that serve() dispatches requests to
+var router = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) != 0 {
+		return nil, &errors.RuntimeError{Message: "router() takes no arguments"}
+	}
+
+	routes := values.MK_ARRAY([]shared.RuntimeValue{})
+	// Routes are also registered here, so that invalid or conflicting patterns are reported right away
+	mux := http_.NewServeMux()
+
+	// handle returns the method that adds a route for method, or for every method when it is empty
+	handle := func(name, method string) shared.RuntimeValue {
+		return values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+			if len(args) != 2 {
+				return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() takes exactly 2 arguments", name)}
+			}
+			if args[0].Type != shared.String {
+				return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() expects string as first argument", name)}
+			}
+			if args[1].Type != shared.Function {
+				return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() expects function as second argument", name)}
+			}
+
+			pattern := values.MK_STRING(args[0].Value.(string))
+			if method != "" {
+				pattern = values.MK_STRING(method + " " + args[0].Value.(string))
+			}
+			if err := addRoute(mux, pattern.Value.(string), http_.NotFoundHandler()); err != nil {
+				return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() %v", name, err)}
+			}
+
+			handler := args[1]
+			route := values.MK_OBJECT(map[string]*shared.RuntimeValue{
+				"pattern": &pattern,
+				"handler": &handler,
+			})
+			routes.Value = append(routes.Value.([]shared.RuntimeValue), route)
+
+			nilVal := values.MK_NIL()
+			return &nilVal, nil
+		})
+	}
+
+	handleVal := handle("handle", "")
+	getVal := handle("get", http_.MethodGet)
+	postVal := handle("post", http_.MethodPost)
+	putVal := handle("put", http_.MethodPut)
+	patchVal := handle("patch", http_.MethodPatch)
+	deleteVal := handle("delete", http_.MethodDelete)
+
+	retVal := values.MK_OBJECT(map[string]*shared.RuntimeValue{
+		"routes": &routes,
+		"handle": &handleVal,
+		"get":    &getVal,
+		"post":   &postVal,
+		"put":    &putVal,
+		"patch":  &patchVal,
+		"delete": &deleteVal,
+	})
+	return &retVal, nil
+})
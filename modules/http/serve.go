@@ -0,0 +1,307 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	http_ "net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dev-kas/xel/helpers"
+	"github.com/dev-kas/xel/modules/json"
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// At most this many requests are handled at once by a server, the others wait for their turn
+var maxRunningHandlers = max(256, runtime.NumCPU()*32)
+
+// How long in-flight requests may take to finish once the server is asked to stop
+const shutdownTimeout = 10 * time.Second
+
+// Matches the `{name}` and `{name...}` wildcards of a route pattern
+var wildcardPattern = regexp.MustCompile(`\{([^{}.]+)(\.\.\.)?\}`)
+
+// Matches where ServeMux says a conflicting pattern was registered, which is meaningless to the scripts
+var registeredAtPattern = regexp.MustCompile(` \(registered at [^)]*\)`)
+
+// Serves HTTP requests with a handler function, or with the routes of a router, until the process
+// receives SIGINT or SIGTERM, or the evaluation is interrupted
+var serve = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	// Interrupting the evaluation waits for the server to be shut down, so that its port is free again
+	interrupted, done := xShared.Interruptible()
+	defer done()
+
+	if len(args) != 2 {
+		return nil, &errors.RuntimeError{Message: "serve() takes exactly 2 arguments"}
+	}
+	if args[0].Type != shared.Object {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("serve() expects object as first argument, got %s", shared.Stringify(args[0].Type))}
+	}
+
+	host, port := "127.0.0.1", -1
+	for key, field := range args[0].Value.(map[string]*shared.RuntimeValue) {
+		switch {
+		case field == nil || field.Type == shared.Nil:
+		case key == "host" && field.Type == shared.String:
+			host = field.Value.(string)
+		case key == "port" && field.Type == shared.Number:
+			port = int(field.Value.(float64))
+		case key == "host" || key == "port":
+			return nil, &errors.RuntimeError{Message: fmt.Sprintf("serve() got %s as `%s`", shared.Stringify(field.Type), key)}
+		default:
+			return nil, &errors.RuntimeError{Message: fmt.Sprintf("serve() got unknown option `%s`", key)}
+		}
+	}
+	if port < 0 || port > 65535 {
+		return nil, &errors.RuntimeError{Message: "serve() expects a `port` between 0 and 65535"}
+	}
+
+	limiter := make(chan struct{}, maxRunningHandlers)
+	mux := http_.NewServeMux()
+	switch args[1].Type {
+	case shared.Function:
+		mux.Handle("/", &routeHandler{fn: args[1], env: env, limiter: limiter})
+
+	case shared.Object:
+		routes, ok := args[1].Value.(map[string]*shared.RuntimeValue)["routes"]
+		if !ok || routes.Type != shared.Array {
+			return nil, &errors.RuntimeError{Message: "serve() expects an object with a `routes` array, such as the one returned by router()"}
+		}
+		for _, route := range routes.Value.([]shared.RuntimeValue) {
+			pattern, fn, err := parseRoute(route)
+			if err == nil {
+				err = addRoute(mux, pattern, &routeHandler{fn: fn, env: env, params: wildcardNames(pattern), limiter: limiter})
+			}
+			if err != nil {
+				return nil, &errors.RuntimeError{Message: fmt.Sprintf("serve() %v", err)}
+			}
+		}
+
+	default:
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("serve() expects function or object of routes as second argument, got %s", shared.Stringify(args[1].Type))}
+	}
+
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	if err := xShared.XelPermissions.Check(xShared.NetPermission, address); err != nil {
+		return nil, helpers.SystemError(err)
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("serve() cannot listen on %s: %v", address, err)}
+	}
+
+	server := &http_.Server{Handler: mux}
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-served:
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("serve() stopped: %v", err)}
+
+	case <-signals:
+	case <-interrupted:
+	}
+
+	// Stop accepting connections, and let the requests being handled finish
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
+	}
+
+	nilVal := values.MK_NIL()
+	return &nilVal, nil
+})
+
+// parseRoute reads the pattern and handler of a route
+func parseRoute(route shared.RuntimeValue) (string, shared.RuntimeValue, error) {
+	if route.Type != shared.Object {
+		return "", route, fmt.Errorf("expects object as route, got %s", shared.Stringify(route.Type))
+	}
+	fields := route.Value.(map[string]*shared.RuntimeValue)
+	pattern, fn := fields["pattern"], fields["handler"]
+	if pattern == nil || pattern.Type != shared.String {
+		return "", route, fmt.Errorf("expects string as the `pattern` of a route")
+	}
+	if fn == nil || fn.Type != shared.Function {
+		return "", route, fmt.Errorf("expects function as the handler of route '%s'", pattern.Value.(string))
+	}
+	return pattern.Value.(string), *fn, nil
+}
+
+// addRoute registers handler for pattern, reporting the patterns that ServeMux rejects
+func addRoute(mux *http_.ServeMux, pattern string, handler http_.Handler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			message := registeredAtPattern.ReplaceAllString(fmt.Sprint(r), "")
+			err = fmt.Errorf("invalid route '%s': %s", pattern, strings.ReplaceAll(message, ":\n", ": "))
+		}
+	}()
+	mux.Handle(pattern, handler)
+	return nil
+}
+
+// wildcardNames returns the names of the wildcards in pattern
+func wildcardNames(pattern string) []string {
+	names := []string{}
+	for _, match := range wildcardPattern.FindAllStringSubmatch(pattern, -1) {
+		if match[1] != "$" {
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// routeHandler calls a Xel function for each request of a route, concurrently
+// with the other requests of its server, like `threads.spawn` calls functions
+type routeHandler struct {
+	fn      shared.RuntimeValue
+	env     *environment.Environment
+	params  []string
+	limiter chan struct{} // Shared by the routes of a server
+}
+
+func (h *routeHandler) ServeHTTP(w http_.ResponseWriter, r *http_.Request) {
+	h.limiter <- struct{}{}
+	defer func() { <-h.limiter }()
+
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		http_.Error(w, "cannot read the request body", http_.StatusBadRequest)
+		return
+	}
+
+	result, evalErr := helpers.EvalFnVal(&h.fn, []shared.RuntimeValue{h.makeRequest(r, content)}, h.env)
+	if evalErr == nil {
+		evalErr = writeResponse(w, result)
+	}
+	if evalErr != nil {
+		xShared.ColorPalette.Error.Fprintf(os.Stderr, "serve() %s %s failed: %s\n", r.Method, r.URL.Path, evalErr.Message)
+		http_.Error(w, http_.StatusText(http_.StatusInternalServerError), http_.StatusInternalServerError)
+	}
+}
+
+// makeRequest converts r, whose body is content, to the object passed to the handler
+func (h *routeHandler) makeRequest(r *http_.Request, content []byte) shared.RuntimeValue {
+	method := values.MK_STRING(r.Method)
+	path := values.MK_STRING(r.URL.Path)
+	body := values.MK_STRING(string(content))
+	headers := headerObject(r.Header)
+	json_impl := jsonFn(content)
+
+	// Only the first value of a repeated query parameter is kept
+	queryValues := map[string]*shared.RuntimeValue{}
+	for name, list := range r.URL.Query() {
+		value := values.MK_STRING(list[0])
+		queryValues[name] = &value
+	}
+	query := values.MK_OBJECT(queryValues)
+
+	paramValues := map[string]*shared.RuntimeValue{}
+	for _, name := range h.params {
+		value := values.MK_STRING(r.PathValue(name))
+		paramValues[name] = &value
+	}
+	params := values.MK_OBJECT(paramValues)
+
+	return values.MK_OBJECT(map[string]*shared.RuntimeValue{
+		"method":  &method,
+		"path":    &path,
+		"query":   &query,
+		"params":  &params,
+		"headers": &headers,
+		"body":    &body,
+		"json":    &json_impl,
+	})
+}
+
+// writeResponse sends the value returned by a handler. It is either nil, a string
+// to send as the body, or an object with `status`, `headers` and `body`.
+func writeResponse(w http_.ResponseWriter, result *shared.RuntimeValue) *errors.RuntimeError {
+	if result == nil || result.Type == shared.Nil {
+		w.WriteHeader(http_.StatusNoContent)
+		return nil
+	}
+
+	if result.Type == shared.String {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, result.Value.(string))
+		return nil
+	}
+
+	if result.Type != shared.Object {
+		return &errors.RuntimeError{Message: fmt.Sprintf("the handler must return nil, a string or an object, got %s", shared.Stringify(result.Type))}
+	}
+
+	status := http_.StatusOK
+	var body *shared.RuntimeValue
+	headers := http_.Header{}
+	for key, field := range result.Value.(map[string]*shared.RuntimeValue) {
+		switch {
+		case field == nil || field.Type == shared.Nil:
+		case key == "status" && field.Type == shared.Number:
+			status = int(field.Value.(float64))
+			if status < 100 || status > 999 {
+				return &errors.RuntimeError{Message: fmt.Sprintf("the handler returned an invalid status %d", status)}
+			}
+		case key == "headers" && field.Type == shared.Object:
+			for name, value := range field.Value.(map[string]*shared.RuntimeValue) {
+				if value == nil || value.Type != shared.String {
+					return &errors.RuntimeError{Message: fmt.Sprintf("the handler must return strings as headers, got `%s`", name)}
+				}
+				headers.Set(name, value.Value.(string))
+			}
+		case key == "body":
+			body = field
+		default:
+			return &errors.RuntimeError{Message: fmt.Sprintf("the handler returned %s as `%s`", shared.Stringify(field.Type), key)}
+		}
+	}
+
+	content := ""
+	if body != nil {
+		if body.Type == shared.String {
+			content = body.Value.(string)
+		} else {
+			// Other values are sent as JSON
+			encoded, err := json.Encode(*body, "")
+			if err != nil {
+				return err
+			}
+			if encoded == nil {
+				return &errors.RuntimeError{Message: fmt.Sprintf("the handler cannot send %s as the body", shared.Stringify(body.Type))}
+			}
+			content = *encoded
+			if headers.Get("Content-Type") == "" {
+				headers.Set("Content-Type", "application/json")
+			}
+		}
+	}
+
+	for name, list := range headers {
+		w.Header()[name] = list
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, content)
+	return nil
+}
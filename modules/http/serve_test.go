@@ -0,0 +1,79 @@
+package http
+
+import (
+	"io"
+	http_ "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/evaluator"
+	"github.com/dev-kas/virtlang-go/v4/parser"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// A handler that waits on `wait()` for /slow, and answers with the path otherwise
+const slowHandlerSrc = `fn handle(req) {
+  if (req.path == "/slow") {
+    wait()
+  }
+  return req.path
+}
+`
+
+func TestServeConcurrently(t *testing.T) {
+	waiting, release := make(chan struct{}), make(chan struct{})
+	env := environment.NewEnvironment(nil)
+	env.DeclareVar("wait", values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+		close(waiting)
+		<-release
+		nilVal := values.MK_NIL()
+		return &nilVal, nil
+	}), true)
+
+	program, err := parser.New("main.xel").ProduceAST(slowHandlerSrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := evaluator.Evaluate(program, env, nil); err != nil {
+		t.Fatal(err)
+	}
+	handle, _ := env.LookupVar("handle")
+
+	server := httptest.NewServer(&routeHandler{fn: *handle, env: env, limiter: make(chan struct{}, maxRunningHandlers)})
+	t.Cleanup(server.Close)
+
+	fetch := func(path string) string {
+		response, err := http_.Get(server.URL + path)
+		if err != nil {
+			return err.Error()
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		return string(body)
+	}
+
+	slow := make(chan string, 1)
+	go func() { slow <- fetch("/slow") }()
+	<-waiting
+
+	// The slow handler is still running when the next request is answered
+	fast := make(chan string, 1)
+	go func() { fast <- fetch("/fast") }()
+	select {
+	case body := <-fast:
+		if body != "/fast" {
+			t.Errorf("/fast answered %q", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("/fast waited for the slow handler")
+	}
+
+	close(release)
+	if body := <-slow; body != "/slow" {
+		t.Errorf("/slow answered %q", body)
+	}
+}
@@ -0,0 +1,89 @@
+package json
+
+import (
+	json_ "encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dev-kas/xel/helpers"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+var parse = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) != 1 {
+		return nil, &errors.RuntimeError{Message: "parse() takes exactly 1 argument"}
+	}
+	if args[0].Type != shared.String {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("parse() expects string as argument, got %s", shared.Stringify(args[0].Type))}
+	}
+
+	return Decode(args[0].Value.(string))
+})
+
+// Decode parses a JSON document into its VirtLang representation.
+// Syntax errors report the line and column of the offending token.
+func Decode(src string) (*shared.RuntimeValue, *errors.RuntimeError) {
+	var raw interface{}
+	if err := json_.Unmarshal([]byte(src), &raw); err != nil {
+		return nil, &errors.RuntimeError{Message: describeDecodeError([]byte(src), err)}
+	}
+
+	result := fromGo(raw)
+	return &result, nil
+}
+
+func describeDecodeError(input []byte, err error) string {
+	var offset int64
+	switch e := err.(type) {
+	case *json_.SyntaxError:
+		offset = e.Offset
+	case *json_.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		return fmt.Sprintf("parse() invalid JSON: %s", err.Error())
+	}
+
+	// Offset is the number of bytes read when the error was detected,
+	// so the offending byte sits just before it
+	pos := int(offset) - 1
+	if pos < 0 || int(offset) >= len(input) {
+		pos = int(offset)
+	}
+	line, col := helpers.PosToLineCol(input, pos)
+
+	message := strings.TrimPrefix(err.Error(), "json: ")
+	return fmt.Sprintf("parse() invalid JSON at line %d, column %d: %s", line, col, message)
+}
+
+// fromGo converts a value produced by encoding/json into a RuntimeValue
+func fromGo(raw interface{}) shared.RuntimeValue {
+	switch v := raw.(type) {
+	case nil:
+		return values.MK_NIL()
+	case bool:
+		return values.MK_BOOL(v)
+	case float64:
+		return values.MK_NUMBER(v)
+	case string:
+		return values.MK_STRING(v)
+	case []interface{}:
+		elements := make([]shared.RuntimeValue, len(v))
+		for i, elem := range v {
+			elements[i] = fromGo(elem)
+		}
+		return values.MK_ARRAY(elements)
+	case map[string]interface{}:
+		properties := make(map[string]*shared.RuntimeValue, len(v))
+		for key, elem := range v {
+			converted := fromGo(elem)
+			properties[key] = &converted
+		}
+		return values.MK_OBJECT(properties)
+	default:
+		return values.MK_NIL()
+	}
+}
@@ -0,0 +1,187 @@
+package json
+
+import (
+	"bytes"
+	json_ "encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+const maxIndentWidth = 10
+
+var stringify = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, &errors.RuntimeError{Message: "stringify() takes 1 or 2 arguments"}
+	}
+
+	indent := ""
+	if len(args) == 2 {
+		switch args[1].Type {
+		case shared.Nil:
+		case shared.Number:
+			width := int(args[1].Value.(float64))
+			width = max(0, min(width, maxIndentWidth))
+			indent = strings.Repeat(" ", width)
+		case shared.String:
+			indent = args[1].Value.(string)
+			if len(indent) > maxIndentWidth {
+				indent = indent[:maxIndentWidth]
+			}
+		default:
+			return nil, &errors.RuntimeError{Message: fmt.Sprintf("stringify() expects number or string as indent, got %s", shared.Stringify(args[1].Type))}
+		}
+	}
+
+	out, err := Encode(args[0], indent)
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		nilVal := values.MK_NIL()
+		return &nilVal, nil
+	}
+
+	retVal := values.MK_STRING(*out)
+	return &retVal, nil
+})
+
+// Encode serializes a RuntimeValue to JSON, indenting nested values with indent
+// when it is non-empty. Functions and classes have no JSON representation: they
+// are omitted from objects, become null inside arrays and yield nil at the top level.
+// Cyclic structures are reported as errors naming the path where the cycle closes.
+func Encode(value shared.RuntimeValue, indent string) (*string, *errors.RuntimeError) {
+	tree, ok, err := toGo(value, map[uintptr]string{}, "$")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := json_.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+	if err := encoder.Encode(tree); err != nil {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("stringify() %s", err.Error())}
+	}
+
+	out := strings.TrimSuffix(buf.String(), "\n")
+	return &out, nil
+}
+
+// toGo converts a RuntimeValue into plain Go values understood by encoding/json.
+// The visited map tracks the containers on the current path, the same way
+// helpers.Stringify detects circular references.
+func toGo(value shared.RuntimeValue, visited map[uintptr]string, path string) (interface{}, bool, *errors.RuntimeError) {
+	switch value.Type {
+	case shared.Nil:
+		return nil, true, nil
+	case shared.Boolean:
+		return value.Value.(bool), true, nil
+	case shared.Number:
+		num := value.Value.(float64)
+		if math.IsNaN(num) || math.IsInf(num, 0) {
+			return nil, true, nil
+		}
+		return num, true, nil
+	case shared.String:
+		return value.Value.(string), true, nil
+	case shared.Array:
+		arr := value.Value.([]shared.RuntimeValue)
+		leave, err := enter(arr, visited, path)
+		if err != nil {
+			return nil, false, err
+		}
+		defer leave()
+
+		out := make([]interface{}, len(arr))
+		for i, elem := range arr {
+			converted, ok, err := toGo(elem, visited, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				out[i] = converted
+			}
+		}
+		return out, true, nil
+	case shared.Object:
+		obj := value.Value.(map[string]*shared.RuntimeValue)
+		leave, err := enter(obj, visited, path)
+		if err != nil {
+			return nil, false, err
+		}
+		defer leave()
+
+		out := make(map[string]interface{}, len(obj))
+		for key, elem := range obj {
+			if elem == nil {
+				out[key] = nil
+				continue
+			}
+			converted, ok, err := toGo(*elem, visited, path+"."+key)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				out[key] = converted
+			}
+		}
+		return out, true, nil
+	case shared.ClassInstance:
+		instance := value.Value.(values.ClassInstanceValue)
+		leave, err := enter(instance.Data.Variables, visited, path)
+		if err != nil {
+			return nil, false, err
+		}
+		defer leave()
+
+		out := map[string]interface{}{}
+		for key, isPublic := range instance.Publics {
+			if !isPublic {
+				continue
+			}
+			elem, exists := instance.Data.Variables[key]
+			if !exists || elem == nil {
+				continue
+			}
+			converted, ok, err := toGo(*elem, visited, path+"."+key)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				out[key] = converted
+			}
+		}
+		return out, true, nil
+	default:
+		// Functions, native functions and classes are skipped
+		return nil, false, nil
+	}
+}
+
+// enter marks a container as being serialized and returns a function that unmarks it
+func enter(container interface{}, visited map[uintptr]string, path string) (func(), *errors.RuntimeError) {
+	val := reflect.ValueOf(container)
+	if val.IsNil() || val.Len() == 0 {
+		return func() {}, nil
+	}
+
+	ptr := val.Pointer()
+	if firstSeen, exists := visited[ptr]; exists {
+		return nil, &errors.RuntimeError{
+			Message: fmt.Sprintf("stringify() cannot serialize circular structure: %s refers back to %s", path, firstSeen),
+		}
+	}
+
+	visited[ptr] = path
+	return func() { delete(visited, ptr) }, nil
+}
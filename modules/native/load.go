@@ -8,6 +8,7 @@ import (
 	"github.com/dev-kas/virtlang-go/v4/errors"
 	"github.com/dev-kas/virtlang-go/v4/shared"
 	"github.com/dev-kas/virtlang-go/v4/values"
+	"github.com/dev-kas/xel/helpers"
 	xShared "github.com/dev-kas/xel/shared"
 )
 
@@ -29,6 +30,10 @@ var load = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment
 	dirname := filepath.Dir(xShared.XelRootDebugger.CurrentFile)
 	libpath := filepath.Join(dirname, path)
 
+	if err := xShared.XelPermissions.Check(xShared.FFIPermission, libpath); err != nil {
+		return nil, helpers.SystemError(err)
+	}
+
 	lib, err := loadLibrary(libpath)
 	if err != nil {
 		return nil, &errors.RuntimeError{
@@ -3,6 +3,8 @@ package os
 import (
 	"os"
 
+	"github.com/dev-kas/xel/helpers"
+
 	"github.com/dev-kas/virtlang-go/v4/environment"
 	"github.com/dev-kas/virtlang-go/v4/errors"
 	"github.com/dev-kas/virtlang-go/v4/shared"
@@ -12,7 +14,7 @@ import (
 var cwd = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
 	cwd, err := os.Getwd()
 	if err != nil {
-		return nil, &errors.RuntimeError{Message: err.Error()}
+		return nil, helpers.SystemError(err)
 	}
 	retVal := values.MK_STRING(cwd)
 	return &retVal, nil
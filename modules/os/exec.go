@@ -4,6 +4,9 @@ import (
 	"bytes"
 	exec_ "os/exec"
 
+	"github.com/dev-kas/xel/helpers"
+	xShared "github.com/dev-kas/xel/shared"
+
 	"github.com/dev-kas/virtlang-go/v4/environment"
 	"github.com/dev-kas/virtlang-go/v4/errors"
 	"github.com/dev-kas/virtlang-go/v4/shared"
@@ -31,13 +34,20 @@ var exec = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment
 		rawArgs[i] = arg.Value.(string)
 	}
 
+	if err := xShared.XelPermissions.Check(xShared.ExecPermission, program); err != nil {
+		return nil, helpers.SystemError(err)
+	}
+
 	cmd := exec_.Command(program, rawArgs...)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	cmd.Run()
+	// Programs that ran report their exit code instead of failing
+	if err := cmd.Run(); err != nil && cmd.ProcessState == nil {
+		return nil, helpers.SystemError(err)
+	}
 
 	stdoutVal := values.MK_STRING(stdout.String())
 	stderrVal := values.MK_STRING(stderr.String())
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/dev-kas/xel/helpers"
 	xShared "github.com/dev-kas/xel/shared"
 
 	"github.com/dev-kas/virtlang-go/v4/environment"
@@ -20,9 +21,9 @@ var exists = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environme
 		return nil, &errors.RuntimeError{Message: "exists() expects string as first argument"}
 	}
 
-	path, err := resolvePath(filepath.Dir(xShared.XelRootDebugger.CurrentFile), args[0].Value.(string))
+	path, err := resolvePath(filepath.Dir(xShared.XelRootDebugger.CurrentFile), args[0].Value.(string), xShared.ReadPermission)
 	if err != nil {
-		return nil, &errors.RuntimeError{Message: err.Error()}
+		return nil, helpers.SystemError(err)
 	}
 
 	_, err = os.Stat(path)
@@ -31,7 +32,7 @@ var exists = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environme
 			retVal := values.MK_BOOL(false)
 			return &retVal, nil
 		}
-		return nil, &errors.RuntimeError{Message: err.Error()}
+		return nil, helpers.SystemError(err)
 	}
 
 	retVal := values.MK_BOOL(true)
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/dev-kas/xel/helpers"
 	xShared "github.com/dev-kas/xel/shared"
 
 	"github.com/dev-kas/virtlang-go/v4/environment"
@@ -20,14 +21,14 @@ var list = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment
 		return nil, &errors.RuntimeError{Message: "list() expects string as first argument"}
 	}
 
-	path, err := resolvePath(filepath.Dir(xShared.XelRootDebugger.CurrentFile), args[0].Value.(string))
+	path, err := resolvePath(filepath.Dir(xShared.XelRootDebugger.CurrentFile), args[0].Value.(string), xShared.ReadPermission)
 	if err != nil {
-		return nil, &errors.RuntimeError{Message: err.Error()}
+		return nil, helpers.SystemError(err)
 	}
 
 	files, err := os.ReadDir(path)
 	if err != nil {
-		return nil, &errors.RuntimeError{Message: err.Error()}
+		return nil, helpers.SystemError(err)
 	}
 
 	arr := []shared.RuntimeValue{}
@@ -4,17 +4,28 @@ import (
 	"path/filepath"
 
 	"github.com/dev-kas/xel/modules"
+	xShared "github.com/dev-kas/xel/shared"
 
 	"github.com/dev-kas/virtlang-go/v4/errors"
 	"github.com/dev-kas/virtlang-go/v4/shared"
 	"github.com/dev-kas/virtlang-go/v4/values"
 )
 
-func resolvePath(baseDir, inputPath string) (string, error) {
+// resolvePath resolves inputPath against baseDir, and checks that
+// the scripts hold each of perms for the resulting path
+func resolvePath(baseDir, inputPath string, perms ...xShared.Permission) (string, error) {
+	path := filepath.Clean(filepath.Join(baseDir, inputPath))
 	if filepath.IsAbs(inputPath) {
-		return filepath.Clean(inputPath), nil
+		path = filepath.Clean(inputPath)
 	}
-	return filepath.Clean(filepath.Join(baseDir, inputPath)), nil
+
+	for _, perm := range perms {
+		if err := xShared.XelPermissions.Check(perm, path); err != nil {
+			return "", err
+		}
+	}
+
+	return path, nil
 }
 
 func module() (*shared.RuntimeValue, *errors.RuntimeError) {
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/dev-kas/xel/helpers"
 	xShared "github.com/dev-kas/xel/shared"
 
 	"github.com/dev-kas/virtlang-go/v4/environment"
@@ -20,9 +21,9 @@ var mkdir = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environmen
 		return nil, &errors.RuntimeError{Message: "mkdir() expects string as first argument"}
 	}
 
-	path, err := resolvePath(filepath.Dir(xShared.XelRootDebugger.CurrentFile), args[0].Value.(string))
+	path, err := resolvePath(filepath.Dir(xShared.XelRootDebugger.CurrentFile), args[0].Value.(string), xShared.WritePermission)
 	if err != nil {
-		return nil, &errors.RuntimeError{Message: err.Error()}
+		return nil, helpers.SystemError(err)
 	}
 
 	nilVal := values.MK_NIL()
@@ -32,7 +33,7 @@ var mkdir = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environmen
 		if os.IsExist(err) {
 			return &nilVal, nil
 		}
-		return nil, &errors.RuntimeError{Message: err.Error()}
+		return nil, helpers.SystemError(err)
 	}
 
 	return &nilVal, nil
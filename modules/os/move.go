@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/dev-kas/xel/helpers"
 	xShared "github.com/dev-kas/xel/shared"
 
 	"github.com/dev-kas/virtlang-go/v4/environment"
@@ -34,23 +35,26 @@ var move = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment
 		return nil, &errors.RuntimeError{Message: "move() expects string as first argument"}
 	}
 
-	fromPath, err := resolvePath(filepath.Dir(xShared.XelRootDebugger.CurrentFile), args[0].Value.(string))
+	fromPath, err := resolvePath(filepath.Dir(xShared.XelRootDebugger.CurrentFile), args[0].Value.(string), xShared.WritePermission)
 	if err != nil {
-		return nil, &errors.RuntimeError{Message: err.Error()}
+		return nil, helpers.SystemError(err)
 	}
 
-	toPath, err := resolvePath(filepath.Dir(xShared.XelRootDebugger.CurrentFile), args[1].Value.(string))
+	toPath, err := resolvePath(filepath.Dir(xShared.XelRootDebugger.CurrentFile), args[1].Value.(string), xShared.WritePermission)
 	if err != nil {
-		return nil, &errors.RuntimeError{Message: err.Error()}
+		return nil, helpers.SystemError(err)
 	}
 
 	fromStats, err := os.Stat(fromPath)
+	if os.IsNotExist(err) {
+		return nil, helpers.NewError("SystemError", "ENOENT", "Source does not exist")
+	}
 	if err != nil {
-		return nil, &errors.RuntimeError{Message: "Source does not exist"}
+		return nil, helpers.SystemError(err)
 	}
 
 	if _, err := os.Stat(toPath); err == nil {
-		return nil, &errors.RuntimeError{Message: "Destination already exists"}
+		return nil, helpers.NewError("SystemError", "EEXIST", "Destination already exists")
 	}
 
 	if fromStats.IsDir() {
@@ -60,7 +64,7 @@ var move = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment
 	}
 
 	if err != nil {
-		return nil, &errors.RuntimeError{Message: err.Error()}
+		return nil, helpers.SystemError(err)
 	}
 
 	nilVal := values.MK_NIL()
@@ -4,6 +4,8 @@ import (
 	"os"
 	user_ "os/user"
 
+	"github.com/dev-kas/xel/helpers"
+
 	"github.com/dev-kas/virtlang-go/v4/environment"
 	"github.com/dev-kas/virtlang-go/v4/errors"
 	"github.com/dev-kas/virtlang-go/v4/shared"
@@ -17,7 +19,7 @@ var user = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment
 
 	u, err := user_.Current()
 	if err != nil {
-		return nil, &errors.RuntimeError{Message: err.Error()}
+		return nil, helpers.SystemError(err)
 	}
 
 	nameVal := values.MK_STRING(u.Name)
@@ -22,14 +22,14 @@ var write = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environmen
 		return nil, &errors.RuntimeError{Message: "write() expects string as first argument"}
 	}
 
-	path, err := resolvePath(filepath.Dir(xShared.XelRootDebugger.CurrentFile), args[0].Value.(string))
+	path, err := resolvePath(filepath.Dir(xShared.XelRootDebugger.CurrentFile), args[0].Value.(string), xShared.WritePermission)
 	if err != nil {
-		return nil, &errors.RuntimeError{Message: err.Error()}
+		return nil, helpers.SystemError(err)
 	}
 
 	err = os.WriteFile(path, []byte(helpers.Stringify(args[1], false)), 0644)
 	if err != nil {
-		return nil, &errors.RuntimeError{Message: err.Error()}
+		return nil, helpers.SystemError(err)
 	}
 
 	nilVal := values.MK_NIL()
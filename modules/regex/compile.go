@@ -0,0 +1,187 @@
+package regex
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dev-kas/xel/helpers"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Compiles a pattern, with optional flags, into an object with test, match, matchAll, replace and split
+var compile = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, &errors.RuntimeError{Message: "compile() takes 1 or 2 arguments"}
+	}
+	if args[0].Type != shared.String {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("compile() expects string as pattern, got %s", shared.Stringify(args[0].Type))}
+	}
+	flags := ""
+	if len(args) == 2 && args[1].Type != shared.Nil {
+		if args[1].Type != shared.String {
+			return nil, &errors.RuntimeError{Message: fmt.Sprintf("compile() expects string as flags, got %s", shared.Stringify(args[1].Type))}
+		}
+		flags = args[1].Value.(string)
+	}
+
+	re, err := compilePattern(args[0].Value.(string), flags)
+	if err != nil {
+		return nil, &errors.RuntimeError{Message: fmt.Sprintf("compile() invalid pattern: %v", err)}
+	}
+
+	// stringArg returns the string argument of method, which takes between min and max arguments
+	stringArg := func(method string, args []shared.RuntimeValue, min, max int) (string, *errors.RuntimeError) {
+		if len(args) < min || len(args) > max {
+			if min == max {
+				return "", &errors.RuntimeError{Message: fmt.Sprintf("%s() takes exactly %d argument(s)", method, min)}
+			}
+			return "", &errors.RuntimeError{Message: fmt.Sprintf("%s() takes %d to %d arguments", method, min, max)}
+		}
+		if args[0].Type != shared.String {
+			return "", &errors.RuntimeError{Message: fmt.Sprintf("%s() expects string as first argument, got %s", method, shared.Stringify(args[0].Type))}
+		}
+		return args[0].Value.(string), nil
+	}
+
+	test := values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+		str, err := stringArg("test", args, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		retVal := values.MK_BOOL(re.MatchString(str))
+		return &retVal, nil
+	})
+
+	match := values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+		str, err := stringArg("match", args, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		loc := re.FindStringSubmatchIndex(str)
+		if loc == nil {
+			nilVal := values.MK_NIL()
+			return &nilVal, nil
+		}
+		retVal := makeMatch(re, str, loc)
+		return &retVal, nil
+	})
+
+	matchAll := values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+		str, err := stringArg("matchAll", args, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		matches := []shared.RuntimeValue{}
+		for _, loc := range re.FindAllStringSubmatchIndex(str, -1) {
+			matches = append(matches, makeMatch(re, str, loc))
+		}
+		retVal := values.MK_ARRAY(matches)
+		return &retVal, nil
+	})
+
+	replace := values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+		str, err := stringArg("replace", args, 2, 2)
+		if err != nil {
+			return nil, err
+		}
+
+		var result strings.Builder
+		last := 0
+		for _, loc := range re.FindAllStringSubmatchIndex(str, -1) {
+			result.WriteString(str[last:loc[0]])
+			last = loc[1]
+
+			switch args[1].Type {
+			case shared.String:
+				// $1 and ${name} insert the groups
+				result.Write(re.ExpandString(nil, args[1].Value.(string), str, loc))
+			case shared.Function:
+				out, err := helpers.EvalFnVal(&args[1], []shared.RuntimeValue{makeMatch(re, str, loc)}, env)
+				if err != nil {
+					return nil, err
+				}
+				if out.Type != shared.String {
+					return nil, &errors.RuntimeError{Message: fmt.Sprintf("replace() expects the callback to return a string, got %s", shared.Stringify(out.Type))}
+				}
+				result.WriteString(out.Value.(string))
+			default:
+				return nil, &errors.RuntimeError{Message: fmt.Sprintf("replace() expects string or function as replacement, got %s", shared.Stringify(args[1].Type))}
+			}
+		}
+		result.WriteString(str[last:])
+
+		retVal := values.MK_STRING(result.String())
+		return &retVal, nil
+	})
+
+	split := values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+		str, err := stringArg("split", args, 1, 2)
+		if err != nil {
+			return nil, err
+		}
+		limit := -1
+		if len(args) == 2 {
+			if args[1].Type != shared.Number {
+				return nil, &errors.RuntimeError{Message: fmt.Sprintf("split() expects number as limit, got %s", shared.Stringify(args[1].Type))}
+			}
+			limit = int(args[1].Value.(float64))
+		}
+
+		parts := []shared.RuntimeValue{}
+		for _, part := range re.Split(str, limit) {
+			parts = append(parts, values.MK_STRING(part))
+		}
+		retVal := values.MK_ARRAY(parts)
+		return &retVal, nil
+	})
+
+	source := values.MK_STRING(args[0].Value.(string))
+	flagsVal := values.MK_STRING(flags)
+
+	retVal := values.MK_OBJECT(map[string]*shared.RuntimeValue{
+		"source":   &source,
+		"flags":    &flagsVal,
+		"test":     &test,
+		"match":    &match,
+		"matchAll": &matchAll,
+		"replace":  &replace,
+		"split":    &split,
+	})
+	return &retVal, nil
+})
+
+// makeMatch describes the match of re in str found at loc, as returned by
+// FindStringSubmatchIndex. Indexes count characters, not bytes.
+func makeMatch(re *regexp.Regexp, str string, loc []int) shared.RuntimeValue {
+	text := values.MK_STRING(str[loc[0]:loc[1]])
+	index := values.MK_NUMBER(float64(utf8.RuneCountInString(str[:loc[0]])))
+
+	// Groups that did not take part in the match are nil
+	groups := make([]shared.RuntimeValue, 0, re.NumSubexp())
+	named := map[string]*shared.RuntimeValue{}
+	for i, name := range re.SubexpNames()[1:] {
+		group := values.MK_NIL()
+		if start := loc[2*(i+1)]; start >= 0 {
+			group = values.MK_STRING(str[start:loc[2*(i+1)+1]])
+		}
+		groups = append(groups, group)
+		if name != "" {
+			named[name] = &group
+		}
+	}
+	groupsVal := values.MK_ARRAY(groups)
+	namedVal := values.MK_OBJECT(named)
+
+	return values.MK_OBJECT(map[string]*shared.RuntimeValue{
+		"match":  &text,
+		"index":  &index,
+		"groups": &groupsVal,
+		"named":  &namedVal,
+	})
+}
@@ -0,0 +1,20 @@
+package regex
+
+import (
+	"regexp"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// Escapes the characters of a string that have a meaning in patterns, so that it matches literally
+var escape = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) != 1 || args[0].Type != shared.String {
+		return nil, &errors.RuntimeError{Message: "escape() expects a string"}
+	}
+
+	retVal := values.MK_STRING(regexp.QuoteMeta(args[0].Value.(string)))
+	return &retVal, nil
+})
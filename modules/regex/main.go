@@ -0,0 +1,79 @@
+package regex
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/dev-kas/xel/modules"
+
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// The cache is emptied once it holds this many patterns
+const maxCachedPatterns = 512
+
+// Compiled patterns, by flags and source
+var cache = map[string]*regexp.Regexp{}
+var cacheMutex sync.Mutex
+
+// Go equivalent of each flag
+var flagSyntax = map[rune]string{
+	'i': "i", // Case-insensitive
+	'm': "m", // ^ and $ match at the start and end of lines
+	's': "s", // . matches newlines
+	'U': "U", // Quantifiers are lazy by default
+}
+
+// compilePattern compiles pattern with flags, or returns it from the cache
+func compilePattern(pattern, flags string) (*regexp.Regexp, error) {
+	goFlags := ""
+	for _, flag := range flags {
+		syntax, ok := flagSyntax[flag]
+		if !ok {
+			return nil, fmt.Errorf("unknown flag '%c'", flag)
+		}
+		if !strings.Contains(goFlags, syntax) {
+			goFlags += syntax
+		}
+	}
+
+	source := pattern
+	if goFlags != "" {
+		source = "(?" + goFlags + ")" + pattern
+	}
+
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	if re, cached := cache[source]; cached {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cache) >= maxCachedPatterns {
+		clear(cache)
+	}
+	cache[source] = re
+	return re, nil
+}
+
+func module() (*shared.RuntimeValue, *errors.RuntimeError) {
+	mod := values.MK_OBJECT(map[string]*shared.RuntimeValue{
+		"compile": &compile,
+		"escape":  &escape,
+	})
+
+	return &mod, nil
+}
+
+func init() {
+	modules.RegisterNativeModule("xel:regex", module)
+}
@@ -0,0 +1,36 @@
+package test
+
+import (
+	"github.com/dev-kas/xel/helpers"
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+var describe = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) != 2 {
+		return nil, &errors.RuntimeError{Message: "describe() takes exactly 2 arguments"}
+	}
+	if args[0].Type != shared.String {
+		return nil, &errors.RuntimeError{Message: "describe() expects a string as first argument"}
+	}
+	if args[1].Type != shared.Function {
+		return nil, &errors.RuntimeError{Message: "describe() expects a function as second argument"}
+	}
+
+	pushSuite(args[0].Value.(string))
+	defer popSuite()
+
+	// Errors raised outside of `it` blocks are not attributed to any test
+	// case, so they abort the whole test file
+	_, err := helpers.EvalTracedFnVal(&args[1], []shared.RuntimeValue{}, env, xShared.XelRootDebugger)
+	if err != nil {
+		return nil, err
+	}
+
+	nilVal := values.MK_NIL()
+	return &nilVal, nil
+})
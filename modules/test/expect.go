@@ -0,0 +1,183 @@
+package test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/dev-kas/xel/helpers"
+
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	vHelpers "github.com/dev-kas/virtlang-go/v4/helpers"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+// matcher describes a single assertion available on the object returned by expect()
+type matcher struct {
+	minArgs int
+	maxArgs int
+	// check reports whether the assertion holds, along with the expectation
+	// it tested for (e.g. `to equal 5`), used to build the failure message
+	check func(actual shared.RuntimeValue, args []shared.RuntimeValue, env *environment.Environment) (bool, string, *errors.RuntimeError)
+}
+
+var matchers = map[string]matcher{
+	"toBe": {1, 1, func(actual shared.RuntimeValue, args []shared.RuntimeValue, env *environment.Environment) (bool, string, *errors.RuntimeError) {
+		return same(&actual, &args[0]), "to be " + repr(args[0]), nil
+	}},
+	"toEqual": {1, 1, func(actual shared.RuntimeValue, args []shared.RuntimeValue, env *environment.Environment) (bool, string, *errors.RuntimeError) {
+		return helpers.EqualRuntimeValues(&actual, &args[0]), "to equal " + repr(args[0]), nil
+	}},
+	"toBeTruthy": {0, 0, func(actual shared.RuntimeValue, args []shared.RuntimeValue, env *environment.Environment) (bool, string, *errors.RuntimeError) {
+		return vHelpers.IsTruthy(&actual), "to be truthy", nil
+	}},
+	"toBeFalsy": {0, 0, func(actual shared.RuntimeValue, args []shared.RuntimeValue, env *environment.Environment) (bool, string, *errors.RuntimeError) {
+		return !vHelpers.IsTruthy(&actual), "to be falsy", nil
+	}},
+	"toBeNil": {0, 0, func(actual shared.RuntimeValue, args []shared.RuntimeValue, env *environment.Environment) (bool, string, *errors.RuntimeError) {
+		return actual.Type == shared.Nil, "to be nil", nil
+	}},
+	"toBeGreaterThan": {1, 1, func(actual shared.RuntimeValue, args []shared.RuntimeValue, env *environment.Environment) (bool, string, *errors.RuntimeError) {
+		if actual.Type != shared.Number || args[0].Type != shared.Number {
+			return false, "", &errors.RuntimeError{Message: "toBeGreaterThan() can only compare numbers"}
+		}
+		return actual.Value.(float64) > args[0].Value.(float64), "to be greater than " + repr(args[0]), nil
+	}},
+	"toBeLessThan": {1, 1, func(actual shared.RuntimeValue, args []shared.RuntimeValue, env *environment.Environment) (bool, string, *errors.RuntimeError) {
+		if actual.Type != shared.Number || args[0].Type != shared.Number {
+			return false, "", &errors.RuntimeError{Message: "toBeLessThan() can only compare numbers"}
+		}
+		return actual.Value.(float64) < args[0].Value.(float64), "to be less than " + repr(args[0]), nil
+	}},
+	"toContain": {1, 1, func(actual shared.RuntimeValue, args []shared.RuntimeValue, env *environment.Environment) (bool, string, *errors.RuntimeError) {
+		expectation := "to contain " + repr(args[0])
+		switch actual.Type {
+		case shared.String:
+			if args[0].Type != shared.String {
+				return false, "", &errors.RuntimeError{Message: "toContain() expects a string when the actual value is a string"}
+			}
+			return strings.Contains(actual.Value.(string), args[0].Value.(string)), expectation, nil
+		case shared.Array:
+			for _, item := range actual.Value.([]shared.RuntimeValue) {
+				if helpers.EqualRuntimeValues(&item, &args[0]) {
+					return true, expectation, nil
+				}
+			}
+			return false, expectation, nil
+		case shared.Object:
+			if args[0].Type != shared.String {
+				return false, "", &errors.RuntimeError{Message: "toContain() expects a string key when the actual value is an object"}
+			}
+			_, exists := actual.Value.(map[string]*shared.RuntimeValue)[args[0].Value.(string)]
+			return exists, "to contain key " + repr(args[0]), nil
+		default:
+			return false, "", &errors.RuntimeError{Message: "toContain() expects the actual value to be a string, array or object"}
+		}
+	}},
+	"toHaveLength": {1, 1, func(actual shared.RuntimeValue, args []shared.RuntimeValue, env *environment.Environment) (bool, string, *errors.RuntimeError) {
+		if args[0].Type != shared.Number {
+			return false, "", &errors.RuntimeError{Message: "toHaveLength() expects a number as first argument"}
+		}
+		var length int
+		switch actual.Type {
+		case shared.String:
+			length = len([]rune(actual.Value.(string)))
+		case shared.Array:
+			length = len(actual.Value.([]shared.RuntimeValue))
+		case shared.Object:
+			length = len(actual.Value.(map[string]*shared.RuntimeValue))
+		default:
+			return false, "", &errors.RuntimeError{Message: "toHaveLength() expects the actual value to be a string, array or object"}
+		}
+		return float64(length) == args[0].Value.(float64), "to have length " + repr(args[0]), nil
+	}},
+	"toThrow": {0, 1, func(actual shared.RuntimeValue, args []shared.RuntimeValue, env *environment.Environment) (bool, string, *errors.RuntimeError) {
+		if actual.Type != shared.Function {
+			return false, "", &errors.RuntimeError{Message: "toThrow() expects the actual value to be a function"}
+		}
+		if len(args) == 1 && args[0].Type != shared.String {
+			return false, "", &errors.RuntimeError{Message: "toThrow() expects a string as first argument"}
+		}
+
+		_, err := helpers.EvalFnVal(&actual, []shared.RuntimeValue{}, env)
+		if len(args) == 0 {
+			return err != nil, "to throw", nil
+		}
+
+		expected := args[0].Value.(string)
+		return err != nil && strings.Contains(err.Message, expected), "to throw an error containing " + repr(args[0]), nil
+	}},
+}
+
+var expect = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) != 1 {
+		return nil, &errors.RuntimeError{Message: "expect() takes exactly 1 argument"}
+	}
+
+	assertions := makeAssertions(args[0], false)
+	negated := values.MK_OBJECT(makeAssertions(args[0], true))
+	assertions["not"] = &negated
+
+	obj := values.MK_OBJECT(assertions)
+	return &obj, nil
+})
+
+// makeAssertions binds every matcher to the actual value
+func makeAssertions(actual shared.RuntimeValue, negate bool) map[string]*shared.RuntimeValue {
+	assertions := make(map[string]*shared.RuntimeValue, len(matchers))
+
+	for name, m := range matchers {
+		fn := values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+			if len(args) < m.minArgs || len(args) > m.maxArgs {
+				switch {
+				case m.minArgs == m.maxArgs && m.minArgs == 1:
+					return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() takes exactly 1 argument", name)}
+				case m.minArgs == m.maxArgs:
+					return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() takes exactly %d arguments", name, m.minArgs)}
+				default:
+					return nil, &errors.RuntimeError{Message: fmt.Sprintf("%s() takes at most %d argument", name, m.maxArgs)}
+				}
+			}
+
+			pass, expectation, err := m.check(actual, args, env)
+			if err != nil {
+				return nil, err
+			}
+
+			if pass == negate {
+				if negate {
+					expectation = "not " + expectation
+				}
+				return nil, &errors.RuntimeError{Message: fmt.Sprintf("expected %s %s", repr(actual), expectation)}
+			}
+
+			nilVal := values.MK_NIL()
+			return &nilVal, nil
+		})
+		assertions[name] = &fn
+	}
+
+	return assertions
+}
+
+// same reports whether two values are identical: primitives are compared
+// by value, while objects and arrays must be the very same reference
+func same(a, b *shared.RuntimeValue) bool {
+	if a.Type != b.Type {
+		return false
+	}
+
+	switch a.Type {
+	case shared.Object, shared.Array:
+		aVal, bVal := reflect.ValueOf(a.Value), reflect.ValueOf(b.Value)
+		return aVal.Pointer() == bVal.Pointer() && aVal.Len() == bVal.Len()
+	default:
+		return helpers.EqualRuntimeValues(a, b)
+	}
+}
+
+func repr(value shared.RuntimeValue) string {
+	return helpers.Stringify(value, true)
+}
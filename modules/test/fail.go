@@ -0,0 +1,24 @@
+package test
+
+import (
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+var fail = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) > 1 {
+		return nil, &errors.RuntimeError{Message: "fail() takes at most 1 argument"}
+	}
+
+	if len(args) == 0 {
+		return nil, &errors.RuntimeError{Message: "test failed"}
+	}
+
+	if args[0].Type != shared.String {
+		return nil, &errors.RuntimeError{Message: "fail() expects a string as first argument"}
+	}
+
+	return nil, &errors.RuntimeError{Message: args[0].Value.(string)}
+})
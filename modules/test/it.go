@@ -0,0 +1,79 @@
+package test
+
+import (
+	"time"
+
+	"github.com/dev-kas/xel/helpers"
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/dev-kas/virtlang-go/v4/debugger"
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+var it = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) != 2 {
+		return nil, &errors.RuntimeError{Message: "it() takes exactly 2 arguments"}
+	}
+	if args[0].Type != shared.String {
+		return nil, &errors.RuntimeError{Message: "it() expects a string as first argument"}
+	}
+	if args[1].Type != shared.Function {
+		return nil, &errors.RuntimeError{Message: "it() expects a function as second argument"}
+	}
+
+	name := args[0].Value.(string)
+	result := Result{
+		Suites: currentSuites(),
+		Name:   name,
+		Status: Passed,
+	}
+
+	start := time.Now()
+	err, stack := runCase(&args[1], env, name)
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		result.Status = Failed
+		result.Message = err.Message
+		result.Stack = stack
+	}
+
+	report(result)
+
+	nilVal := values.MK_NIL()
+	return &nilVal, nil
+})
+
+// runCase calls fn under the root debugger. If it fails, the error is returned along
+// with the call stack at the point of failure, topped by a frame for the test case
+// itself that points at the position the error surfaced from.
+func runCase(fn *shared.RuntimeValue, env *environment.Environment, name string) (*errors.RuntimeError, debugger.CallStack) {
+	dbgr := xShared.XelRootDebugger
+	snapshotDepth := len(dbgr.Snapshots)
+
+	_, err := helpers.EvalTracedFnVal(fn, []shared.RuntimeValue{}, env, dbgr)
+	if err == nil {
+		return nil, nil
+	}
+
+	var stack debugger.CallStack
+	if len(dbgr.Snapshots) > snapshotDepth {
+		stack = debugger.DeepCopyCallStack(dbgr.Snapshots[snapshotDepth].Stack)
+		// The error is handled here, so its snapshots must not
+		// leak into the stack trace of an unrelated error
+		dbgr.Snapshots = dbgr.Snapshots[:snapshotDepth]
+	} else {
+		stack = debugger.DeepCopyCallStack(dbgr.CallStack)
+	}
+
+	stack = append(stack, debugger.StackFrame{
+		Name:     name,
+		Filename: dbgr.CurrentFile,
+		Line:     dbgr.CurrentLine,
+	})
+
+	return err, stack
+}
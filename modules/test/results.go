@@ -0,0 +1,118 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dev-kas/xel/helpers"
+	xShared "github.com/dev-kas/xel/shared"
+
+	"github.com/dev-kas/virtlang-go/v4/debugger"
+)
+
+// Status describes the outcome of a single test case
+type Status string
+
+const (
+	Passed  Status = "passed"
+	Failed  Status = "failed"
+	Skipped Status = "skipped"
+)
+
+// Result holds the outcome of a single `it` (or `skip`) call
+type Result struct {
+	File     string             // Test file the case was declared in
+	Suites   []string           // Names of the enclosing `describe` blocks, outermost first
+	Name     string             // Name of the test case
+	Status   Status             // Outcome of the test case
+	Message  string             // Failure message, if the case failed
+	Stack    debugger.CallStack // Call stack at the point of failure (most recent call last), if the case failed
+	Duration time.Duration      // Time spent running the test case
+}
+
+// FullName returns the name of the test case prefixed with the names of its enclosing suites
+func (r Result) FullName() string {
+	return strings.Join(append(append([]string{}, r.Suites...), r.Name), " > ")
+}
+
+var (
+	mu         sync.Mutex
+	collecting bool
+	file       string
+	suites     []string
+	results    []Result
+)
+
+// Collect makes the module record results for the test file at path instead
+// of printing them as they happen. Results are retrieved with Results.
+func Collect(path string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	collecting = true
+	file = path
+	suites = nil
+	results = nil
+}
+
+// Results returns the results recorded since the last call to Collect and stops collecting
+func Results() []Result {
+	mu.Lock()
+	defer mu.Unlock()
+
+	collected := results
+	collecting = false
+	file = ""
+	suites = nil
+	results = nil
+	return collected
+}
+
+func currentSuites() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]string{}, suites...)
+}
+
+func pushSuite(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	suites = append(suites, name)
+}
+
+func popSuite() {
+	mu.Lock()
+	defer mu.Unlock()
+	if len(suites) > 0 {
+		suites = suites[:len(suites)-1]
+	}
+}
+
+// report records a result, or prints it straight away when no runner is collecting
+func report(result Result) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if collecting {
+		result.File = file
+		results = append(results, result)
+		return
+	}
+
+	switch result.Status {
+	case Passed:
+		xShared.ColorPalette.Info.Printf("✓ %s\n", result.FullName())
+	case Skipped:
+		xShared.ColorPalette.Warning.Printf("- %s (skipped)\n", result.FullName())
+	case Failed:
+		xShared.ColorPalette.Error.Printf("✗ %s\n", result.FullName())
+		xShared.ColorPalette.Error.Printf("  %s\n", result.Message)
+		if len(result.Stack) > 0 {
+			cwd, _ := os.Getwd()
+			fmt.Println(helpers.GenerateStackTrace(result.Stack, cwd))
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package test
+
+import (
+	"github.com/dev-kas/virtlang-go/v4/environment"
+	"github.com/dev-kas/virtlang-go/v4/errors"
+	"github.com/dev-kas/virtlang-go/v4/shared"
+	"github.com/dev-kas/virtlang-go/v4/values"
+)
+
+var skip = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environment.Environment) (*shared.RuntimeValue, *errors.RuntimeError) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, &errors.RuntimeError{Message: "skip() takes 1 or 2 arguments"}
+	}
+	if args[0].Type != shared.String {
+		return nil, &errors.RuntimeError{Message: "skip() expects a string as first argument"}
+	}
+
+	report(Result{
+		Suites: currentSuites(),
+		Name:   args[0].Value.(string),
+		Status: Skipped,
+	})
+
+	nilVal := values.MK_NIL()
+	return &nilVal, nil
+})
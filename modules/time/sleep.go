@@ -3,6 +3,8 @@ package time
 import (
 	"time"
 
+	xShared "github.com/dev-kas/xel/shared"
+
 	"github.com/dev-kas/virtlang-go/v4/environment"
 	"github.com/dev-kas/virtlang-go/v4/errors"
 	"github.com/dev-kas/virtlang-go/v4/shared"
@@ -14,7 +16,13 @@ var sleep = values.MK_NATIVE_FN(func(args []shared.RuntimeValue, env *environmen
 	if len(args) != 1 || args[0].Type != shared.Number {
 		return nil, &errors.RuntimeError{Message: "sleep expects a number"}
 	}
-	time.Sleep(time.Duration(args[0].Value.(float64)) * time.Millisecond)
+	// An interrupted evaluation stops at its next statement, so there is no need to wait
+	interrupted, done := xShared.Interruptible()
+	defer done()
+	select {
+	case <-time.After(time.Duration(args[0].Value.(float64)) * time.Millisecond):
+	case <-interrupted:
+	}
 	nilVal := values.MK_NIL()
 	return &nilVal, nil
 })
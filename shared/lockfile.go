@@ -0,0 +1,180 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// LockfileVersion is the format of the xel.lock files written by this version of Xel
+const LockfileVersion = 2
+
+// Sources a locked package can come from
+const (
+	RegistrySource = "registry" // A tarball from the package registry
+	GitSource      = "git"      // A tag of a git repository
+	LocalSource    = "local"    // A package that was only found in the module paths
+)
+
+// Lockfile records the dependency graph of a project, so that installing it
+// again gives the same packages
+//
+// Example:
+//
+//	{
+//	    "lockfileVersion": 2,
+//	    "deps": { "http-utils": "1.2.0" },
+//	    "packages": {
+//	        "http-utils@1.2.0": {
+//	            "name": "http-utils",
+//	            "version": "1.2.0",
+//	            "source": "registry",
+//	            "url": "https://.../http-utils-1.2.0.tar.gz",
+//	            "algorithm": "sha256",
+//	            "hash": "9f86d08...",
+//	            "deps": { "strings-extra": "0.3.1" }
+//	        },
+//	        "strings-extra@0.3.1": { ... }
+//	    }
+//	}
+type Lockfile struct {
+	Version  int                       `json:"lockfileVersion"` // Format of the lockfile
+	Deps     map[string]string         `json:"deps"`            // Versions the dependencies of the project resolved to
+	Packages map[string]*LockedPackage `json:"packages"`        // Every package of the graph, by `name@version`
+}
+
+// LockedPackage is a package recorded in a lockfile
+type LockedPackage struct {
+	Name      string            `json:"name"`                // Package name
+	Version   string            `json:"version"`             // Exact version
+	Source    string            `json:"source"`              // Where the package comes from (see RegistrySource)
+	URL       string            `json:"url,omitempty"`       // URL of the tarball, or of the git repository
+	Algorithm string            `json:"algorithm,omitempty"` // Algorithm of the integrity hash
+	Hash      string            `json:"hash,omitempty"`      // Hash of the tarball, or the commit of a git tag
+	Deps      map[string]string `json:"deps,omitempty"`      // Versions the dependencies of the package resolved to
+}
+
+// LockKey returns the key of a package in Lockfile.Packages
+func LockKey(name, version string) string {
+	return name + "@" + version
+}
+
+// NewLockfile returns an empty lockfile
+func NewLockfile() *Lockfile {
+	return &Lockfile{
+		Version:  LockfileVersion,
+		Deps:     map[string]string{},
+		Packages: map[string]*LockedPackage{},
+	}
+}
+
+// ReadLockfile reads the lockfile at path. A missing file gives an empty
+// lockfile, and lockfiles written by older versions of Xel are converted.
+func ReadLockfile(path string) (*Lockfile, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewLockfile(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile %s: %v", path, err)
+	}
+
+	lockfile := NewLockfile()
+	if _, versioned := fields["lockfileVersion"]; versioned {
+		if err := json.Unmarshal(data, lockfile); err != nil {
+			return nil, fmt.Errorf("failed to parse lockfile %s: %v", path, err)
+		}
+		if lockfile.Version > LockfileVersion {
+			return nil, fmt.Errorf("lockfile %s has version %d, which needs a newer version of Xel", path, lockfile.Version)
+		}
+		if lockfile.Deps == nil {
+			lockfile.Deps = map[string]string{}
+		}
+		if lockfile.Packages == nil {
+			lockfile.Packages = map[string]*LockedPackage{}
+		}
+		return lockfile, nil
+	}
+
+	// The first lockfiles held one registry tarball per package name, without the edges between them
+	var legacy map[string]struct {
+		Algorithm string `json:"algorithm"`
+		Hash      string `json:"hash"`
+		URL       string `json:"url"`
+		Version   string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile %s: %v", path, err)
+	}
+	for name, entry := range legacy {
+		lockfile.Deps[name] = entry.Version
+		lockfile.Packages[LockKey(name, entry.Version)] = &LockedPackage{
+			Name:      name,
+			Version:   entry.Version,
+			Source:    RegistrySource,
+			URL:       entry.URL,
+			Algorithm: entry.Algorithm,
+			Hash:      entry.Hash,
+		}
+	}
+	return lockfile, nil
+}
+
+// Write saves the lockfile to path
+func (l *Lockfile) Write(path string) error {
+	l.Version = LockfileVersion
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Locked returns the package that the dependency name of the package at key
+// resolved to, or of the project itself when key is empty
+func (l *Lockfile) Locked(key, name string) *LockedPackage {
+	deps := l.Deps
+	if key != "" {
+		parent, exists := l.Packages[key]
+		if !exists {
+			return nil
+		}
+		deps = parent.Deps
+	}
+
+	version, exists := deps[name]
+	if !exists {
+		return nil
+	}
+	return l.Packages[LockKey(name, version)]
+}
+
+// Prune removes the packages that the dependencies of the project no longer lead to
+func (l *Lockfile) Prune() {
+	reachable := map[string]bool{}
+	var visit func(deps map[string]string)
+	visit = func(deps map[string]string) {
+		for name, version := range deps {
+			key := LockKey(name, version)
+			if reachable[key] {
+				continue
+			}
+			reachable[key] = true
+			if pkg, exists := l.Packages[key]; exists {
+				visit(pkg.Deps)
+			}
+		}
+	}
+	visit(l.Deps)
+
+	for key := range l.Packages {
+		if !reachable[key] {
+			delete(l.Packages, key)
+		}
+	}
+}
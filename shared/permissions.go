@@ -0,0 +1,221 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Permission is a capability that a script has to be granted before it
+// can use it while running sandboxed
+type Permission string
+
+const (
+	ReadPermission  Permission = "read"  // Reading files and directories
+	WritePermission Permission = "write" // Creating, modifying and removing files and directories
+	ExecPermission  Permission = "exec"  // Running external programs
+	FFIPermission   Permission = "ffi"   // Loading native libraries
+	NetPermission   Permission = "net"   // Opening network connections
+)
+
+// AllPermissions lists every known permission
+var AllPermissions = []Permission{ReadPermission, WritePermission, ExecPermission, FFIPermission, NetPermission}
+
+// ParsePermission returns the permission with the given name
+func ParsePermission(name string) (Permission, bool) {
+	for _, perm := range AllPermissions {
+		if string(perm) == name {
+			return perm, true
+		}
+	}
+	return "", false
+}
+
+// IsPathScoped reports whether the entries of the permission are filesystem paths
+func (p Permission) IsPathScoped() bool {
+	return p == ReadPermission || p == WritePermission || p == FFIPermission
+}
+
+// PermissionGrant describes how much of a permission is granted. A grant covers
+// either everything, or only its entries: paths for read, write and ffi (each
+// covering everything beneath it), program names or paths for exec, and hosts,
+// optionally with a port, for net.
+//
+// In xel.json, a grant is written as `true`, `false` or a list of entries.
+type PermissionGrant struct {
+	All     bool
+	Entries []string
+}
+
+func (g *PermissionGrant) UnmarshalJSON(data []byte) error {
+	var all bool
+	if err := json.Unmarshal(data, &all); err == nil {
+		*g = PermissionGrant{All: all}
+		return nil
+	}
+
+	var entries []string
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("a permission must be true, false or a list of strings")
+	}
+	*g = PermissionGrant{Entries: entries}
+	return nil
+}
+
+func (g PermissionGrant) MarshalJSON() ([]byte, error) {
+	if g.All || len(g.Entries) == 0 {
+		return json.Marshal(g.All)
+	}
+	return json.Marshal(g.Entries)
+}
+
+// PermissionError is returned when a sandboxed script uses a permission it was not granted
+type PermissionError struct {
+	Permission Permission
+	Target     string
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("permission denied: missing %q permission for %s (grant it with --allow-%s)", e.Permission, e.Target, e.Permission)
+}
+
+// Permissions holds the permissions granted to the running scripts
+type Permissions struct {
+	// Sandboxed tells whether permissions are enforced at all
+	Sandboxed bool
+	grants    map[Permission]*PermissionGrant
+	mu        sync.RWMutex
+}
+
+// XelPermissions holds the permissions of the running process. Scripts run
+// unrestricted unless the sandbox is enabled.
+var XelPermissions = &Permissions{grants: map[Permission]*PermissionGrant{}}
+
+// GrantAll grants perm without restrictions
+func (p *Permissions) GrantAll(perm Permission) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.grants[perm] = &PermissionGrant{All: true}
+}
+
+// Grant grants perm for the given entries, in addition to those already granted
+func (p *Permissions) Grant(perm Permission, entries ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	grant, exists := p.grants[perm]
+	if !exists {
+		grant = &PermissionGrant{}
+		p.grants[perm] = grant
+	}
+	grant.Entries = append(grant.Entries, entries...)
+}
+
+// Check returns a *PermissionError if the scripts may not use perm on target.
+// Targets are absolute paths for read, write and ffi, program names or paths for
+// exec, and `host` or `host:port` for net.
+func (p *Permissions) Check(perm Permission, target string) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if !p.Sandboxed {
+		return nil
+	}
+
+	grant, exists := p.grants[perm]
+	if !exists {
+		return &PermissionError{Permission: perm, Target: target}
+	}
+	if grant.All {
+		return nil
+	}
+
+	for _, entry := range grant.Entries {
+		var matches bool
+		switch perm {
+		case ExecPermission:
+			matches = programMatches(entry, target)
+		case NetPermission:
+			matches = hostMatches(entry, target)
+		default:
+			matches = pathWithin(canonicalPath(entry), canonicalPath(target))
+		}
+		if matches {
+			return nil
+		}
+	}
+
+	return &PermissionError{Permission: perm, Target: target}
+}
+
+// canonicalPath makes path absolute and resolves the symlinks in the part of it
+// that exists, so that links cannot be used to escape an allowed directory
+func canonicalPath(path string) string {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+
+	rest := ""
+	for current := path; ; current = filepath.Dir(current) {
+		if resolved, err := filepath.EvalSymlinks(current); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		if filepath.Dir(current) == current {
+			return path
+		}
+		rest = filepath.Join(filepath.Base(current), rest)
+	}
+}
+
+// pathWithin reports whether path is root or lies beneath it
+func pathWithin(root, path string) bool {
+	if root == path {
+		return true
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
+
+// programMatches reports whether the exec entry allows running program. Bare
+// names only match the same bare name, which is looked up in PATH, while paths
+// are compared after resolving them.
+func programMatches(entry, program string) bool {
+	entryIsPath := strings.ContainsRune(entry, os.PathSeparator)
+	programIsPath := strings.ContainsRune(program, os.PathSeparator)
+
+	switch {
+	case !entryIsPath && !programIsPath:
+		return entry == program
+	case entryIsPath && programIsPath:
+		return canonicalPath(entry) == canonicalPath(program)
+	case !entryIsPath:
+		resolved, err := exec.LookPath(entry)
+		return err == nil && canonicalPath(resolved) == canonicalPath(program)
+	default:
+		return false
+	}
+}
+
+// hostMatches reports whether the net entry allows connecting to target.
+// An entry without a port allows every port of the host.
+func hostMatches(entry, target string) bool {
+	targetHost, targetPort, err := net.SplitHostPort(target)
+	if err != nil {
+		targetHost, targetPort = target, ""
+	}
+
+	entryHost, entryPort, err := net.SplitHostPort(entry)
+	if err != nil {
+		return strings.EqualFold(entry, targetHost)
+	}
+	return strings.EqualFold(entryHost, targetHost) && entryPort == targetPort
+}
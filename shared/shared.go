@@ -2,8 +2,10 @@ package shared
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/dev-kas/virtlang-go/v4/debugger"
 	"github.com/dev-kas/virtlang-go/v4/environment"
@@ -16,6 +18,40 @@ var EngineVersion string
 var XelRootEnv *environment.Environment = environment.NewEnvironment(nil)
 var XelRootDebugger *debugger.Debugger = debugger.NewDebugger(XelRootEnv)
 
+// interruption is told to the native functions that block while an evaluation runs
+type interruption struct {
+	interrupted chan struct{}
+	blocking    sync.WaitGroup // Native functions that have yet to return
+}
+
+var interruptMu sync.Mutex
+var currentInterruption = &interruption{interrupted: make(chan struct{})}
+
+// Interruptible is called by native functions that block, such as `http.serve`.
+// The channel it returns is closed once the evaluation running now is
+// interrupted, and done must be called when the function returns, after
+// releasing what it holds.
+func Interruptible() (interrupted <-chan struct{}, done func()) {
+	interruptMu.Lock()
+	defer interruptMu.Unlock()
+	current := currentInterruption
+	current.blocking.Add(1)
+	return current.interrupted, current.blocking.Done
+}
+
+// Interrupt tells the native functions of the evaluation running now that it is
+// interrupted, and waits for them to return. The evaluations that follow are
+// told apart.
+func Interrupt() {
+	interruptMu.Lock()
+	current := currentInterruption
+	currentInterruption = &interruption{interrupted: make(chan struct{})}
+	interruptMu.Unlock()
+
+	close(current.interrupted)
+	current.blocking.Wait()
+}
+
 func XelDir() string {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -39,6 +75,8 @@ type Config struct {
 	ModulePaths         []string `json:"ModulePaths"`
 	PackageRegistryURI  string   `json:"PackageRegistryURI"`
 	AllowInstallScripts bool     `json:"AllowInstallScripts"`
+	RegistryToken       string   `json:"RegistryToken,omitempty"` // Token `xel pkg publish` authenticates with
+	Offline             bool     `json:"Offline,omitempty"`       // Install packages only from ModulePaths and a file:// registry
 }
 
 // ProjectManifest represents the metadata and configuration of a Xel project
@@ -51,8 +89,13 @@ type Config struct {
 // - Engine: Required VirtLang engine version (e.g., "^2.1.0")
 // - Main: The main entry point file (relative to project root)
 // - Deps: Project dependencies (key-value pairs of package names and versions)
+// - DevDeps: Dependencies only the project itself needs, such as test helpers; they are not installed for packages
+// - OptionalDeps: Dependencies that are installed when possible, and skipped when their install fails
+// - PeerDeps: Dependencies of a package that the project installing it must have itself
 // - Author: The author of the project
 // - License: The license under which the project is distributed
+// - Permissions: Permissions granted to the project when it runs sandboxed (see Permissions)
+// - Scripts: Named tasks of the project, run by `xel task` (see Script)
 //
 // Example:
 //
@@ -70,24 +113,120 @@ type Config struct {
 //	    "license": "MIT"
 //	}
 type ProjectManifest struct {
-	Name        string             `json:"name"`                 // Project name
-	Description string             `json:"description"`          // Project description
-	Version     string             `json:"version"`              // Project version
-	Xel         *string            `json:"xel,omitempty"`        // Required Xel runtime version
-	Engine      *string            `json:"engine,omitempty"`     // Required VirtLang engine version
-	Main        string             `json:"main"`                 // Main entry point file
-	Deps        *map[string]string `json:"deps,omitempty"`       // Project dependencies
-	Author      string             `json:"author"`               // Project author
-	License     string             `json:"license"`              // Project license
-	Tags        []string           `json:"tags,omitempty"`       // Project tags
-	Deprecated  *string            `json:"deprecated,omitempty"` // Project deprecation message
-}
-
-type Lockfile map[string]struct {
-	Algorithm string `json:"algorithm"` // Algorithm used for hashing
-	Hash      string `json:"hash"`      // Hash of the file
-	URL       string `json:"url"`       // URL of the file
-	Version   string `json:"version"`   // Version of the package
+	Name         string                      `json:"name"`                   // Project name
+	Description  string                      `json:"description"`            // Project description
+	Version      string                      `json:"version"`                // Project version
+	Xel          *string                     `json:"xel,omitempty"`          // Required Xel runtime version
+	Engine       *string                     `json:"engine,omitempty"`       // Required VirtLang engine version
+	Main         string                      `json:"main"`                   // Main entry point file
+	Deps         *map[string]string          `json:"deps,omitempty"`         // Project dependencies
+	DevDeps      *map[string]string          `json:"devDeps,omitempty"`      // Dependencies of the project only, not of its dependents
+	OptionalDeps *map[string]string          `json:"optionalDeps,omitempty"` // Dependencies whose install may fail
+	PeerDeps     *map[string]string          `json:"peerDeps,omitempty"`     // Dependencies the installing project must have
+	Author       string                      `json:"author"`                 // Project author
+	License      string                      `json:"license"`                // Project license
+	Tags         []string                    `json:"tags,omitempty"`         // Project tags
+	Deprecated   *string                     `json:"deprecated,omitempty"`   // Project deprecation message
+	Permissions  map[string]*PermissionGrant `json:"permissions,omitempty"`  // Permissions granted when running sandboxed
+	Scripts      map[string]*Script          `json:"scripts,omitempty"`      // Tasks run by `xel task`
+}
+
+// InstalledDeps returns the dependencies that are installed along with the
+// project: its deps and optional deps, and its dev deps when it is the root
+// project rather than a dependency of another one. A package listed in several
+// kinds gets the constraint of deps first, then of dev deps.
+func (m *ProjectManifest) InstalledDeps(root bool) map[string]string {
+	deps := map[string]string{}
+	kinds := []*map[string]string{m.OptionalDeps}
+	if root {
+		kinds = append(kinds, m.DevDeps)
+	}
+	kinds = append(kinds, m.Deps)
+	for _, kind := range kinds {
+		if kind == nil {
+			continue
+		}
+		for name, spec := range *kind {
+			deps[name] = spec
+		}
+	}
+	return deps
+}
+
+// ImportableDeps returns the packages the scripts of the project may import: the
+// dependencies it installs, and its peer dependencies, which are provided by the
+// project that installs it
+func (m *ProjectManifest) ImportableDeps(root bool) map[string]string {
+	deps := m.InstalledDeps(root)
+	if m.PeerDeps != nil {
+		for name, spec := range *m.PeerDeps {
+			if _, listed := deps[name]; !listed {
+				deps[name] = spec
+			}
+		}
+	}
+	return deps
+}
+
+// IsOptional reports whether the dependency name may fail to install
+func (m *ProjectManifest) IsOptional(name string) bool {
+	if m.OptionalDeps == nil {
+		return false
+	}
+	_, optional := (*m.OptionalDeps)[name]
+	return optional && !listsDep(m.Deps, name) && !listsDep(m.DevDeps, name)
+}
+
+// IsDev reports whether the dependency name is only needed by the project itself
+func (m *ProjectManifest) IsDev(name string) bool {
+	return listsDep(m.DevDeps, name) && !listsDep(m.Deps, name)
+}
+
+// listsDep reports whether the dependencies deps list name
+func listsDep(deps *map[string]string, name string) bool {
+	if deps == nil {
+		return false
+	}
+	_, listed := (*deps)[name]
+	return listed
+}
+
+// Script is a task of a project. Run is either a `.xel` file, relative to the
+// project root and followed by its arguments, or a shell command line. A script
+// may also name the tasks that must run before it, in which case Run may be
+// empty to only group them.
+//
+// In xel.json, a script is written as its command line, or as an object with
+// `run`, `deps` and `description`.
+type Script struct {
+	Run         string   `json:"run,omitempty"`
+	Deps        []string `json:"deps,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+func (s *Script) UnmarshalJSON(data []byte) error {
+	var run string
+	if err := json.Unmarshal(data, &run); err == nil {
+		*s = Script{Run: run}
+		return nil
+	}
+
+	// A different type keeps this method from being called again
+	type script Script
+	var object script
+	if err := json.Unmarshal(data, &object); err != nil {
+		return fmt.Errorf("a script must be a command line or an object with `run`, `deps` and `description`")
+	}
+	*s = Script(object)
+	return nil
+}
+
+func (s Script) MarshalJSON() ([]byte, error) {
+	if len(s.Deps) == 0 && s.Description == "" {
+		return json.Marshal(s.Run)
+	}
+	type script Script
+	return json.Marshal(script(s))
 }
 
 // XelConfig holds the application configuration